@@ -28,6 +28,9 @@
 	var __ARRAY_OBJECT__ = 0;//数组Element唯一标识
 	
 	
+	//格式化内容的版本，头部行中的兼容版本高于此版本时不能解析，格式说明见 README/docment/format.md
+	var __FORMAT_VERSION__ = 1;
+
 	//加载外部包
 	var __PACKAGE_LIST__ = [];
 	var __PACKAGE_COUNT__ = 0; 
@@ -383,7 +386,7 @@
 		var value = pkg.url;
 		var ul = new URLLoader();
 		var req = new URLRequest(value);
-		req.method = URLRequestMethod.POST;
+		req.method = pkg.method || URLRequestMethod.POST;
 		
 		ul.addEventListener("complete",function(e){
 			__PACKAGE_COUNT__ --;
@@ -431,15 +434,37 @@
 				v = __READ_DATA__(p.substring(1));
 				//console.log(t,v,v.value.length);
 				switch(t){
+					case 'V' ://头部行：版本;compat=兼容版本
+						var compat = /(^|;)compat=(\d+)/.exec(v.value);
+						if(compat && parseInt(compat[2]) > __FORMAT_VERSION__){
+							____ERROR____(module + ": format " + v.value + " isn't supported by module.js " + __FORMAT_VERSION__);
+							return;
+						}
+					break;
 					case 'A' ://外部CSS
 						if(!__MODULE_STYLE__[__APPDOMAIN__]){
 							__MODULE_STYLE__[__APPDOMAIN__] = {};
 						}
-						if(!__MODULE_STYLE__[__APPDOMAIN__][v.module]){
+						if(__LIVE_UPDATE__ || !__MODULE_STYLE__[__APPDOMAIN__][v.module]){
 							__MODULE_STYLE__[__APPDOMAIN__][v.module] = true;
-							document.head.appendChild(__InitCSS__(v.module,v.value.replace(/\\r/g,'\r').replace(/\\n/g,'\n')));
+							var css = __InitCSS__(v.module,v.value.replace(/\\r/g,'\r').replace(/\\n/g,'\n'));
+							var old = document.head.querySelector("style[class_id='" + v.module + "']");
+							if(old){//替换模块时更新样式
+								document.head.replaceChild(css,old);
+							}else{
+								document.head.appendChild(css);
+							}
 						}	
 					break;
+					case 'G' ://多个模块共用的组件样式，在发布的共享样式表中
+						if(!__MODULE_STYLE__[__APPDOMAIN__]){
+							__MODULE_STYLE__[__APPDOMAIN__] = {};
+						}
+						if(!__MODULE_STYLE__[__APPDOMAIN__][v.module]){
+							__MODULE_STYLE__[__APPDOMAIN__][v.module] = true;
+							__SHARED_STYLE__(v.value);
+						}
+					break;
 					case 'B' ://内部CSS
 						style = v.value + "\r\n" + style;
 					break;
@@ -450,9 +475,13 @@
 						if(v.value.charAt(0) == "S"){
 							_MODULE_CONTENT_LIST_[__APPDOMAIN__][v.module] = eval("(" + v.value.substr(1) + ")");
 							__FORMAT__(v.value.substr(1),uuid,__APPDOMAIN__,module);
+						}else if(v.value.charAt(0) == "B"){//打包时多个代码块共用的导入，内容在已加载的代码块中
+							__FORMAT__(__BUNDLE__.imports[v.module + " " + v.value.substr(1)],uuid,__APPDOMAIN__,module);
 						}else if(v.value.charAt(0) == "P"){//Package 引入外部包
 							//__PACKAGE__(v.value.substr(1));
-							__PACKAGE_LIST__.push({url:v.value.substr(1)});
+							if(!__BUNDLE__.packages[v.value.substr(1)]){//打包时已经包含的脚本不再加载
+								__PACKAGE_LIST__.push({url:v.value.substr(1)});
+							}
 						}else{
 							_MODULE_CONTENT_LIST_[__APPDOMAIN__][v.module] = v.value.substr(1);
 							__FORMAT__(v.value.substr(1),uuid,__APPDOMAIN__,module);
@@ -487,6 +516,9 @@
 					case "O" ://Error
 						____ERROR____(v.value);
 					break;
+					case "W" ://开发服务器，接收模块变化通知
+						__LIVE__(v.value,module,__APPDOMAIN__);
+					break;
 						
 				}
 				if(isNaN(v.index)){
@@ -498,6 +530,140 @@
 		}
 		__ADD_MOUDLE__(__APPDOMAIN__,module,{html:html,style:style,runLst:runLst});
 	}
+	/**
+	 * 开发服务器模块变化通知，使用的模块有变化时就地替换，无法替换时重新加载页面
+	 * @param path			websocket地址
+	 * @param module		使用的模块
+	 * @param __APPDOMAIN__	模块所在的程序作用域
+	 */
+	var __LIVE_SOCKET__ = null;
+	var __LIVE_MODULES__ = {};
+	var __LIVE_UPDATE__ = false;//正在替换模块
+	var __LIVE__ = function(path,module,__APPDOMAIN__){
+		__LIVE_MODULES__[module] = __APPDOMAIN__;
+		if(__LIVE_SOCKET__ || !window.WebSocket){
+			return;
+		}
+		var url = (window.location.protocol == "https:" ? "wss://" : "ws://") + window.location.host + path;
+		__LIVE_SOCKET__ = new WebSocket(url);
+		__LIVE_SOCKET__.onopen = function(){
+			__LIVE_SOCKET__.send("watch");
+		}
+		__LIVE_SOCKET__.onmessage = function(e){
+			var data = String(e.data);
+			var p = data.indexOf("\r\n");
+			var cmds = (p == -1 ? data : data.substring(0,p)).split(" ");
+			if(cmds[0] == "update"){
+				if(__LIVE_MODULES__[cmds[1]] && !__HOT_REPLACE__(cmds[1],data.substr(p + 2))){
+					window.location.reload();
+				}
+				return;
+			}
+			if(cmds[0] != "reload"){
+				return;
+			}
+			for(var i = 1;i<cmds.length;i++){
+				if(__LIVE_MODULES__[cmds[i]]){
+					break;
+				}
+			}
+			if(cmds.length == 1 || i < cmds.length){//没有指定模块时全部重新加载
+				window.location.reload();
+			}
+		}
+		__LIVE_SOCKET__.onclose = function(){//服务器重启后重新连接
+			__LIVE_SOCKET__ = null;
+			setTimeout(function(){
+				__LIVE__(path,module,__APPDOMAIN__);
+			},2000);
+		}
+	}
+
+	/**
+	 * 替换模块代码，重新生成模块实例的HTML和样式并执行初始化，保留实例中的数据
+	 * 组件编译时已合并到使用它的模块中，因此替换的是页面加载的模块实例
+	 * @param module	模块名称
+	 * @param data		模块重新编译后的格式化内容
+	 * @return 是否替换成功
+	 */
+	var __HOT_REPLACE__ = function(module,data){
+		var __APPDOMAIN__ = __LIVE_MODULES__[module];
+		try{
+			__LIVE_UPDATE__ = true;
+			__FORMAT__(data,__UUID__(),__APPDOMAIN__,module);
+			__LIVE_UPDATE__ = false;
+			var lst = document.querySelectorAll("[class_id='" + module + "']");
+			for(var i = 0;i<lst.length;i++){
+				var el = lst[i];
+				var uuid = el.id;
+				if(!uuid || !__MODULE_LIST__[uuid]){
+					continue;
+				}
+				//移除实例及其组件，组件的名称以实例名称开头
+				var old = {};
+				for(var name in __MODULE_LIST__){
+					if(name.indexOf(uuid) == 0 && !/[0-9]/.test(name.charAt(uuid.length))){
+						old[name] = __MODULE_LIST__[name];
+						delete __MODULE_LIST__[name];
+						delete window[name];
+					}
+				}
+				var holder = document.createElement("div");
+				el.parentNode.insertBefore(holder,el);
+				el.parentNode.removeChild(el);
+				__InitModule__(__APPDOMAIN__,module,uuid,undefined,holder,true);
+				while(holder.firstChild){
+					holder.parentNode.insertBefore(holder.firstChild,holder);
+				}
+				holder.parentNode.removeChild(holder);
+				for(var name in old){
+					__KEEP_STATE__(old[name],window[name]);
+				}
+			}
+		}catch(e){
+			__LIVE_UPDATE__ = false;
+			console.log("JUS HOT REPLACE: " + e);
+			return false;
+		}
+		return true;
+	}
+
+	/**
+	 * 把旧实例中的数据复制到新实例，函数和DOM对象不复制
+	 */
+	var __KEEP_STATE__ = function(old,obj){
+		if(!old || !obj){
+			return;
+		}
+		var v = null;
+		for(var p in old){
+			if(!old.hasOwnProperty(p) || p == "dom"){
+				continue;
+			}
+			v = old[p];
+			if(typeof v == "function" || v instanceof Node){
+				continue;
+			}
+			obj[p] = v;
+		}
+	}
+
+	/**
+	 * 引入共享样式表，同一地址只引入一次
+	 */
+	var __SHARED_STYLE__ = function(url){
+		var links = document.head.getElementsByTagName("link");
+		for(var i = 0;i<links.length;i++){
+			if(links[i].getAttribute("href") == url){
+				return;
+			}
+		}
+		var s = document.createElement("link");
+		s.setAttribute("rel","stylesheet");
+		s.setAttribute("href",url);
+		document.head.appendChild(s);
+	}
+
 	/**
 	 * 转化为对象
 	 */
@@ -714,13 +880,147 @@
 	
 	 
 	var JUS = {};
-	JUS.loadModule = function(target,module,value,listener,__APPDOMAIN__){
-		url = "juis/" + module.replace(/\./g,'/') + ".html";
+	/**
+	 * 发布清单，按内容hash命名发布时把模块类名解析为实际地址
+	 * 页面可以预先设置 window.__JUS_MANIFEST__，否则第一次加载模块时读取 manifest.json，不存在时使用默认地址
+	 */
+	var __MANIFEST__ = window.__JUS_MANIFEST__ || null;
+	var __MANIFEST_WAIT__ = [];
+	var __MODULE_URL__ = function(module,func){
+		if(__MANIFEST__){
+			var modules = __MANIFEST__.modules || {};
+			func(modules[module] || "juis/" + module.replace(/\./g,'/') + ".html");
+			return;
+		}
+		__MANIFEST_WAIT__.push(function(){
+			__MODULE_URL__(module,func);
+		});
+		if(__MANIFEST_WAIT__.length > 1){
+			return;
+		}
+		var done = function(value){
+			__MANIFEST__ = value;
+			var lst = __MANIFEST_WAIT__;
+			__MANIFEST_WAIT__ = [];
+			for(var i = 0;i<lst.length;i++){
+				lst[i]();
+			}
+		}
+		var ul = asjs.url("manifest.json",function(e){
+			try{
+				done(JSON.parse(e.target.data));
+			}catch(err){
+				done({});
+			}
+		});
+		ul.addEventListener(IOErrorEvent.IO_Error,function(e){
+			done({});
+		});
+	}
+
+	/**
+	 * 打包发布的模块、脚本和共用的导入，release --bundle 生成的脚本和代码块通过 JUS.bundle 注册
+	 */
+	var __BUNDLE__ = {modules:{},packages:{},imports:{}};
+	JUS.bundle = function(value){
+		var modules = value.modules || {};
+		for(var k in modules){
+			__BUNDLE__.modules[k] = modules[k];
+		}
+		var packages = value.packages || [];
+		for(var i = 0;i<packages.length;i++){
+			__BUNDLE__.packages[packages[i]] = true;
+		}
+		var imports = value.imports || {};
+		for(var k in imports){
+			__BUNDLE__.imports[k] = imports[k];
+		}
+		__MANIFEST__ = __MANIFEST__ || {};//打包后不需要读取 manifest.json
+		if(value.chunks){
+			__MANIFEST__.chunks = value.chunks;
+		}
+	}
+	/**
+	 * 打包的模块按找到的文件名记录类名，类名的大小写不同时不区分大小写查找
+	 */
+	var __BUNDLE_NAME__ = function(module){
+		if(typeof __BUNDLE__.modules[module] == "string"){
+			return module;
+		}
+		var name = module.toLowerCase();
+		for(var k in __BUNDLE__.modules){
+			if(k.toLowerCase() == name){
+				return k;
+			}
+		}
+		return module;
+	}
+	/**
+	 * 模块所在的按需加载代码块
+	 */
+	var __CHUNK__ = function(module){
+		var chunks = (__MANIFEST__ && __MANIFEST__.chunks) || {};
+		var name = module.toLowerCase();
+		for(var k in chunks){
+			var modules = chunks[k].modules || [];
+			for(var i = 0;i<modules.length;i++){
+				if(modules[i].toLowerCase() == name){
+					return k;
+				}
+			}
+		}
+		return null;
+	}
+	/**
+	 * 把代码块和它依赖的代码块加入外部包列表，依赖的代码块在前，由 __LOAD_PACKAGE__ 同时下载后按顺序执行
+	 */
+	var __LOAD_CHUNK__ = function(name){
+		var c = __MANIFEST__.chunks[name];
+		if(!c){
+			return;
+		}
+		var deps = c.deps || [];
+		for(var i = 0;i<deps.length;i++){
+			__LOAD_CHUNK__(deps[i]);
+		}
+		for(var i = 0;i<__PACKAGE_LIST__.length;i++){
+			if(__PACKAGE_LIST__[i].url == c.file){
+				return;
+			}
+		}
+		__PACKAGE_LIST__.push({url:c.file,method:URLRequestMethod.GET});
+	}
+	/**
+	 * 读取模块的格式化内容，已打包的模块不再请求服务器，拆分出的模块先加载所在的代码块
+	 */
+	var __MODULE_DATA__ = function(module,func){
+		if(typeof __BUNDLE__.modules[__BUNDLE_NAME__(module)] == "string"){
+			var data = __BUNDLE__.modules[__BUNDLE_NAME__(module)];
+			setTimeout(function(){
+				func(data);
+			},0);
+			return;
+		}
+		var chunk = __CHUNK__(module);
+		if(chunk){
+			__LOAD_CHUNK__(chunk);
+			__LOAD_PACKAGE__(function(){
+				func(__BUNDLE__.modules[__BUNDLE_NAME__(module)]);
+			});
+			return;
+		}
 		var load = window.location.toString().indexOf("http:") == 0 ? asjs.post : asjs.get;
+		__MODULE_URL__(module,function(url){
+			load(url,function(e){
+				func(e.target.data);
+			});
+		});
+	}
+
+	JUS.loadModule = function(target,module,value,listener,__APPDOMAIN__){
 		var _CF_ = null;
-		load(url,function(e){
+		__MODULE_DATA__(module,function(data){
 			__APPDOMAIN__ = __APPDOMAIN__ || "local";
-			var data = e.target.data;
 			//var w = __INIT__(__UUID__(),module,data,value,__APPDOMAIN__,target);
 			var uuid = __UUID__();
 			__FORMAT__(data,uuid,__APPDOMAIN__,module);
@@ -734,7 +1034,6 @@
 					_CF_(w);
 				}
 			});
-			
 		});
 		return {listener:function(value){
 			_CF_ = value;
@@ -742,12 +1041,9 @@
 	}
 
 	JUS.addModule = function(target,module,value,listener,__APPDOMAIN__){
-		url = "juis/" + module.replace(/\./g,'/') + ".html";
-		var load = window.location.toString().indexOf("http:") == 0 ? asjs.post : asjs.get;
 		var _CF_ = null;
-		load(url,function(e){
+		__MODULE_DATA__(module,function(data){
 			__APPDOMAIN__ = __APPDOMAIN__ || "local";
-			var data = e.target.data;
 			//var w = __INIT__(__UUID__(),module,data,value,__APPDOMAIN__,target);
 			var uuid = __UUID__();
 			__FORMAT__(data,uuid,__APPDOMAIN__,module);
@@ -761,7 +1057,6 @@
 					_CF_(w);
 				}
 			});
-			
 		});
 		return {listener:function(value){
 			_CF_ = value;
@@ -798,6 +1093,19 @@
 			}
 			
 		}
+		if(typeof __BUNDLE__.modules[module] == "string"){//已打包但还没有加载
+			return function(){
+				return __INIT__(__UUID__(),module,__BUNDLE__.modules[module],arguments,__APPDOMAIN__,window);
+			};
+		}
+		if(__CHUNK__(module)){//拆分到代码块中但还没有加载，需要先通过JUS.loadModule加载
+			alert("getModule[" + module + "] isn't loaded, chunk: " + __CHUNK__(module));
+			return null;
+		}
+		if(__MANIFEST__ && __MANIFEST__.modules && __MANIFEST__.modules[module]){//已发布但还没有加载，需要先通过JUS.loadModule加载
+			alert("getModule[" + module + "] isn't loaded, release path: " + __MANIFEST__.modules[module]);
+			return null;
+		}
 		alert("getModule[" + module + "] is not exist.");
 		return null;
 	}
@@ -0,0 +1,244 @@
+// jus project cli.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/util"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * 无界面命令的输出结果
+ */
+type cliResult struct {
+	Command  string   `json:"command"`
+	Status   string   `json:"status"` //ok 或 error
+	Project  string   `json:"project,omitempty"`
+	Out      []string `json:"out,omitempty"`
+	Modules  int      `json:"modules"`
+	Failed   int      `json:"failed"`
+	Bytes    int64    `json:"bytes"`              //发布写出的字节数
+	Errors   int      `json:"errors,omitempty"`   //检查发现的错误数
+	Warnings int      `json:"warnings,omitempty"` //检查发现的警告数
+	Error    string   `json:"error,omitempty"`
+}
+
+/**
+ * 各命令的选项，值为是否需要参数
+ */
+var cliOptions = map[string]map[string]bool{
+	"release": {"--out": true, "--hash": false, "--minify": false, "--compress": false, "--bundle": true, "--split": false},
+	"lint":    {},
+	"serve":   {"--addr": true},
+	"ctp":     {},
+}
+
+/**
+ * 解析选项，未知的选项和缺少参数的选项返回错误
+ * @param cmd	命令
+ * @param args	工程路径之后的参数
+ * @return 选项到参数，不需要参数的选项为空字符串
+ */
+func cliFlags(cmd string, args []string) (map[string]string, error) {
+	opts := cliOptions[cmd]
+	flags := make(map[string]string, len(args))
+	for i := 0; i < len(args); i++ {
+		needValue, ok := opts[args[i]]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %s for %s", args[i], cmd)
+		}
+		if needValue {
+			if i+1 >= len(args) || len(args[i+1]) > 2 && args[i+1][0:2] == "--" {
+				return nil, fmt.Errorf("option %s needs a value", args[i])
+			}
+			flags[args[i]] = args[i+1]
+			i++
+		} else {
+			flags[args[i]] = ""
+		}
+	}
+	return flags, nil
+}
+
+/**
+ * 无界面命令模式，供构建脚本直接调用编译器，不显示启动画面，不执行jus.conf，执行完毕即退出
+ * jus release <工程路径> [--out 发布路径] [--hash] [--minify] [--compress] [--bundle 入口模块 [--split]]
+ * jus ctp <工程路径>
+ * jus ctf <工程路径> [-h|m|s|r] <模块全路径>
+ * jus lint <工程路径>
+ * jus serve <发布路径> [--addr :8080]
+ * 标准输出逐行输出JSON结果，编译过程中的信息输出到标准错误
+ * 工程路径不存在时不是无界面命令，按原来的方式执行，例如 jus release <服务名称>
+ * @param args 	命令参数
+ * @return 是否为无界面命令, 退出码(0:成功 1:编译失败 2:参数错误)
+ */
+func headless(args []string) (bool, int) {
+	if len(args) < 2 {
+		return false, 0
+	}
+	switch args[0] {
+	case "ctp", "release", "ctf", "lint", "serve":
+	default:
+		return false, 0
+	}
+	if args[0] != "ctp" && !Exist(args[1]) { //不是路径时按服务名称执行，例如 release <服务名称>
+		return false, 0
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	var err error
+	SysPath, err = filepath.Abs("./")
+	if err != nil {
+		enc.Encode(&cliResult{Command: args[0], Status: "error", Error: lang["加载系统路径错误"]})
+		return true, 2
+	}
+
+	flags := map[string]string{}
+	if args[0] != "ctf" { //ctf 的参数按位置读取
+		if flags, err = cliFlags(args[0], args[2:]); err != nil {
+			enc.Encode(&cliResult{Command: args[0], Status: "error", Error: err.Error()})
+			return true, 2
+		}
+	}
+
+	res := &cliResult{Command: args[0], Status: "ok"}
+	code := 0
+	switch args[0] {
+	case "release":
+		u := &JusServer{}
+		u.CreateServer("./lib", args[1])
+		res.Project = u.RootPath
+		out := u.GetAttr("release-path")
+		if v, ok := flags["--out"]; ok {
+			out = []string{v}
+		}
+		bundle := flags["--bundle"] //打包入口模块及其依赖为一个脚本
+
+		if _, ok := flags["--hash"]; ok { //按内容hash命名，生成manifest.json
+			u.ReleaseHash = true
+		}
+		if _, ok := flags["--minify"]; ok { //压缩脚本和样式
+			u.ReleaseMinify = true
+		}
+		if _, ok := flags["--split"]; ok { //打包时拆分按需加载的模块
+			u.ReleaseSplit = true
+		}
+		if _, ok := flags["--compress"]; ok { //生成.gz和.br预压缩文件
+			u.ReleaseCompress = true
+		}
+		if len(out) == 0 {
+			res.Status = "error"
+			res.Error = "release-path isn't set, use --out <dir>."
+			enc.Encode(res)
+			return true, 2
+		}
+		for _, v := range out {
+			res.Out = append(res.Out, v)
+			var list []*ReleaseModule
+			var sum *ReleaseSummary
+			if bundle != "" {
+				b, err := u.BundleTo(bundle, v)
+				if err != nil {
+					res.Error = err.Error()
+				}
+				list, sum = b.Modules, b.Summary() //字节数为打包后写出的文件大小
+			} else {
+				list = u.ReleaseTo(v)
+				sum = Summarize(list)
+			}
+			for _, m := range list {
+				enc.Encode(m)
+			}
+			res.Modules += sum.Modules
+			res.Failed += sum.Failed
+			res.Bytes += sum.Bytes
+		}
+		if res.Failed > 0 || res.Error != "" {
+			res.Status = "error"
+			code = 1
+		}
+	case "lint":
+		u := &JusServer{}
+		u.CreateServer("./lib", args[1])
+		res.Project = u.RootPath
+		list := u.Lint()
+		for _, m := range list {
+			enc.Encode(m)
+			if m.Status == "error" {
+				res.Failed++
+			}
+		}
+		sum := LintSummarize(list)
+		res.Modules, res.Errors, res.Warnings = sum.Modules, sum.Errors, sum.Warnings
+		if res.Failed > 0 {
+			res.Status = "error"
+			code = 1
+		}
+	case "serve": //发布目录的静态服务，支持压缩和ETag，直到进程结束
+		addr := ":8080"
+		if v, ok := flags["--addr"]; ok {
+			addr = v
+		}
+		abs, _ := filepath.Abs(args[1])
+		res.Project = abs
+		res.Out = []string{addr}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			res.Status = "error"
+			res.Error = err.Error()
+			enc.Encode(res)
+			return true, 1
+		}
+		enc.Encode(res)
+		err = http.Serve(l, StaticHandler(abs))
+		res.Status = "error"
+		res.Error = err.Error()
+		code = 1
+	case "ctp":
+		abs, ok := initProjectDir(args[1])
+		res.Project = abs
+		if !ok {
+			res.Status = "error"
+			res.Error = "project is exist."
+			code = 1
+		}
+	case "ctf":
+		if len(args) < 3 || len(args) > 4 || len(args) == 4 && (strings.Trim(args[2], "-smhr") != "" || strings.Trim(args[2], "-") == "") {
+			res.Status = "error"
+			res.Error = "usage: ctf <Project Path> [-h|m|s|r] <Class Name>"
+			enc.Encode(res)
+			return true, 2
+		}
+		u := &JusServer{}
+		u.CreateServer("./lib", args[1])
+		res.Project = u.RootPath
+		ok := false
+		if len(args) > 3 {
+			ok = u.CreateModule(args[2], args[3])
+		} else {
+			ok = u.CreateModule("-h", args[2])
+		}
+		if ok {
+			res.Modules = 1
+		} else {
+			res.Status = "error"
+			res.Error = "create module failed."
+			res.Failed = 1
+			code = 1
+		}
+	}
+	enc.Encode(res)
+	return true, code
+}
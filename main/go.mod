@@ -0,0 +1,10 @@
+module github.com/tianyueshi/AIroot-JUS/main
+
+go 1.18
+
+require (
+	github.com/tianyueshi/AIroot-JUS/src/jus v0.0.0
+	golang.org/x/net v0.35.0
+)
+
+replace github.com/tianyueshi/AIroot-JUS/src/jus => ../src/jus
@@ -3,12 +3,14 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	//_ "image/jpeg"
 	//_ "image/png"
-	. "jus"
-	. "jus/cn/airoot/util"
-	. "jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/util"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -52,6 +54,10 @@ func init() {
 	zhCN["服务正在启动"] = "%s 正在启动[%s]"
 	zhCN["关闭服务"] = "%s 服务关闭[%s]"
 	zhCN["发布完成"] = "----发布完成----"
+	zhCN["发布失败"] = "[%s] 发布失败: %s"
+	zhCN["发布统计"] = "编译模块 %d 个, 写出 %d 字节, 失败 %d 个"
+	zhCN["检查完成"] = "----检查完成----"
+	zhCN["检查统计"] = "检查模块 %d 个, 错误 %d 个, 警告 %d 个"
 	zhCN["添加WEB用户成功"] = "添加WEB用户成功."
 	zhCN["移除WEB用户成功"] = "移除WEB用户成功."
 	zhCN["模块创建成功"] = "模块创建成功."
@@ -61,7 +67,9 @@ func init() {
 	zhCN["ctp"] = "ctp 创建工程目录\r\n命令格式: ctp <工程路径>\r\n例如:ctp C:/jus/project/\r\n"
 	zhCN["stp"] = "stp 设置工程目录\r\n命令格式: stp <服务名称> <工程路径>\r\n例如:stp test C:/jus/project/\r\n"
 	zhCN["ctf"] = "ctf 创建模块页\r\n命令格式: ctf [-创建方式(-h|m|s|r)] <服务名称> <模块全路径>\r\n例如:ctf test component.Test\r\nctf test -hr component.Test\r\n"
-	zhCN["release"] = "release 发布工程\r\n命令格式: release <服务名称> [工程路径]\r\n例如:release test C:/jus/project/\r\n"
+	zhCN["release"] = "release 发布工程\r\n命令格式: release <服务名称> [工程路径]\r\n例如:release test C:/jus/project/\r\n无界面模式: jus release <工程路径> [--out 发布路径] [--hash] [--minify] [--compress] [--bundle 入口模块 [--split]]\r\n--hash 按内容hash命名模块和资源，并生成manifest.json，也可以在工程中设置 release-hash true\r\n--minify 压缩脚本和样式，去掉注释和空白并缩短私有成员名称，多个模块共用的组件样式合并到共享样式表，也可以在工程中设置 release-minify true\r\n--bundle 把入口模块和它依赖的模块、module.js及引用的lib/js脚本打包为一个.js文件，并生成index.html，不需要JUS服务器即可运行\r\n--split 打包时把只通过JUS.loadModule、JUS.addModule、getModule引用的模块拆分为按需加载的代码块，共用的内容放在公共代码块中，代码块和依赖写在manifest.json中，也可以在工程中设置 release-split true\r\n--compress 为文本文件生成.gz预压缩文件，安装了brotli命令时同时生成.br，静态服务器可以直接使用，也可以在工程中设置 release-compress true\r\n"
+	zhCN["serve"] = "serve 发布目录的静态服务，按客户端支持的编码返回压缩内容和预压缩文件，支持ETag和304\r\n无界面模式: jus serve <发布路径> [--addr :8080]\r\n"
+	zhCN["lint"] = "lint 静态检查工程，只编译不写出\r\n命令格式: lint <服务名称> [--json]\r\n例如:lint test\r\n无界面模式: jus lint <工程路径>\r\n报告编译错误、找不到的标签和@import、不存在的$id和#id引用、加载失败的扩展类、重复的id、没有使用的导入、找不到元素的@override\r\n--json 每个模块输出一行JSON\r\n"
 	zhCN["run"] = "run 启动服务\r\n命令格式: run <服务名称> [IP:端口], 例如:run test 127.0.0.1:1511\r\n"
 	zhCN["shutdown"] = "shutdown 停止服务\r\n命令格式: shutdown <服务名称>\r\n"
 	zhCN["rm"] = "rm 移除服务\r\n命令格式: rm <服务名称>\r\n"
@@ -102,6 +110,10 @@ func init() {
 	enCH["服务正在启动"] = "%s Start [%s]"
 	enCH["关闭服务"] = "%s Stop [%s]"
 	enCH["发布完成"] = "----Release Complete----"
+	enCH["发布失败"] = "[%s] release failed: %s"
+	enCH["发布统计"] = "%d modules compiled, %d bytes written, %d failed"
+	enCH["检查完成"] = "----Lint Complete----"
+	enCH["检查统计"] = "%d modules checked, %d errors, %d warnings"
 	enCH["添加WEB用户成功"] = "Add Web Controller [%s] Success."
 	enCH["移除WEB用户成功"] = "Remove Web Controller [%s] Success."
 	enCH["模块创建成功"] = "Create Module Success."
@@ -112,7 +124,9 @@ func init() {
 	enCH["ctp"] = "ctp create project dir.\r\nCOMMAND: ctp <Project Path>\r\nFor Example:ctp C:/jus/project/\r\n"
 	enCH["stp"] = "stp set project dir.\r\nCOMMAND: stp <Service Name> <Project Path>\r\nFor Example:stp test C:/jus/project/\r\n"
 	enCH["ctf"] = "ctf create module file.\r\nCOMMAND: ctf [-Create Method(-h|m|s|r)] <Service Name> <Project Path>\r\nFor Example:ctf test component.Test\r\nctf test -hr component.Test\r\n"
-	enCH["release"] = "release release project.\r\nCOMMAND: release <Service Name> [Project Path]\r\nFor Example:release test C:/jus/project/\r\n"
+	enCH["release"] = "release release project.\r\nCOMMAND: release <Service Name> [Project Path]\r\nFor Example:release test C:/jus/project/\r\nHeadless: jus release <Project Path> [--out Release Path] [--hash] [--minify] [--compress] [--bundle Class Name [--split]]\r\n--hash names modules and assets by content hash and writes manifest.json, or set release-hash true in the project\r\n--minify strips comments and whitespace from scripts and styles, shortens private member names and moves component styles used by several modules into a shared stylesheet, or set release-minify true in the project\r\n--bundle packs the entry module, the modules it depends on, module.js and the referenced lib/js scripts into one .js file with an index.html that runs without the JUS server\r\n--split moves modules only reached through JUS.loadModule, JUS.addModule or getModule into lazily loaded chunks, puts shared content into a common chunk and lists the chunks and their dependencies in manifest.json, or set release-split true in the project\r\n--compress writes .gz siblings of text files, and .br siblings when the brotli command is installed, so static hosts can serve them, or set release-compress true in the project\r\n"
+	enCH["serve"] = "serve serves a release directory, compressing responses the client accepts, using .br/.gz siblings and answering 304 for matching ETags.\r\nHeadless: jus serve <Release Path> [--addr :8080]\r\n"
+	enCH["lint"] = "lint check the project without writing output.\r\nCOMMAND: lint <Service Name> [--json]\r\nFor Example:lint test\r\nHeadless: jus lint <Project Path>\r\nReports compile errors, unresolved tags and @import paths, $id and #id references that aren't defined, extends that fail to load, duplicate ids, unused imports and @override entries that match no element\r\n--json prints one JSON line per module\r\n"
 	enCH["run"] = "run Start service.\r\nCOMMAND: run <Service Name> [IP:PORT], For Example:run test 127.0.0.1:1511\r\n"
 	enCH["shutdown"] = "shutdown Shutdown Service.\r\nCOMMAND: shutdown <Service Name>\r\n"
 	enCH["rm"] = "rm Remove Service.\r\nCOMMAND: rm <Service Name>\r\n"
@@ -143,10 +157,27 @@ var _Count_ int = 0
  * @param path 	目录路径
  */
 func CreateProjectDir(path string) bool {
+	abs, ok := initProjectDir(path)
+	if !ok {
+		return false
+	}
+	tName := GetName()
+	commandEvt("add " + tName + " " + abs)
+	DevPrintln(240, lang["项目挂载在"], tName)
+	_Count_++
+	return true
+}
+
+/**
+ * 建立工程目录文件，不挂载服务
+ * @param path 	目录路径
+ * @return 工程绝对路径
+ */
+func initProjectDir(path string) (string, bool) {
 	abs, _ := filepath.Abs(path)
 	if Exist(path) {
 		DevPrintln(335, lang["项目已存在"], abs)
-		return false
+		return abs, false
 	}
 	os.MkdirAll(path, 0777)
 	os.MkdirAll(path+"/code", 0777)
@@ -179,11 +210,7 @@ func CreateProjectDir(path string) bool {
 		f.WriteString("release-path " + filepath.Dir(abs) + "/" + filepath.Base(abs) + "-release/")
 	}
 	DevPrintln(2, lang["建立项目"], abs)
-	tName := GetName()
-	commandEvt("add " + tName + " " + abs)
-	DevPrintln(240, lang["项目挂载在"], tName)
-	_Count_++
-	return true
+	return abs, true
 }
 
 func GetName() string {
@@ -756,13 +783,51 @@ func command(cmds []string) (bool, string) {
 				if serverList[cmds[1]] == nil {
 					str = DevPrintln(335, lang["不存在服务"], cmds[1])
 				} else {
-					serverList[cmds[1]].Release()
-					str = DevPrintln(8, lang["发布完成"])
+					list := serverList[cmds[1]].Release()
+					for _, v := range list {
+						if v.Status != "ok" {
+							str += DevPrintln(335, lang["发布失败"], v.ClassName, v.Error)
+						}
+					}
+					sum := Summarize(list)
+					str += DevPrintln(8, lang["发布统计"], sum.Modules, sum.Bytes, sum.Failed)
+					str += DevPrintln(8, lang["发布完成"])
 				}
 			} else {
 				str = DevPrintln(8, lang["release"])
 			}
 			return true, str
+		case "lint": //静态检查项目
+			if len(cmds) > 1 {
+				if serverList[cmds[1]] == nil {
+					str = DevPrintln(335, lang["不存在服务"], cmds[1])
+				} else {
+					list := serverList[cmds[1]].Lint()
+					for _, m := range list {
+						if len(cmds) > 2 && cmds[2] == "--json" {
+							b := bytes.NewBufferString("")
+							enc := json.NewEncoder(b)
+							enc.SetEscapeHTML(false)
+							enc.Encode(m)
+							str += DevPrint(8, "%s", b.String())
+							continue
+						}
+						for _, v := range m.Diagnostics {
+							if v.Severity == DiagError {
+								str += DevPrintln(335, "%s", v.String())
+							} else {
+								str += DevPrintln(6, "%s", v.String())
+							}
+						}
+					}
+					sum := LintSummarize(list)
+					str += DevPrintln(8, lang["检查统计"], sum.Modules, sum.Errors, sum.Warnings)
+					str += DevPrintln(8, lang["检查完成"])
+				}
+			} else {
+				str = DevPrintln(8, lang["lint"])
+			}
+			return true, str
 		case "info": //查看项目设置
 			if len(cmds) > 1 {
 				if serverList[cmds[1]] == nil {
@@ -912,6 +977,8 @@ func command(cmds []string) (bool, string) {
 			str += DevPrintln(7, lang["stp"])
 			str += DevPrintln(7, lang["ctf"])
 			str += DevPrintln(7, lang["release"])
+			str += DevPrintln(7, lang["lint"])
+			str += DevPrintln(7, lang["serve"])
 			str += DevPrintln(7, lang["run"])
 			str += DevPrintln(7, lang["shutdown"])
 			str += DevPrintln(7, lang["rm"])
@@ -959,6 +1026,9 @@ var exitFlag bool = true
  */
 func main() {
 	lang = zhCN
+	if ok, code := headless(os.Args[1:]); ok { //无界面命令模式，执行完毕后退出
+		os.Exit(code)
+	}
 	SetConsoleTitle("AIroot JUS 公共编译平台")
 	DevPrintln(496, "http://www.airoot.cn/ ")
 	hostName, _ := os.Hostname()
@@ -0,0 +1,307 @@
+// format.go
+package format
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/**
+ * JUS模块格式化内容的编码和解码，格式说明见 README/docment/format.md
+ * 编译器输出、发布时改写和运行时 module.js 都按这里的格式读写
+ */
+
+const (
+	Version    = 1     //当前的格式版本
+	Compat     = 1     //读取当前格式需要的最低运行时版本
+	HeaderType = "V"   //头部行的类型
+	HeaderName = "jus" //头部行的名称
+)
+
+/**
+ * 格式化内容中的一行
+ * 普通行：类型 名称长度%内容长度 空格 名称 空格 md5 空格 内容 \r\n
+ * 执行行：R加类型 名称长度%内容长度 空格 名称 空格 内容 \r\n，没有md5
+ */
+type Line struct {
+	Type  string //行类型，一个字母，执行行为R加一个字母
+	Name  string //模块类名或作用域
+	Hash  string //内容的md5，执行行为空
+	Value string
+}
+
+/**
+ * 头部行中的版本信息
+ */
+type Header struct {
+	Version int               //写入时的格式版本，没有头部行时为0
+	Compat  int               //读取时需要的最低运行时版本
+	Flags   map[string]string //其他标记，不认识的标记忽略
+}
+
+/**
+ * 解析错误
+ */
+type SyntaxError struct {
+	Offset int //出错的字节位置
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return "jus format: " + e.Msg + " at " + strconv.Itoa(e.Offset)
+}
+
+/**
+ * 兼容版本高于当前版本时返回的错误
+ */
+var ErrIncompatible = errors.New("jus format: incompatible version")
+
+/**
+ * 长度按UTF-16计算，与运行时中JavaScript字符串的长度一致
+ */
+func Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 { //BMP以外的字符在JavaScript中是两个UTF-16单元
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+/**
+ * 从start开始n个UTF-16长度后的字节位置，超出时返回-1
+ */
+func offset(data string, start int, n int) int {
+	p := start
+	for n > 0 {
+		if p >= len(data) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(data[p:])
+		if r >= 0x10000 {
+			n -= 2
+		} else {
+			n--
+		}
+		p += size
+	}
+	if n < 0 { //长度落在一个字符的中间
+		return -1
+	}
+	return p
+}
+
+/**
+ * 内容的md5
+ */
+func Hash(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+/**
+ * 创建一行，执行行不计算md5
+ */
+func NewLine(tp string, name string, value string) *Line {
+	l := &Line{Type: tp, Name: name, Value: value}
+	if !l.IsRun() {
+		l.Hash = Hash(value)
+	}
+	return l
+}
+
+/**
+ * 是否为执行行
+ */
+func (l *Line) IsRun() bool {
+	return strings.HasPrefix(l.Type, "R")
+}
+
+/**
+ * 写出一行
+ */
+func (l *Line) WriteTo(data *bytes.Buffer) {
+	data.WriteString(l.Type)
+	data.WriteString(strconv.Itoa(Len(l.Name)))
+	data.WriteString("%")
+	data.WriteString(strconv.Itoa(Len(l.Value)))
+	data.WriteByte(' ')
+	data.WriteString(l.Name)
+	data.WriteByte(' ')
+	if !l.IsRun() {
+		data.WriteString(l.Hash)
+		data.WriteByte(' ')
+	}
+	data.WriteString(l.Value)
+	data.WriteString("\r\n")
+}
+
+/**
+ * 头部行，例如 V3%10 jus <md5> 1;compat=1
+ */
+func (h *Header) Line() *Line {
+	value := strconv.Itoa(h.Version) + ";compat=" + strconv.Itoa(h.Compat)
+	keys := make([]string, 0, len(h.Flags))
+	for k := range h.Flags {
+		if k != "compat" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value += ";" + k + "=" + h.Flags[k]
+	}
+	return NewLine(HeaderType, HeaderName, value)
+}
+
+/**
+ * 当前版本的头部
+ */
+func NewHeader() *Header {
+	return &Header{Version: Version, Compat: Compat}
+}
+
+/**
+ * 写出当前版本的头部行
+ */
+func WriteHeader(data *bytes.Buffer) {
+	NewHeader().Line().WriteTo(data)
+}
+
+/**
+ * 解析头部行的内容
+ */
+func parseHeader(value string) (*Header, error) {
+	lst := strings.Split(value, ";")
+	v, err := strconv.Atoi(lst[0])
+	if err != nil {
+		return nil, fmt.Errorf("jus format: bad version %q", lst[0])
+	}
+	h := &Header{Version: v, Compat: v}
+	for _, f := range lst[1:] {
+		k, fv := f, ""
+		if n := strings.IndexByte(f, '='); n != -1 {
+			k, fv = f[0:n], f[n+1:]
+		}
+		if k == "compat" {
+			if h.Compat, err = strconv.Atoi(fv); err != nil {
+				return nil, fmt.Errorf("jus format: bad compat %q", fv)
+			}
+			continue
+		}
+		if h.Flags == nil {
+			h.Flags = make(map[string]string, 2)
+		}
+		h.Flags[k] = fv
+	}
+	return h, nil
+}
+
+/**
+ * 读取p开始的一行
+ * @return 读取的行, 下一行的字节位置
+ */
+func Next(data string, p int) (*Line, int, error) {
+	n := strings.IndexByte(data[p:], ' ')
+	if n == -1 {
+		return nil, p, &SyntaxError{p, "missing length"}
+	}
+	head := data[p : p+n]
+	k := strings.IndexAny(head, "0123456789")
+	sep := strings.IndexByte(head, '%')
+	if k <= 0 || sep < k {
+		return nil, p, &SyntaxError{p, "bad line head " + strconv.Quote(head)}
+	}
+	nameLen, e1 := strconv.Atoi(head[k:sep])
+	valueLen, e2 := strconv.Atoi(head[sep+1:])
+	if e1 != nil || e2 != nil || nameLen < 0 || valueLen < 0 {
+		return nil, p, &SyntaxError{p, "bad length " + strconv.Quote(head)}
+	}
+	l := &Line{Type: head[0:k]}
+	if len(l.Type) > 2 || (len(l.Type) == 2 && !l.IsRun()) {
+		return nil, p, &SyntaxError{p, "bad line type " + strconv.Quote(l.Type)}
+	}
+	q := p + n + 1
+	end := offset(data, q, nameLen)
+	if end == -1 || end >= len(data) || data[end] != ' ' {
+		return nil, p, &SyntaxError{q, "bad name length"}
+	}
+	l.Name = data[q:end]
+	q = end + 1
+	if !l.IsRun() {
+		if q+33 > len(data) || data[q+32] != ' ' {
+			return nil, p, &SyntaxError{q, "bad md5"}
+		}
+		l.Hash = data[q : q+32]
+		q += 33
+	}
+	end = offset(data, q, valueLen)
+	if end == -1 || !strings.HasPrefix(data[end:], "\r\n") {
+		return nil, p, &SyntaxError{q, "bad value length"}
+	}
+	l.Value = data[q:end]
+	return l, end + 2, nil
+}
+
+/**
+ * 解析格式化内容，不处理头部行
+ */
+func Parse(data string) ([]*Line, error) {
+	lst := make([]*Line, 0, 8)
+	for p := 0; p < len(data); {
+		l, next, err := Next(data, p)
+		if err != nil {
+			return lst, err
+		}
+		lst = append(lst, l)
+		p = next
+	}
+	return lst, nil
+}
+
+/**
+ * 解码模块的格式化内容
+ * 第一行为头部行时读取版本，兼容版本高于当前版本时返回ErrIncompatible；没有头部行时版本为0
+ * @return 头部, 头部行以外的行
+ */
+func Decode(data []byte) (*Header, []*Line, error) {
+	lst, err := Parse(string(data))
+	if err != nil {
+		return nil, lst, err
+	}
+	h := &Header{}
+	if len(lst) > 0 && lst[0].Type == HeaderType && lst[0].Name == HeaderName {
+		if h, err = parseHeader(lst[0].Value); err != nil {
+			return nil, lst, err
+		}
+		lst = lst[1:]
+	}
+	if h.Compat > Version {
+		return h, lst, ErrIncompatible
+	}
+	return h, lst, nil
+}
+
+/**
+ * 编码模块的格式化内容，头部为nil时不写头部行
+ */
+func Encode(h *Header, lines []*Line) []byte {
+	data := bytes.NewBuffer(make([]byte, 0, 256))
+	if h != nil {
+		h.Line().WriteTo(data)
+	}
+	for _, l := range lines {
+		l.WriteTo(data)
+	}
+	return data.Bytes()
+}
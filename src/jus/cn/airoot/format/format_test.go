@@ -0,0 +1,142 @@
+// format_test.go
+package format
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sample() []*Line {
+	return []*Line{
+		NewLine("A", "comp.Card", ".card{color:red;}"),
+		NewLine("I", "util.Helper", "S function(){\r\n\treturn \"helper\";\n}"),
+		NewLine("I", "js/jquery.min.js", "Pjs/jquery.min.js"),
+		NewLine("M", "index", "(function(){})"),
+		NewLine("H", "index", "<div class=\"\b \">两个 😀</div>"),
+		NewLine("O", "index", ""),
+		NewLine("RS", "\b", "index"),
+		NewLine("RC", "", "[1,2]"),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	lines := sample()
+	data := Encode(NewHeader(), lines)
+	h, got, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != Version || h.Compat != Compat {
+		t.Errorf("header = %+v", h)
+	}
+	if !reflect.DeepEqual(got, lines) {
+		t.Errorf("decode(encode(lines)) differs:\n%q", data)
+	}
+	if again := Encode(h, got); !bytes.Equal(again, data) {
+		t.Errorf("encode(decode(data)) = %q, want %q", again, data)
+	}
+}
+
+func TestNoHeader(t *testing.T) {
+	data := Encode(nil, sample())
+	h, got, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 0 || len(got) != len(sample()) {
+		t.Errorf("version = %d, lines = %d", h.Version, len(got))
+	}
+}
+
+func TestLineEncoding(t *testing.T) {
+	tests := []struct {
+		line *Line
+		want string
+	}{
+		{NewLine("A", "a", "x"), "A1%1 a 9dd4e461268c8034f5c8564e155c67a6 x\r\n"},
+		{NewLine("RS", "\b", "index"), "RS1%5 \b index\r\n"},
+		{NewLine("H", "中文", "两个"), "H2%2 中文 " + Hash("两个") + " 两个\r\n"},
+		{NewLine("H", "e", "😀a"), "H1%3 e " + Hash("😀a") + " 😀a\r\n"}, //BMP以外的字符按两个长度计算
+		{NewHeader().Line(), "V3%10 jus " + Hash("1;compat=1") + " 1;compat=1\r\n"},
+	}
+	for _, v := range tests {
+		buf := &bytes.Buffer{}
+		v.line.WriteTo(buf)
+		if buf.String() != v.want {
+			t.Errorf("WriteTo(%+v) = %q, want %q", v.line, buf.String(), v.want)
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	h := &Header{Version: 3, Compat: 2, Flags: map[string]string{"minify": "true", "b": ""}}
+	_, _, err := Decode(Encode(h, nil))
+	if err != ErrIncompatible {
+		t.Fatalf("compat 2 error = %v, want ErrIncompatible", err)
+	}
+	h.Compat = 1
+	got, _, err := Decode(Encode(h, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("header = %+v, want %+v", got, h)
+	}
+	if v := h.Line().Value; v != "3;compat=1;b=;minify=true" {
+		t.Errorf("header value = %q", v)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	data := string(Encode(NewHeader(), sample()))
+	tests := []string{
+		data[0 : len(data)-1],
+		strings.Replace(data, "A9%17", "A9%18", 1),
+		strings.Replace(data, "M5%", "M5x", 1),
+		"XY1%1 a " + Hash("x") + " x\r\n",
+		"I1%1 a short x\r\n",
+	}
+	for _, v := range tests {
+		lst, err := Parse(v)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Parse(%q) error = %v, want SyntaxError", v, err)
+			continue
+		}
+		for _, l := range lst { //出错前的行仍然返回
+			if l.Type == "" {
+				t.Errorf("Parse(%q) returned empty line", v)
+			}
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	data := string(Encode(nil, sample()))
+	p, n := 0, 0
+	for p < len(data) {
+		l, next, err := Next(data, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		l.WriteTo(buf)
+		if buf.String() != data[p:next] {
+			t.Errorf("line %d = %q, want %q", n, data[p:next], buf.String())
+		}
+		p, n = next, n+1
+	}
+	if n != len(sample()) {
+		t.Errorf("read %d lines, want %d", n, len(sample()))
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := map[string]int{"": 0, "abc": 3, "两个": 2, "😀": 2, "a😀b": 4}
+	for s, want := range tests {
+		if got := Len(s); got != want {
+			t.Errorf("Len(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
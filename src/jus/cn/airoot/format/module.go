@@ -0,0 +1,141 @@
+// module.go
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+/**
+ * 模块格式化内容的JSON结构，与按行的格式一一对应，供其他工具和运行时读取
+ */
+type Module struct {
+	Version  int       `json:"version"`            //格式版本
+	Compat   int       `json:"compat"`             //读取需要的最低运行时版本
+	Class    string    `json:"class"`              //模块类名，取HTML行的名称
+	HTML     string    `json:"html"`               //HTML模板
+	Style    []string  `json:"style,omitempty"`    //模块内部样式（B行）
+	CSS      []*Item   `json:"css,omitempty"`      //组件样式（A行），共享样式表（G行）时 type 为 shared
+	Script   string    `json:"script,omitempty"`   //模块主脚本（M行）
+	Extends  []*Item   `json:"extends,omitempty"`  //扩展类（E行）
+	Statics  []*Static `json:"statics,omitempty"`  //静态方法（S行）
+	Imports  []*Import `json:"imports,omitempty"`  //导入的模块（I行）
+	Run      []*Item   `json:"run,omitempty"`      //执行列表（R行），name为作用域
+	Commands []*Item   `json:"commands,omitempty"` //命令脚本（C行）
+	Errors   []string  `json:"errors,omitempty"`   //编译错误（O行）
+	Live     string    `json:"live,omitempty"`     //开发服务器的websocket地址（W行）
+	Unknown  []*Item   `json:"unknown,omitempty"`  //不认识的行，type为行类型
+}
+
+/**
+ * 一项内容
+ */
+type Item struct {
+	Type  string `json:"type,omitempty"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+/**
+ * 导入的内容，type为 script、html、package、bundle
+ */
+type Import struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Value  string  `json:"value,omitempty"`  //脚本内容、外部脚本地址或打包时共用导入的md5
+	Module *Module `json:"module,omitempty"` //导入的HTML模块
+}
+
+/**
+ * 静态方法
+ */
+type Static struct {
+	Class string `json:"class"` //静态类名
+	Name  string `json:"name"`  //方法名
+	Value string `json:"value"`
+}
+
+var importTypes = map[byte]string{'S': "script", 'H': "html", 'P': "package", 'B': "bundle"}
+
+/**
+ * 把解码后的行整理为JSON结构
+ * @param h		头部，嵌套的模块为nil
+ * @param lines	头部行以外的行
+ */
+func NewModule(h *Header, lines []*Line) *Module {
+	m := &Module{}
+	if h != nil {
+		m.Version, m.Compat = h.Version, h.Compat
+	}
+	for _, l := range lines {
+		switch l.Type {
+		case "H":
+			m.Class, m.HTML = l.Name, l.Value
+		case "B":
+			m.Style = append(m.Style, l.Value)
+		case "A":
+			m.CSS = append(m.CSS, &Item{Name: l.Name, Value: l.Value})
+		case "G":
+			m.CSS = append(m.CSS, &Item{Type: "shared", Name: l.Name, Value: l.Value})
+		case "M":
+			m.Script = l.Value
+		case "E":
+			m.Extends = append(m.Extends, &Item{Name: l.Name, Value: l.Value})
+		case "S":
+			name, value := l.Value, ""
+			if n := strings.IndexByte(l.Value, ' '); n != -1 {
+				name, value = l.Value[0:n], l.Value[n+1:]
+			}
+			m.Statics = append(m.Statics, &Static{Class: l.Name, Name: name, Value: value})
+		case "I":
+			m.Imports = append(m.Imports, newImport(l))
+		case "C":
+			m.Commands = append(m.Commands, &Item{Name: l.Name, Value: l.Value})
+		case "O":
+			m.Errors = append(m.Errors, l.Value)
+		case "W":
+			m.Live = l.Value
+		default:
+			if l.IsRun() {
+				m.Run = append(m.Run, &Item{Type: l.Type[1:], Name: l.Name, Value: l.Value})
+			} else {
+				m.Unknown = append(m.Unknown, &Item{Type: l.Type, Name: l.Name, Value: l.Value})
+			}
+		}
+	}
+	return m
+}
+
+func newImport(l *Line) *Import {
+	v := &Import{Name: l.Name, Type: "unknown", Value: l.Value}
+	if l.Value == "" {
+		return v
+	}
+	if tp, ok := importTypes[l.Value[0]]; ok {
+		v.Type, v.Value = tp, l.Value[1:]
+	}
+	if v.Type == "html" {
+		if lst, err := Parse(v.Value); err == nil {
+			v.Module, v.Value = NewModule(nil, lst), ""
+		}
+	}
+	return v
+}
+
+/**
+ * 把模块的格式化内容转换为JSON，HTML中的 < > & 不转义
+ */
+func ToJSON(data []byte) ([]byte, error) {
+	h, lines, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(NewModule(h, lines)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
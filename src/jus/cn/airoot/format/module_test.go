@@ -0,0 +1,51 @@
+// module_test.go
+package format
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	nested := Encode(nil, []*Line{
+		NewLine("A", "comp.Card", ".card{}"),
+		NewLine("H", "comp.Card", "<div class=\"card\"></div>"),
+	})
+	data := Encode(NewHeader(), []*Line{
+		NewLine("I", "comp.Card", "H"+string(nested)),
+		NewLine("I", "util.Helper", "S(function(){})"),
+		NewLine("I", "js/a.js", "Pjs/a.js"),
+		NewLine("B", "index", ".a{}"),
+		NewLine("S", "util.Tool", "run __POS_VALUE__function(){}"),
+		NewLine("M", "index", "(function(){})"),
+		NewLine("H", "index", "<div>&</div>"),
+		NewLine("Q", "index", "x"),
+		NewLine("RS", "\b", "index"),
+	})
+	b, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Module{}
+	if err = json.Unmarshal(b, m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != Version || m.Class != "index" || m.HTML != "<div>&</div>" || m.Script != "(function(){})" {
+		t.Errorf("module = %+v", m)
+	}
+	if len(m.Imports) != 3 || m.Imports[0].Module == nil || m.Imports[0].Module.Class != "comp.Card" || len(m.Imports[0].Module.CSS) != 1 {
+		t.Fatalf("html import = %s", b)
+	}
+	if m.Imports[1].Type != "script" || m.Imports[1].Value != "(function(){})" || m.Imports[2].Type != "package" || m.Imports[2].Value != "js/a.js" {
+		t.Errorf("imports = %s", b)
+	}
+	if len(m.Statics) != 1 || *m.Statics[0] != (Static{"util.Tool", "run", "__POS_VALUE__function(){}"}) {
+		t.Errorf("statics = %s", b)
+	}
+	if len(m.Run) != 1 || *m.Run[0] != (Item{"S", "\b", "index"}) {
+		t.Errorf("run = %s", b)
+	}
+	if len(m.Unknown) != 1 || m.Unknown[0].Type != "Q" || len(m.Style) != 1 {
+		t.Errorf("unknown = %s", b)
+	}
+}
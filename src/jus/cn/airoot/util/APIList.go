@@ -2,8 +2,8 @@
 package util
 
 import (
-	. "jus"
-	. "jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
 	"strings"
 )
 
@@ -4,9 +4,10 @@ package util
 
 import (
 	"bytes"
-	. "jus"
-	. "jus/str"
-	. "jus/tool"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/tool"
+	"sort"
 	"strings"
 )
 
@@ -22,6 +23,12 @@ type HTMLScript struct {
 	extendScript     string
 	mjs              *MScript
 	isScript         bool
+	file             string              //源文件路径，用于诊断信息
+	index            *sourceIndex        //脚本代码到源码的位置索引，nil时不生成源码映射
+	marks            []codeMark          //最近一次initScriptFrom输出中记录的源码位置
+	classMarks       map[*Tag][]codeMark //内部class输出中记录的源码位置
+	mini             *minifier           //发布压缩时私有成员的短名称，内部class共用
+	imports          map[string]Position //检查时记录的import，使用后移除
 }
 
 func (s *HTMLScript) CreateFrom(jus *JUS, root string, domain string, constructorValue *Attr, innerValue string, extendScript string) *HTMLScript {
@@ -33,6 +40,7 @@ func (s *HTMLScript) CreateFrom(jus *JUS, root string, domain string, constructo
 	s.hMap = make(map[string]*Attr, 10)
 	s.extendScript = extendScript
 	s.gsMap = make(map[string]*GSetter, 10)
+	s.classMarks = make(map[*Tag][]codeMark, 2)
 	return s
 }
 
@@ -53,6 +61,7 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 	newString := bytes.NewBufferString("")
 	var hObj *HTMLObject = nil
 	var tjs *MScript = nil
+	js.names = s.jus.tempNames()
 	lst := js.GetJUIScriptData()
 	//for k, v := range lst {
 	//	fmt.Println(k, v.Domain, ">>", v.Value)
@@ -104,7 +113,11 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 					level--
 				}
 				if level == 0 {
-					tl = append(tl, &Tag{Value: s.initClass(f.Value, tjs.ToECSMAScript5()), TagType: 1})
+					tjs.names = s.jus.tempNames()
+					data, index := tagsSource(tjs.GetJUIScriptData())
+					ct := &Tag{Value: s.initClass(f.Value, data, index), TagType: 1, Pos: f.Pos}
+					s.classMarks[ct] = s.marks
+					tl = append(tl, ct)
 					tjs = nil
 					break
 				}
@@ -211,10 +224,13 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 					}
 					newString.WriteString(t.Value)
 				}
-				tl = append(tl, &Tag{Value: newString.String(), TagType: 0})
+				tl = append(tl, &Tag{Value: newString.String(), TagType: 0, Pos: t.Pos})
 			} else if t.Domain == "" {
 				if s.jus != nil {
 					hObj = s.jus.GetDefine(t.Value)
+					if len(t.Value) > 1 && t.Value[0] == '$' && Index(t.Value[1:], "$") == -1 && s.jus.idMap[t.Value[1:]] == nil {
+						s.jus.lintAt(s.position(t.Pos), s.file, "%s isn't defined.", t.Value)
+					}
 				}
 
 				if hObj != nil {
@@ -247,6 +263,9 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 			}
 			if s.jus != nil {
 				hObj = s.jus.GetDefine(param.Value)
+				if hObj == nil {
+					s.jus.lintAt(s.position(param.Pos), s.file, "#%s isn't defined.", param.Value)
+				}
 			}
 
 			if hObj != nil {
@@ -290,6 +309,12 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 			}
 			s.hMap[lst[point].Value] = &Attr{tmp.String(), ""}
 			s.jus.PushImportScript(&Attr{tmp.String(), ""})
+			if s.jus.linter() != nil && Index(tmp.String(), "/") == -1 { //外部脚本不检查
+				if s.imports == nil {
+					s.imports = make(map[string]Position, 4)
+				}
+				s.imports[lst[point].Value] = s.position(t.Pos)
+			}
 			continue
 		}
 
@@ -413,6 +438,7 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 		p++
 		if t.Domain == "" && t.TagType == 0 && !t.IsAttr {
 			if s.hMap[t.Value] != nil {
+				delete(s.imports, t.Value)
 				tlt = append(tlt, &Tag{Value: "__WINDOW__[__APPDOMAIN__]['" + s.hMap[t.Value].Name + "']", TagType: 0})
 				continue
 			}
@@ -572,12 +598,20 @@ func (s *HTMLScript) initScriptFrom(js *MScript, _this_ string, _pri_ string) st
 	tl = appendArray(tl, tlt)
 	tlt = tlt[0:0]
 
-	out.WriteString(js.ToStringFrom(tl))
+	if s.jus != nil && s.jus.GetRoot().minify {
+		if s.mini == nil {
+			s.mini = newMinifier()
+		}
+		tl = s.mini.Tags(tl, s.classMarks)
+	}
+	code := writeTags(tl, s.classMarks)
+	out.WriteString(code.String())
+	s.marks = code.marks
 	//处理Getter Setter
 	var pgs *GSetter = nil
 	tsb := bytes.NewBufferString("")
-	for name, value := range s.gsMap {
-		pgs = value
+	for _, name := range gsKeys(s.gsMap) { //按名称输出，保证每次编译结果相同
+		pgs = s.gsMap[name]
 		tsb.WriteString("Object.defineProperty(" + _this_ + ",'" + name + "',{")
 		if pgs.Setter != nil {
 			tsb.WriteString("set:")
@@ -651,12 +685,15 @@ func (s *HTMLScript) pushGSetter(i int, tag *Tag) {
  * @return
  * @throws Exception
  */
-func (s *HTMLScript) initClass(name string, data string) string {
+func (s *HTMLScript) initClass(name string, data string, index *sourceIndex) string {
 	ms := &MScript{}
 	ms.ReadFromString(data)
+	index.remap(ms.lst)
 	if s.isScript {
-
-		return "function " + name + "(__VALUE__){var __inthis__ = this,__inpri__ = {};" + s.initScriptFrom(ms, "__inthis__", "__inpri__") + "\r\n" +
+		prefix := "function " + name + "(__VALUE__){var __inthis__ = this,__inpri__ = {};"
+		code := s.initScriptFrom(ms, "__inthis__", "__inpri__")
+		s.marks = offsetMarks(s.marks, prefix)
+		return prefix + code + "\r\n" +
 			"var __init__ = this.init || __inpri__.init;" +
 			"if(__init__){" +
 			"__init__.apply(this,__VALUE__);" +
@@ -664,7 +701,10 @@ func (s *HTMLScript) initClass(name string, data string) string {
 			"}"
 	}
 
-	return "function " + name + "(){var __inthis__ = this,__inpri__ = {};" + s.initScriptFrom(ms, "__inthis__", "__inpri__") + "\r\n" +
+	prefix := "function " + name + "(){var __inthis__ = this,__inpri__ = {};"
+	code := s.initScriptFrom(ms, "__inthis__", "__inpri__")
+	s.marks = offsetMarks(s.marks, prefix)
+	return prefix + code + "\r\n" +
 		"var __init__ = this.init || __inpri__.init;" +
 		"if(__init__){" +
 		"__init__.apply(this,arguments);" +
@@ -690,7 +730,8 @@ func (s *HTMLScript) ReadFromString(script string) string {
 	} else {
 		msPath = "/batch/m.ms"
 	}
-	templ, err := GetCode(s.jus.SYSTEM_PATH + msPath)
+	s.jus.dependFile(s.jus.SYSTEM_PATH + msPath)
+	templ, err := s.jus.getCode(s.jus.SYSTEM_PATH + msPath)
 	tmp := templ
 	if err != nil {
 		return ""
@@ -707,9 +748,14 @@ func (s *HTMLScript) ReadFromString(script string) string {
 
 	s.mjs = &MScript{}
 	s.mjs.ReadFromString(script)
+	s.index.remapDiagnostics(s.mjs.Diagnostics())
+	s.jus.Diagnostics().Merge(s.mjs.Diagnostics(), s.file)
+	prefix := Substring(templ, 0, Index(templ, "{@jscode}")) + "var context = {value:\"" + Escape(s.innerValue) + "\"}\r\n"
 	templ = strings.Replace(templ, "{@jscode}", "var context = {value:\""+Escape(s.innerValue)+"\"}\r\n"+s.initScript(s.mjs), -1)
+	templ = s.jus.attachSourceMap(s.jus.className, templ, offsetMarks(s.marks, prefix), s.index)
 
 	s.jus.ToFormatLine("M", s.jus.className, templ, out)
+	s.lintImports()
 	//加入执行列表
 	s.jus.AddRun(&RunElem{Type: "S", Name: s.jus.domain, Value: s.jus.className})
 
@@ -737,6 +783,8 @@ func (s *HTMLScript) FormatString(script string) string {
 	}
 	s.mjs = &MScript{}
 	s.mjs.ReadFromString(script)
+	s.index.remapDiagnostics(s.mjs.Diagnostics())
+	s.jus.Diagnostics().Merge(s.mjs.Diagnostics(), s.file)
 	return s.initScript(s.mjs)
 }
 
@@ -750,6 +798,7 @@ func (s *HTMLScript) loadClass(path string) string {
 		if s.hMap[className] == nil {
 			tmpName = ""
 		} else {
+			delete(s.imports, className)
 			tmpName = s.hMap[className].Name
 		}
 	} else {
@@ -768,3 +817,28 @@ func (s *HTMLScript) loadClass(path string) string {
 func (s *HTMLScript) includeJs(path string) string {
 	return ""
 }
+
+/**
+ * 标签位置换算为源码位置，内部class的标签已经换算过
+ */
+func (s *HTMLScript) position(pos Position) Position {
+	if pos.File != "" {
+		return pos
+	}
+	return s.index.resolve(pos)
+}
+
+/**
+ * 检查时报告没有使用的import
+ */
+func (s *HTMLScript) lintImports() {
+	names := make([]string, 0, len(s.imports))
+	for k := range s.imports {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		s.jus.lintAt(s.imports[k], s.file, "import %s isn't used.", s.hMap[k].Name)
+	}
+	s.imports = nil
+}
@@ -3,10 +3,10 @@
 package util
 
 import (
-	"fmt"
-	. "jus"
-	. "jus/str"
-	. "jus/tool"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/tool"
+	"sort"
 	"strings"
 )
 
@@ -21,6 +21,18 @@ type GSetter struct {
 	Getter *Tag
 }
 
+/**
+ * 按名称排序的属性列表
+ */
+func gsKeys(m map[string]*GSetter) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 //--------------------------------Script----------------------------------------
 type Script struct {
 	jus          *JUS
@@ -34,6 +46,11 @@ type Script struct {
 	mjs          *MScript
 	className    string
 	isScript     bool
+	file         string              //源文件路径，用于诊断信息
+	index        *sourceIndex        //脚本代码到源码的位置索引，nil时不生成源码映射
+	marks        []codeMark          //最近一次initScriptFrom输出中记录的源码位置
+	classMarks   map[*Tag][]codeMark //内部class输出中记录的源码位置
+	mini         *minifier           //发布压缩时私有成员的短名称，内部class共用
 }
 
 func (s *Script) CreateFrom(jus *JUS, root string, domain string, value *Attr, extendScript string, className string) *Script {
@@ -46,6 +63,7 @@ func (s *Script) CreateFrom(jus *JUS, root string, domain string, value *Attr, e
 	s.gsMap = make(map[string]*GSetter)
 	s.className = className
 	s.isScript = true
+	s.classMarks = make(map[*Tag][]codeMark, 2)
 	return s
 }
 
@@ -65,6 +83,7 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 	tmp := ""
 	var hObj *HTMLObject = nil
 	var tjs *MScript = nil
+	js.names = s.jus.tempNames()
 	lst := js.GetJUIScriptData()
 	tl := make([]*Tag, 0)
 	tlt := make([]*Tag, 0)
@@ -125,6 +144,8 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 		if t.IsClass {
 			f = t
 			tjs = &MScript{}
+			s.eMap = s.eMap[0:0] //每个class只继承自己声明的类
+			ext := ""
 			for p < len(lst) {
 				t = lst[p]
 				p++
@@ -136,10 +157,13 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 					isExtends = true
 					continue
 				}
-				if t.TagType == 0 {
-					s.eMap = append(s.eMap, t.Value)
+				if isExtends && (t.TagType == 0 || "." == t.Value) { //包名和类名被分成多个标签
+					ext += t.Value
 				}
 			}
+			if ext != "" {
+				s.eMap = append(s.eMap, ext)
+			}
 			isExtends = false
 			for p < len(lst) {
 				t = lst[p]
@@ -150,7 +174,11 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 					level--
 				}
 				if level == 0 {
-					tl = append(tl, &Tag{Value: s.initClass(f.Value, tjs.ToECSMAScript5()), TagType: 1})
+					tjs.names = s.jus.tempNames()
+					data, index := tagsSource(tjs.GetJUIScriptData())
+					ct := &Tag{Value: s.initClass(f.Value, data, index), TagType: 1, Pos: f.Pos}
+					s.classMarks[ct] = s.marks
+					tl = append(tl, ct)
 					tjs = nil
 					break
 				}
@@ -252,7 +280,7 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 					}
 					newString += t.Value
 				}
-				tl = append(tl, &Tag{Value: newString, TagType: 0})
+				tl = append(tl, &Tag{Value: newString, TagType: 0, Pos: t.Pos})
 			} else if t.Domain == "" {
 				if s.jus != nil {
 					hObj = s.jus.GetDefine(t.Value)
@@ -581,12 +609,20 @@ func (s *Script) initScriptFrom(js *MScript, _this_ string, _pri_ string) string
 	tl = appendArray(tl, tlt)
 	tlt = tlt[0:0]
 
-	out += js.ToStringFrom(tl)
+	if s.jus != nil && s.jus.GetRoot().minify {
+		if s.mini == nil {
+			s.mini = newMinifier()
+		}
+		tl = s.mini.Tags(tl, s.classMarks)
+	}
+	code := writeTags(tl, s.classMarks)
+	out += code.String()
+	s.marks = code.marks
 	//处理Getter Setter
 	var pgs *GSetter = nil
 	tsb := ""
-	for name, value := range s.gsMap {
-		pgs = value
+	for _, name := range gsKeys(s.gsMap) { //按名称输出，保证每次编译结果相同
+		pgs = s.gsMap[name]
 		tsb += "Object.defineProperty(" + _this_ + ",'" + name + "',{"
 		if pgs.Setter != nil {
 			tsb += "set:"
@@ -629,6 +665,10 @@ func ScriptInitD(value string, domain string) string {
 	var ch rune
 	for i := 0; i < l; i++ {
 		ch = code[i]
+		if (ch == '\\' || ch == '$') && i == l-1 { //最后一个字符原样保留
+			sb += string(ch)
+			break
+		}
 		if ch == '\\' {
 			//再读一个
 			i++
@@ -705,15 +745,20 @@ func (s *Script) pushGSetter(i int, tag *Tag) {
  * @return
  * @throws Exception
  */
-func (s *Script) initClass(name string, data string) string {
+func (s *Script) initClass(name string, data string, index *sourceIndex) string {
 	ms := &MScript{}
 	ms.ReadFromString(data)
+	index.remap(ms.lst)
 	code := ""
 	if len(s.eMap) > 0 {
 		for _, value := range s.eMap {
-			if Index(value, ".") == -1 {
+			if Index(value, ".") == -1 && s.hMap[value] != nil {
 				value = s.hMap[value].Name
 			}
+			if path := s.jus.cyclePath(value); path != nil {
+				s.jus.Diagnostics().Errorf(s.file, 0, 0, "%s", cycleMessage(path))
+				continue
+			}
 			ft := &JUS{SYSTEM_PATH: s.jus.SYSTEM_PATH, CLASS_PATH: s.jus.CLASS_PATH}
 			if ft.CreateFromParent(s.root, "", nil, strings.TrimSpace(value), s.jus) {
 				if ft.IsScript() {
@@ -728,15 +773,17 @@ func (s *Script) initClass(name string, data string) string {
 					return "\"" + Escape(tHTML.ToString()) + "\";\r\n"
 				}
 			} else {
-				fmt.Println("Load Class Path Error:", strings.TrimSpace(value))
+				s.jus.Diagnostics().Errorf(s.file, 0, 0, "Load Class Path Error: %s", strings.TrimSpace(value))
 			}
 		}
 	}
-	return "function " + name + "(__VALUE__){\r\n" +
+	prefix := "function " + name + "(__VALUE__){\r\n" +
 		code +
 		"var __inthis__ = this,__inpri__ = {};" +
-		IfStr(len(code) == 0, "", "__EXTEND__(__inthis__,__UP__);") +
-		s.initScriptFrom(ms, "__inthis__", "__inpri__") + "\r\n" +
+		IfStr(len(code) == 0, "", "__EXTEND__(__inthis__,__UP__);")
+	body := s.initScriptFrom(ms, "__inthis__", "__inpri__")
+	s.marks = offsetMarks(s.marks, prefix)
+	return prefix + body + "\r\n" +
 		"var __init__ = this.init || __inpri__.init;" +
 		"if(__init__){" +
 		"__init__.apply(this,__VALUE__);" +
@@ -757,14 +804,19 @@ func (s *Script) ReadFromString(script string) string {
 		return ""
 	}
 	out := ""
-	templ, err := GetCode(s.jus.SYSTEM_PATH + "/batch/j.ms")
+	s.jus.dependFile(s.jus.SYSTEM_PATH + "/batch/j.ms")
+	templ, err := s.jus.getCode(s.jus.SYSTEM_PATH + "/batch/j.ms")
 	if err != nil {
 		return ""
 	}
 
 	s.mjs = &MScript{}
 	s.mjs.ReadFromString(script)
+	s.index.remapDiagnostics(s.mjs.Diagnostics())
+	s.jus.Diagnostics().Merge(s.mjs.Diagnostics(), s.file)
+	prefix := "(" + Substring(templ, 0, Index(templ, "{@jscode}")) //运行时以 "(" + 代码 + ")" 执行
 	templ = strings.Replace(templ, "{@jscode}", s.initScript(s.mjs), -1)
+	marks := offsetMarks(s.marks, prefix)
 
 	out += templ
 	tmp := templ
@@ -794,7 +846,7 @@ func (s *Script) ReadFromString(script string) string {
 		}
 	}
 
-	return out
+	return s.jus.attachSourceMap(s.className, out, marks, s.index)
 }
 
 func (s *Script) loadClass(path string) string {
@@ -0,0 +1,44 @@
+// Script_test.go
+package util
+
+import "testing"
+
+func TestScriptInitD(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"$t.text(1);", "\bt.text(1);"},
+		{"$_a + $$b + $9", "\b_a + \b$b + \b9"},
+		{"price: $ 5", "price: $ 5"},
+		{"a\\$b", "a$b"},
+		{"a\\nb", "a\\nb"},
+		{".$box{color:red;}", ".\bbox{color:red;}"},
+		{"$中", "$中"},
+		{"^\\d+$", "^\\d+$"}, //以$、\结束时不越界
+		{"a\\", "a\\"},
+	}
+	for _, v := range tests {
+		if got := ScriptInitD(v.value, "\b"); got != v.want {
+			t.Errorf("ScriptInitD(%q) = %q, want %q", v.value, got, v.want)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"plain 文本", "plain 文本"},
+		{`say "hi"`, `say \"hi\"`},
+		{`a\b`, `a\\b`},
+		{"a\r\nb", `a\r\nb`},
+		{"\bid", `\bid`},
+		{"\x01", `\1`},
+		{"<script>x</script>", `<script>x<" + "/script>`},
+	}
+	for _, v := range tests {
+		if got := Escape(v.value); got != v.want {
+			t.Errorf("Escape(%q) = %q, want %q", v.value, got, v.want)
+		}
+	}
+}
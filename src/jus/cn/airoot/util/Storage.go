@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	. "jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
 	"os"
 	. "os"
 	"path/filepath"
@@ -39,7 +39,14 @@ func GetBytes(path string) ([]byte, error) {
 //--------------------------------复制文件夹--------------------------------------
 
 //遍历目录，将文件信息传入通道
-func WalkFiles(src string, dest string, unCopy string) {
+func WalkFiles(src string, dest string, unCopy ...string) {
+	skip := make([]string, 0, len(unCopy))
+	for _, v := range unCopy {
+		if v != "" {
+			b, _ := filepath.Abs(v)
+			skip = append(skip, b)
+		}
+	}
 	filepath.Walk(src,
 		func(f string, fi os.FileInfo, err error) error { //遍历目录
 			dPath := Substring(f, StringLen(src), -1)
@@ -48,8 +55,10 @@ func WalkFiles(src string, dest string, unCopy string) {
 				return nil
 			}
 			a, _ := filepath.Abs(f)
-			b, _ := filepath.Abs(unCopy)
-			if a == b {
+			if inDir(a, skip...) { //不复制的文件或目录，目录中的内容也不复制
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 			dPath = dest + "/" + dPath
@@ -93,10 +102,10 @@ func CopyFile(dstName, srcName string) (written int64, err error) {
 
 /**
  * 复制函数
- * 复制文件或文件夹
+ * 复制文件或文件夹，unCopy中的文件和目录不复制
  */
-func Copy(src string, dest string, unCopy string) {
-	WalkFiles(src, dest, unCopy)
+func Copy(src string, dest string, unCopy ...string) {
+	WalkFiles(src, dest, unCopy...)
 }
 
 /**
@@ -0,0 +1,326 @@
+// access.go
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 响应的类型，写在访问日志和统计中
+ */
+const (
+	accessCompiled = "compiled"  //编译的模块
+	accessFile     = "file"      //工程或本地目录中的文件
+	accessProxied  = "proxied"   //反向代理转发
+	accessMock     = "mock"      //模拟接口
+	accessReplay   = "replay"    //回放录制的接口
+	accessPage     = "page"      //index.doc 等内置页面
+	accessSocket   = "websocket" //开发页面的websocket连接
+)
+
+/**
+ * 访问日志文件的默认大小和保留数量
+ */
+const (
+	defaultAccessLogSize    = 10 << 20
+	defaultAccessLogBackups = 5
+)
+
+/**
+ * 记录响应状态和大小的ResponseWriter
+ * 支持Hijack和Flush，websocket和流式响应经过时不受影响
+ */
+type accessWriter struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	kind    string
+	module  string        //编译的模块
+	compile time.Duration //编译用时，使用缓存时为0
+}
+
+func (a *accessWriter) WriteHeader(code int) {
+	if a.status == 0 || a.status < 200 { //1xx之后还有最终的状态码
+		a.status = code
+	}
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *accessWriter) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(b)
+	a.bytes += int64(n)
+	return n, err
+}
+
+func (a *accessWriter) Flush() {
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (a *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := a.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("access: ResponseWriter doesn't support Hijack")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && a.status == 0 {
+		a.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (a *accessWriter) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+/**
+ * 设置响应的类型，不是经过访问日志的请求时忽略
+ */
+func markAccess(w http.ResponseWriter, kind string) {
+	if a, ok := w.(*accessWriter); ok {
+		a.kind = kind
+	}
+}
+
+/**
+ * 设置编译的模块和编译用时
+ */
+func markCompile(w http.ResponseWriter, className string, d time.Duration) {
+	if a, ok := w.(*accessWriter); ok {
+		a.kind, a.module, a.compile = accessCompiled, className, d
+	}
+}
+
+/**
+ * 访问日志，输出到控制台，设置文件后同时写入文件
+ * 文件超过大小时改名为 .1、.2 ...，最多保留 backups 个
+ */
+type accessLog struct {
+	sync.Mutex
+	path    string //日志文件，为空时只输出到控制台
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func newAccessLog() *accessLog {
+	return &accessLog{maxSize: defaultAccessLogSize, backups: defaultAccessLogBackups}
+}
+
+/**
+ * 重新设置日志文件，已打开的文件关闭
+ */
+func (l *accessLog) reset(path string, maxSize int64, backups int) {
+	l.Lock()
+	defer l.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.path, l.maxSize, l.backups = path, maxSize, backups
+}
+
+/**
+ * 日志文件和改名后的旧文件，开发服务器监视工程时排除
+ */
+func (l *accessLog) files() []string {
+	l.Lock()
+	defer l.Unlock()
+	if l.path == "" {
+		return nil
+	}
+	lst := []string{l.path}
+	for i := 1; i <= l.backups; i++ {
+		lst = append(lst, l.path+"."+strconv.Itoa(i))
+	}
+	return lst
+}
+
+/**
+ * 输出一行日志
+ */
+func (l *accessLog) write(line string) {
+	fmt.Println(line)
+	l.Lock()
+	defer l.Unlock()
+	if l.path == "" {
+		return
+	}
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			fmt.Println("access-log:", err)
+			l.path = "" //不再重试，重新设置后恢复
+			return
+		}
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line))+1 > l.maxSize {
+		if err := l.rotate(); err != nil {
+			fmt.Println("access-log:", err)
+			return
+		}
+	}
+	n, _ := l.file.WriteString(line + "\n")
+	l.size += int64(n)
+}
+
+func (l *accessLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, fi.Size()
+	return nil
+}
+
+/**
+ * 当前文件改名为 .1，原来的依次后移，超过保留数量的删除
+ */
+func (l *accessLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	os.Remove(l.path + "." + strconv.Itoa(l.backups))
+	for i := l.backups - 1; i > 0; i-- {
+		os.Rename(l.path+"."+strconv.Itoa(i), l.path+"."+strconv.Itoa(i+1))
+	}
+	if l.backups > 0 {
+		os.Rename(l.path, l.path+".1")
+	} else {
+		os.Remove(l.path)
+	}
+	return l.open()
+}
+
+/**
+ * 日志中的值，包含空格或引号时加引号
+ */
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+/**
+ * 访问日志的一行，key=value 格式
+ */
+func accessLine(a *accessWriter, req *http.Request, start time.Time, d time.Duration) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "time=%s method=%s path=%s status=%d bytes=%d duration=%s kind=%s",
+		start.Format(time.RFC3339), req.Method, logValue(req.URL.Path), a.status, a.bytes, d.Round(time.Microsecond), logValue(a.kind))
+	if a.module != "" {
+		fmt.Fprintf(sb, " module=%s compile=%s", logValue(a.module), compileTime(a.compile))
+	}
+	return sb.String()
+}
+
+/**
+ * 编译用时，使用缓存时为cached
+ */
+func compileTime(d time.Duration) string {
+	if d == 0 {
+		return "cached"
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+/**
+ * 记录访问日志和统计的处理器
+ */
+func (u *JusServer) logged(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		a := &accessWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			d := time.Since(start)
+			if a.status == 0 {
+				a.status = http.StatusOK
+			}
+			if a.kind == "" {
+				a.kind = accessPage
+			}
+			u.metrics.observe(req.Method, a.kind, a.status, a.bytes, d)
+			u.access.write(accessLine(a, req, start, d))
+		}()
+		h.ServeHTTP(a, req)
+	})
+}
+
+/**
+ * 解析文件大小，支持 K、KB、M、MB、G、GB
+ */
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSuffix(v, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %s", s)
+	}
+	return n * unit, nil
+}
+
+/**
+ * 从 .jus 中读取访问日志的设置
+ * access-log 日志文件，access-log-size 单个文件大小，access-log-backups 保留的文件数量
+ */
+func (u *JusServer) loadAccessLog() {
+	path := ""
+	if v := u.GetAttr("access-log"); len(v) > 0 {
+		path = u.localDir(v[0])
+	}
+	size := int64(defaultAccessLogSize)
+	if v := u.GetAttr("access-log-size"); len(v) > 0 {
+		if n, err := parseSize(v[0]); err == nil {
+			size = n
+		} else {
+			fmt.Println("access-log-size:", err)
+		}
+	}
+	backups := defaultAccessLogBackups
+	if v := u.GetAttr("access-log-backups"); len(v) > 0 {
+		if n, err := strconv.Atoi(v[0]); err == nil && n >= 0 {
+			backups = n
+		} else {
+			fmt.Println("access-log-backups:", v[0])
+		}
+	}
+	u.access.reset(path, size, backups)
+}
+
+/**
+ * 是否为访问日志的设置
+ */
+func isAccessAttr(name string) bool {
+	return strings.HasPrefix(name, "access-log")
+}
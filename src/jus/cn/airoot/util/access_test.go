@@ -0,0 +1,148 @@
+// access_test.go
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestAccessLog(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":            "access-log logs/access.log\r\naccess-log-size 300B\r\naccess-log-backups 2",
+		"code/index.html": "<div>index</div>",
+		"a.txt":           "file a",
+	})
+	defer os.RemoveAll(u.RootPath)
+	s := httptest.NewServer(u.handler())
+	defer s.Close()
+	go func() { //代替testServer接收连接断开的通知
+		for range u.testConnect {
+		}
+	}()
+
+	tests := []struct {
+		path string
+		code int
+		kind string
+	}{
+		{"/juis/index.js", 200, "kind=compiled module=index compile="},
+		{"/juis/index.js", 200, "kind=compiled module=index compile=cached"},
+		{"/juis/none.js", 404, "kind=compiled module=none"},
+		{"/a.txt", 200, "kind=file"},
+		{"/a.txt", 200, "kind=file"},
+		{"/a.txt", 200, "kind=file"},
+		{"/index.metrics", 200, "kind=page"},
+	}
+	for _, v := range tests {
+		resp, err := http.Get(s.URL + v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != v.code {
+			t.Errorf("%s: %d, want %d", v.path, resp.StatusCode, v.code)
+		}
+	}
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", "", s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Close()
+
+	//websocket关闭后才写日志
+	var metrics string
+	for i := 0; i < 50 && !strings.Contains(metrics, `kind="websocket"`); i++ {
+		time.Sleep(10 * time.Millisecond)
+		w := httptest.NewRecorder()
+		u.metrics.writeTo(w)
+		metrics = w.Body.String()
+	}
+	for _, want := range []string{
+		`jus_http_requests_total{method="GET",kind="compiled",status="200"} 2`,
+		`jus_http_requests_total{method="GET",kind="compiled",status="404"} 1`,
+		`jus_http_requests_total{method="GET",kind="file",status="200"} 3`,
+		`jus_http_requests_total{method="GET",kind="websocket",status="101"} 1`,
+		`jus_http_request_duration_seconds_count{kind="compiled"} 3`,
+		`jus_http_response_bytes_total{kind="file"} 18`,
+		`jus_module_compile_seconds_count{module="index"} 1`,
+		`jus_module_compile_seconds_max{module="index"} `,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics missing %q\n%s", want, metrics)
+		}
+	}
+
+	//按大小轮换，最多保留2个
+	log := filepath.Join(u.RootPath, "logs", "access.log")
+	files, _ := filepath.Glob(log + "*")
+	if len(files) != 3 {
+		t.Fatalf("log files = %v", files)
+	}
+	all := ""
+	for _, f := range []string{log + ".2", log + ".1", log} {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 300 {
+			t.Errorf("%s: %d bytes", f, len(data))
+		}
+		all += string(data)
+	}
+	lines := strings.Split(strings.TrimSpace(all), "\n")
+	if last := lines[len(lines)-1]; !strings.Contains(last, "path=/ws status=101") || !strings.Contains(last, "kind=websocket") {
+		t.Errorf("last line = %q", last)
+	}
+	for i, v := range tests[len(tests)-3:] { //前面的已经轮换删除
+		line := lines[len(lines)-4+i]
+		if !strings.Contains(line, "path="+v.path+" ") || !strings.Contains(line, v.kind) {
+			t.Errorf("line %q, want %s %s", line, v.path, v.kind)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"0": 0, "512": 512, "1K": 1 << 10, "2kb": 2 << 10, "10MB": 10 << 20, "1G": 1 << 30, "7B": 7}
+	for s, want := range tests {
+		if n, err := parseSize(s); err != nil || n != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", s, n, err, want)
+		}
+	}
+	for _, s := range []string{"", "MB", "-1", "1TB"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q) = nil error", s)
+		}
+	}
+}
+
+func TestReleaseAccessLog(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":              "access-log logs/access.log\r\naccess-log-backups 2",
+		"code/index.html":   "<div>index</div>",
+		"logs/access.log":   "GET /",
+		"logs/access.log.1": "GET /a.txt",
+		"logs/access.log.2": "GET /b.txt",
+		"logs/readme.txt":   "notes",
+	})
+	defer os.RemoveAll(u.RootPath)
+	_, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+
+	for _, v := range []string{"access.log", "access.log.1", "access.log.2"} { //日志和轮转的文件不发布
+		if Exist(filepath.Join(out, "logs", v)) {
+			t.Errorf("%s is copied to the release", v)
+		}
+	}
+	if !Exist(filepath.Join(out, "logs", "readme.txt")) {
+		t.Error("readme.txt isn't copied")
+	}
+}
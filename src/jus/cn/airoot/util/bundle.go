@@ -0,0 +1,382 @@
+// bundle.go
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * 打包结果
+ */
+type Bundle struct {
+	ClassName string            `json:"class"`            //入口模块
+	Script    string            `json:"script"`           //打包的.js文件
+	Page      string            `json:"page"`             //打包的index.html
+	Modules   []*ReleaseModule  `json:"modules"`          //打包的模块，第一个为入口模块
+	Packages  []string          `json:"packages"`         //打包的外部脚本
+	Chunks    []*Chunk          `json:"chunks,omitempty"` //拆分出的按需加载的代码块
+	Assets    map[string]string `json:"-"`                //.RES资源的发布路径到data URL
+	Bytes     int64             `json:"bytes"`            //写出的字节数，包括代码块、manifest.json和index.html
+}
+
+/**
+ * 打包结果统计，字节数为写出的文件大小，不是各模块编译结果的大小之和
+ */
+func (b *Bundle) Summary() *ReleaseSummary {
+	s := Summarize(b.Modules)
+	s.Bytes = b.Bytes
+	return s
+}
+
+/**
+ * 写出打包的文件，记录写出的字节数
+ */
+func (b *Bundle) write(file string, data []byte) error {
+	if err := ioutil.WriteFile(file, data, 0666); err != nil {
+		return err
+	}
+	b.Bytes += int64(len(data))
+	return nil
+}
+
+/**
+ * 打包发布：从入口模块开始编译依赖图中的所有模块，连同运行时和引用的脚本写成一个独立的.js文件和index.html
+ * 打包后的页面不需要JUS服务器，可以直接嵌入其他页面中使用，.RES资源以data URL内联
+ * ReleaseSplit 为true时只通过JUS.loadModule、JUS.addModule、getModule引用的模块拆分为单独的代码块，
+ * 写在chunks目录中，代码块之间共用的内容放在公共代码块中，代码块和依赖写在manifest.json中
+ * @param className	入口模块类名
+ * @param dest		输出目录
+ * @return 打包结果，入口模块编译失败时返回错误
+ */
+func (u *JusServer) BundleTo(className string, dest string) (*Bundle, error) {
+	className = strings.Replace(strings.Replace(className, "/", ".", -1), "\\", ".", -1)
+	if v := u.resolveModule(className); v != "" { //与依赖图中的类名相同
+		className = v
+	}
+	b := &Bundle{ClassName: className, Modules: make([]*ReleaseModule, 0, 4), Packages: make([]string, 0), Assets: make(map[string]string, 4)}
+	sources := newSourceCache()
+	chunks := []*Chunk{newChunk(className)}
+	owner := map[string]*Chunk{className: chunks[0]}
+	reach := make(map[string]map[*Chunk]bool, 20) //静态导入模块的代码块
+	for i := 0; i < len(chunks); i++ {
+		c := chunks[i]
+		queue := []string{c.Name}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			m, graph := u.bundleModule(name, sources)
+			b.Modules = append(b.Modules, m)
+			c.Modules = append(c.Modules, name)
+			c.modules = append(c.modules, m)
+			if m.Status != "ok" {
+				if name == className {
+					return b, fmt.Errorf("%s", m.Error)
+				}
+				continue
+			}
+			deps := make([]string, 0, len(graph))
+			for v := range graph {
+				deps = append(deps, v)
+			}
+			sort.Strings(deps) //按名称打包，保证每次结果相同
+			for _, v := range deps {
+				if reach[v] == nil {
+					reach[v] = make(map[*Chunk]bool, 2)
+				}
+				reach[v][c] = true
+				if owner[v] == nil {
+					owner[v] = c
+					queue = append(queue, v)
+				}
+			}
+			for _, v := range lazyRefs(m.data, graph) {
+				if v = u.resolveModule(v); v == "" || owner[v] != nil {
+					continue
+				}
+				if u.ReleaseSplit {
+					owner[v] = newChunk(v)
+					chunks = append(chunks, owner[v])
+				} else {
+					owner[v] = c
+					queue = append(queue, v)
+				}
+			}
+		}
+	}
+	u.inlineAssets(b)
+	if u.ReleaseSplit {
+		if common := shareChunks(chunks, reach); common != nil {
+			chunks = append(chunks, common)
+		}
+	} else {
+		chunks[0].packages = bundlePackageList(chunks[0].modules)
+	}
+
+	os.MkdirAll(dest, 0777)
+	manifest := &Manifest{Modules: map[string]string{}, Assets: map[string]string{}, Chunks: make(map[string]*Chunk, len(chunks))}
+	for _, c := range chunks[1:] {
+		data, err := u.chunkScript(c, nil)
+		if err != nil {
+			return b, err
+		}
+		c.File = "chunks/" + c.Name + ".js"
+		if u.ReleaseHash {
+			c.File = hashName(c.File, data)
+		}
+		os.MkdirAll(dest+"/chunks", 0777)
+		if err = b.write(dest+"/"+c.File, data); err != nil {
+			return b, err
+		}
+		manifest.Chunks[c.Name] = c
+		b.Chunks = append(b.Chunks, c)
+	}
+	if len(b.Chunks) > 0 {
+		if err := manifest.WriteTo(dest + "/manifest.json"); err != nil {
+			return b, err
+		}
+		if fi, err := os.Stat(dest + "/manifest.json"); err == nil {
+			b.Bytes += fi.Size()
+		}
+	}
+
+	name := className[strings.LastIndex(className, ".")+1:]
+	b.Script = filepath.ToSlash(filepath.Clean(dest + "/" + name + ".js"))
+	b.Page = filepath.ToSlash(filepath.Clean(dest + "/index.html"))
+	data, err := u.chunkScript(chunks[0], manifest.Chunks)
+	if err != nil {
+		return b, err
+	}
+	b.Packages = chunks[0].packages
+	if err = b.write(b.Script, data); err != nil {
+		return b, err
+	}
+	if err = b.write(b.Page, []byte(bundlePage(className, name+".js"))); err != nil {
+		return b, err
+	}
+	for _, c := range chunks {
+		for _, m := range c.modules {
+			if m.Status == "ok" {
+				m.Path = b.Script
+				if c.File != "" {
+					m.Path = filepath.ToSlash(filepath.Clean(dest + "/" + c.File))
+				}
+			}
+		}
+	}
+	u.precompress(dest)
+	fmt.Println("bundle:", b.Summary())
+	return b, nil
+}
+
+/**
+ * 编译打包的一个模块，不生成源码映射
+ * @return 编译结果, 编译时发现的依赖图
+ */
+func (u *JusServer) bundleModule(className string, sources *sourceCache) (*ReleaseModule, moduleGraph) {
+	m := &ReleaseModule{ClassName: className, Status: "ok"}
+	jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/", sources: sources, minify: u.ReleaseMinify}
+	data, _, diag, e := relEvt(jus, u.RootPath, className)
+	m.Diagnostics = diag
+	if e != nil {
+		m.Status = "error"
+		m.Error = e.Error()
+		return m, nil
+	}
+	m.data = data
+	m.Size = int64(len(data))
+	return m, jus.GetRoot().graph
+}
+
+/**
+ * 把模块中引用的.RES资源替换为data URL
+ */
+func (u *JusServer) inlineAssets(b *Bundle) {
+	for _, root := range []string{u.RootPath + "/code", u.SysPath + "/code"} {
+		filepath.Walk(root, func(f string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() || !strings.Contains(filepath.ToSlash(f), ".RES/") {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, f)
+			name := u.releaseName(rel)
+			if _, ok := b.Assets[name]; ok {
+				return nil
+			}
+			for _, m := range b.Modules {
+				if bytes.Contains(m.data, []byte(name)) {
+					data, _ := GetBytes(f)
+					tp := mime.TypeByExtension(filepath.Ext(f))
+					if tp == "" {
+						tp = "application/octet-stream"
+					}
+					b.Assets[name] = "data:" + tp + ";base64," + base64.StdEncoding.EncodeToString(data)
+					break
+				}
+			}
+			return nil
+		})
+	}
+	if len(b.Assets) == 0 {
+		return
+	}
+	names := make([]string, 0, len(b.Assets))
+	for k := range b.Assets {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(a, c int) bool { //长的路径先替换，避免前缀相同的路径被替换
+		return len(names[a]) > len(names[c])
+	})
+	pairs := make([]string, 0, len(names)*2)
+	for _, k := range names {
+		pairs = append(pairs, k, b.Assets[k])
+	}
+	r := strings.NewReplacer(pairs...)
+	for _, m := range b.Modules {
+		if m.data != nil {
+			m.data = rewriteLines(m.data, r)
+			m.Size = int64(len(m.data))
+		}
+	}
+}
+
+/**
+ * 模块中引用的外部脚本（I行中P开头的内容），导入的HTML模块中的也包括在内
+ */
+func bundlePackages(data string, lst []string) []string {
+	for _, l := range parseFormatLines(data) {
+		if l.cls != "I" {
+			continue
+		}
+		if strings.HasPrefix(l.value, "P") {
+			lst = append(lst, l.value[1:])
+		} else if strings.HasPrefix(l.value, "H") {
+			lst = bundlePackages(l.value[1:], lst)
+		}
+	}
+	return lst
+}
+
+/**
+ * 外部脚本的文件，先在工程目录中查找，再到系统目录中查找，互联网地址返回空
+ */
+func (u *JusServer) packageFile(url string) string {
+	if strings.Contains(url, "://") || strings.HasPrefix(url, "//") {
+		return ""
+	}
+	for _, root := range []string{u.RootPath, u.SysPath} {
+		if f := root + "/" + strings.TrimLeft(url, "/"); Exist(f) {
+			return f
+		}
+	}
+	return ""
+}
+
+/**
+ * 模块中引用的外部脚本，按出现的顺序排列
+ */
+func bundlePackageList(list []*ReleaseModule) []string {
+	lst := make([]string, 0, 4)
+	seen := make(map[string]bool, 4)
+	for _, m := range list {
+		if m.data == nil {
+			continue
+		}
+		for _, v := range bundlePackages(string(m.data), nil) {
+			if !seen[v] {
+				seen[v] = true
+				lst = append(lst, v)
+			}
+		}
+	}
+	return lst
+}
+
+/**
+ * 代码块的脚本：外部脚本，最后注册代码块中的模块
+ * 入口代码块（chunks不为nil）前面加上asjs.js、module.js，并注册拆分出的代码块
+ * @param c			代码块
+ * @param chunks	拆分出的代码块，写入入口代码块中
+ */
+func (u *JusServer) chunkScript(c *Chunk, chunks map[string]*Chunk) ([]byte, error) {
+	sb := bytes.NewBufferString("/* JUS bundle: " + c.Name + " */\n")
+	if chunks != nil {
+		for _, v := range []string{"asjs.js", "module.js"} {
+			data, err := GetBytes(u.SysPath + "/js/" + v)
+			if err != nil {
+				return nil, err
+			}
+			sb.Write(data)
+			sb.WriteString("\n;\n")
+		}
+	}
+	packages := make([]string, 0, len(c.packages))
+	for _, v := range c.packages {
+		f := u.packageFile(v)
+		if f == "" { //互联网上的脚本运行时加载
+			continue
+		}
+		data, err := GetBytes(f)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString("/* " + v + " */\n")
+		sb.Write(data)
+		sb.WriteString("\n;\n")
+		packages = append(packages, v)
+	}
+	c.packages = packages
+	modules := make(map[string]string, len(c.modules))
+	for _, m := range c.modules {
+		if m.data != nil {
+			modules[m.ClassName] = string(m.data)
+			m.data = nil
+		}
+	}
+	reg := map[string]interface{}{"modules": modules, "packages": packages}
+	if len(c.imports) > 0 {
+		reg["imports"] = c.imports
+	}
+	if len(chunks) > 0 {
+		reg["chunks"] = chunks
+	}
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	sb.WriteString("JUS.bundle(")
+	sb.Write(data)
+	sb.WriteString(");\n")
+	return sb.Bytes(), nil
+}
+
+/**
+ * 打包的示例页面，加载打包的脚本并显示入口模块
+ */
+func bundlePage(className string, script string) string {
+	return "<!DOCTYPE html>\n" +
+		"<html>\n" +
+		"  <head>\n" +
+		"\t<title>" + className + "</title>\n" +
+		"\t<meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\" />\n" +
+		"\t<script src='" + script + "'></script>\n" +
+		"\t<style type=\"text/css\">\n" +
+		"\t\tbody{\n" +
+		"\t\t\tmargin:0px;\n" +
+		"\t\t}\n" +
+		"\t</style>\n" +
+		"  </head>\n" +
+		"  <body>\n" +
+		"\t<script>\n" +
+		"\t\tJUS.loadModule(document.body,\"" + className + "\");\n" +
+		"\t</script>\n" +
+		"  </body>\n" +
+		"</html>\n"
+}
@@ -0,0 +1,157 @@
+// bundle_test.go
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/**
+ * 入口页面静态导入comp.Card和外部脚本，按需加载page.Detail、page.List
+ */
+var bundleFiles = map[string]string{
+	".jus":                    "",
+	"code/index.html":         "<div><img src=\"@res/logo.png\"/><comp.Card/>\n<script>\nimport js/lib.js;\nfunction show(){ JUS.loadModule(document.body, \"page.Detail\"); }\nfunction list(){ JUS.loadModule(document.body, \"page.List\"); }\n</script></div>",
+	"code/index.RES/logo.png": "png",
+	"code/comp/Card.html":     `<div class="card"><span>card</span></div>`,
+	"code/comp/Row.html":      `<div class="row"><span>row</span></div>`,
+	"code/page/Detail.html":   `<div><comp.Row/>detail</div>`,
+	"code/page/List.html":     `<div><comp.Row/><comp.Row/>list</div>`,
+	"js/lib.js":               "var LIB = 1;",
+}
+
+/**
+ * 代码块脚本最后注册的内容
+ */
+type bundleReg struct {
+	Modules  map[string]string `json:"modules"`
+	Packages []string          `json:"packages"`
+	Imports  map[string]string `json:"imports"`
+	Chunks   map[string]*Chunk `json:"chunks"`
+}
+
+func readBundle(t *testing.T, file string) (string, *bundleReg) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	n := strings.LastIndex(s, "JUS.bundle(")
+	if n == -1 || !strings.HasSuffix(s, ");\n") {
+		t.Fatalf("%s: no JUS.bundle call", file)
+	}
+	reg := &bundleReg{}
+	if err := json.Unmarshal([]byte(s[n+len("JUS.bundle("):len(s)-3]), reg); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range reg.Modules {
+		checkLines(t, k, []byte(v))
+	}
+	return s, reg
+}
+
+/**
+ * 目录中所有文件的字节数
+ */
+func dirBytes(t *testing.T, dir string) int64 {
+	var n int64
+	err := filepath.Walk(dir, func(f string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			n += fi.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func moduleNames(m map[string]string) []string {
+	lst := make([]string, 0, len(m))
+	for k := range m {
+		lst = append(lst, k)
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+func TestBundle(t *testing.T) {
+	u := testProject(t, bundleFiles)
+	defer os.RemoveAll(u.RootPath)
+	out, err := ioutil.TempDir("", "jusbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	b, err := u.BundleTo("index", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, reg := readBundle(t, b.Script)
+	want := []string{"comp.Card", "comp.Row", "index", "page.Detail", "page.List"} //没有拆分时按需加载的模块也打包在一起
+	if got := moduleNames(reg.Modules); !reflect.DeepEqual(got, want) {
+		t.Errorf("modules = %v, want %v", got, want)
+	}
+	if len(b.Modules) != len(want) || b.Modules[0].ClassName != "index" {
+		t.Errorf("bundle modules = %v", b.Modules)
+	}
+	if !reflect.DeepEqual(reg.Packages, []string{"js/lib.js"}) || !strings.Contains(script, "/* js/lib.js */\nvar LIB = 1;") {
+		t.Errorf("packages = %v", reg.Packages)
+	}
+	runtime, _ := ioutil.ReadFile(testSys + "/js/module.js")
+	if !strings.HasPrefix(script, "/* JUS bundle: index */\n") || !strings.Contains(script, string(runtime)) {
+		t.Error("runtime isn't bundled")
+	}
+	index := reg.Modules["index"]
+	if !strings.Contains(index, `src="data:image/png;base64,cG5n"`) || strings.Contains(index, "logo.png") {
+		t.Errorf("asset isn't inlined: %s", index)
+	}
+	if sum := b.Summary(); sum.Bytes != dirBytes(t, out) || sum.Modules != len(want) { //写出的字节数，不是模块大小之和
+		t.Errorf("summary = %s, written %d", sum, dirBytes(t, out))
+	}
+	if len(b.Chunks) != 0 || Exist(out+"/manifest.json") || Exist(out+"/chunks") {
+		t.Error("chunks without ReleaseSplit")
+	}
+	page, _ := ioutil.ReadFile(b.Page)
+	if !strings.Contains(string(page), "<script src='index.js'></script>") || !strings.Contains(string(page), `JUS.loadModule(document.body,"index");`) {
+		t.Errorf("page = %s", page)
+	}
+}
+
+func TestBundleCaseVariant(t *testing.T) {
+	//类名的大小写与文件名不同时按文件名打包，同一个模块只打包一次
+	u := testProject(t, map[string]string{
+		".jus":                     "",
+		"code/index.html":          "<div><component.vbox/><component.VBox/>\n<script>\nfunction show(){ JUS.loadModule(document.body, \"component.Vbox\"); }\n</script></div>",
+		"code/component/VBox.html": `<div class="vbox">box</div>`,
+	})
+	defer os.RemoveAll(u.RootPath)
+	out, err := ioutil.TempDir("", "jusbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+
+	for _, split := range []bool{false, true} {
+		u.ReleaseSplit = split
+		b, err := u.BundleTo("index", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, reg := readBundle(t, b.Script)
+		if got, want := moduleNames(reg.Modules), []string{"component.VBox", "index"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("split %v: modules = %v, want %v", split, got, want)
+		}
+		if len(b.Modules) != 2 || len(b.Chunks) != 0 {
+			t.Errorf("split %v: bundle modules = %v, chunks = %v", split, b.Modules, b.Chunks)
+		}
+	}
+}
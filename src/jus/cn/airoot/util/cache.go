@@ -0,0 +1,293 @@
+// cache.go
+package util
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 模块依赖图中的节点
+ */
+type moduleNode struct {
+	Files map[string]string `json:"files"` //编译时读取的文件或目录及其内容hash，不存在时为空
+	Deps  []string          `json:"deps"`  //依赖的模块类名
+}
+
+/**
+ * 模块依赖图，key为模块类名
+ */
+type moduleGraph map[string]*moduleNode
+
+/**
+ * 缓存的编译结果
+ */
+type cacheEntry struct {
+	ClassName   string        `json:"class"`
+	Scope       string        `json:"scope,omitempty"` //编译时的工程和系统类库，磁盘缓存目录被多个工程共用时区分
+	Data        []byte        `json:"data"`
+	Diagnostics []*Diagnostic `json:"diagnostics,omitempty"`
+	Graph       moduleGraph   `json:"graph"` //编译时的依赖图，包含所有被引用的模块
+}
+
+/**
+ * 文件状态，修改时间和大小都没有变化时不重新计算hash
+ */
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+/**
+ * 模块编译缓存
+ * 记录编译时读取的所有文件在读取前的内容hash，其中任何一个变化时才重新编译
+ * 缓存的单位是根模块：引用的模块按调用处的内容和@override展开在根模块中，不能单独缓存，
+ * 所以任何一个依赖的文件变化时整个根模块重新编译，没有引用此文件的根模块仍然使用缓存
+ */
+type CompileCache struct {
+	sync.Mutex
+	path    string //磁盘缓存目录，为空时只缓存在内存中
+	scope   string //工程和系统类库，只使用相同的磁盘缓存
+	entries map[string]*cacheEntry
+	stamps  map[string]*fileStamp
+}
+
+/**
+ * @param path	磁盘缓存目录，为空时只缓存在内存中
+ * @param scope	工程和系统类库，磁盘缓存目录被多个工程共用时不会互相覆盖
+ */
+func NewCompileCache(path string, scope string) *CompileCache {
+	c := &CompileCache{path: path, scope: scope, entries: make(map[string]*cacheEntry, 10), stamps: make(map[string]*fileStamp, 100)}
+	if path == "" {
+		return c
+	}
+	os.MkdirAll(path, 0777)
+	lst, _ := ioutil.ReadDir(path)
+	for _, f := range lst {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		data, err := GetBytes(path + "/" + f.Name())
+		if err != nil {
+			continue
+		}
+		e := &cacheEntry{}
+		if json.Unmarshal(data, e) == nil && e.ClassName != "" && e.Scope == scope {
+			c.entries[e.ClassName] = e
+		}
+	}
+	return c
+}
+
+/**
+ * 获取缓存的编译结果，依赖的文件有变化时缓存失效
+ */
+func (c *CompileCache) Get(className string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e := c.entries[className]
+	if e == nil {
+		return nil, false
+	}
+	for _, n := range e.Graph {
+		for file, hash := range n.Files {
+			if c.hash(file) != hash {
+				c.remove(className)
+				return nil, false
+			}
+		}
+	}
+	return e.Data, true
+}
+
+/**
+ * 缓存的编译结果在编译时的诊断信息，使用缓存时同样输出
+ */
+func (c *CompileCache) Diagnostics(className string) []*Diagnostic {
+	c.Lock()
+	defer c.Unlock()
+	if e := c.entries[className]; e != nil {
+		return e.Diagnostics
+	}
+	return nil
+}
+
+/**
+ * 缓存编译结果
+ * 文件的hash在编译读取之前记录，编译过程中保存的修改在下次获取时使缓存失效
+ * @param className	模块类名
+ * @param data		编译结果
+ * @param jus		编译使用的模块，从中获取依赖图，编译时cache应设置为本缓存
+ */
+func (c *CompileCache) Put(className string, data []byte, jus *JUS) {
+	c.Lock()
+	defer c.Unlock()
+	root := jus.GetRoot()
+	if root.cache != c { //编译时没有记录hash，只能按现在的内容计算
+		for _, n := range root.graph {
+			for file := range n.Files {
+				n.Files[file] = c.hash(file)
+			}
+		}
+	}
+	e := &cacheEntry{ClassName: className, Scope: c.scope, Data: data, Diagnostics: root.Diagnostics().List(), Graph: root.graph}
+	c.entries[className] = e
+	if c.path != "" {
+		if b, err := json.Marshal(e); err == nil {
+			ioutil.WriteFile(c.fileName(className), b, 0666)
+		}
+	}
+}
+
+/**
+ * 文件或目录变化后需要重新编译的模块
+ * @param path	变化的文件，增删文件时所在目录也视为变化
+ * @return 受影响的模块类名
+ */
+func (c *CompileCache) Affected(path string) []string {
+	c.Lock()
+	defer c.Unlock()
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	dir := filepath.Dir(path)
+	lst := make([]string, 0)
+	for name, e := range c.entries {
+		for _, n := range e.Graph {
+			if n.depends(path) || n.depends(dir) {
+				lst = append(lst, name)
+				break
+			}
+		}
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+/**
+ * 模块直接或间接依赖的模块，不包括自己
+ */
+func (c *CompileCache) Depends(className string) []string {
+	c.Lock()
+	defer c.Unlock()
+	e := c.entries[className]
+	if e == nil {
+		return nil
+	}
+	seen := map[string]bool{className: true}
+	lst := make([]string, 0)
+	stack := []string{className}
+	for len(stack) > 0 {
+		n := e.Graph[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
+		for _, v := range n.Deps {
+			if !seen[v] {
+				seen[v] = true
+				lst = append(lst, v)
+				stack = append(stack, v)
+			}
+		}
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+/**
+ * 移除模块的缓存
+ */
+func (c *CompileCache) Remove(className string) {
+	c.Lock()
+	defer c.Unlock()
+	c.remove(className)
+}
+
+func (c *CompileCache) remove(className string) {
+	delete(c.entries, className)
+	if c.path != "" {
+		os.Remove(c.fileName(className))
+	}
+}
+
+/**
+ * 清空所有缓存
+ */
+func (c *CompileCache) Clear() {
+	c.Lock()
+	defer c.Unlock()
+	for name := range c.entries {
+		c.remove(name)
+	}
+	c.stamps = make(map[string]*fileStamp, 100)
+}
+
+/**
+ * 文件内容或目录列表的hash，编译读取文件前调用
+ */
+func (c *CompileCache) fileHash(path string) string {
+	c.Lock()
+	defer c.Unlock()
+	return c.hash(path)
+}
+
+func (c *CompileCache) fileName(className string) string {
+	sum := md5.Sum([]byte(c.scope + "\n" + className))
+	return c.path + "/" + hex.EncodeToString(sum[:]) + ".json"
+}
+
+/**
+ * 文件内容或目录列表的hash，不存在时为空
+ */
+func (c *CompileCache) hash(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if path = JUSExist(path); path == "" { //模块文件名不区分大小写
+			return ""
+		}
+		if fi, err = os.Stat(path); err != nil {
+			return ""
+		}
+	}
+	s := c.stamps[path]
+	if s != nil && s.modTime.Equal(fi.ModTime()) && s.size == fi.Size() {
+		return s.hash
+	}
+	var data []byte
+	if fi.IsDir() {
+		lst, _ := ioutil.ReadDir(path)
+		names := make([]string, 0, len(lst))
+		for _, f := range lst {
+			names = append(names, f.Name())
+		}
+		data = []byte(strings.Join(names, "\n"))
+	} else if data, err = GetBytes(path); err != nil {
+		return ""
+	}
+	sum := md5.Sum(data)
+	s = &fileStamp{modTime: fi.ModTime(), size: fi.Size(), hash: hex.EncodeToString(sum[:])}
+	c.stamps[path] = s
+	return s.hash
+}
+
+/**
+ * 是否读取过此文件或目录
+ */
+func (n *moduleNode) depends(path string) bool {
+	for file := range n.Files {
+		if strings.EqualFold(file, path) {
+			return true
+		}
+	}
+	return false
+}
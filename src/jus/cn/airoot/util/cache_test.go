@@ -0,0 +1,139 @@
+// cache_test.go
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * 按开发服务器的方式编译临时工程中的模块
+ */
+func compileCached(t *testing.T, c *CompileCache, root string, className string) *JUS {
+	jus := &JUS{SYSTEM_PATH: testSys, CLASS_PATH: testSys + "/code/", cache: c}
+	if !jus.CreateFrom(root, "", nil, className) {
+		t.Fatalf("%s isn't exist", className)
+	}
+	jus.resPath = "code"
+	return jus
+}
+
+func TestCompileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "juscache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "code")
+	os.MkdirAll(root, 0755)
+	page := filepath.Join(root, "index.html")
+	save := func(data string, mtime time.Time) {
+		if err := ioutil.WriteFile(page, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(page, mtime, mtime)
+	}
+	now := time.Now()
+	save("<div>one</div>", now.Add(-time.Hour))
+
+	c := NewCompileCache("", "")
+	jus := compileCached(t, c, root, "index")
+	data := jus.ToFormatBytes()
+	c.Put("index", data, jus)
+	if b, ok := c.Get("index"); !ok || string(b) != string(data) {
+		t.Fatal("no cache hit after Put")
+	}
+
+	//编译读取文件之后、保存缓存之前修改了文件，缓存的是旧内容，下次获取时必须失效
+	jus = compileCached(t, c, root, "index")
+	data = jus.ToFormatBytes()
+	save("<div>two</div>", now)
+	c.Put("index", data, jus)
+	if _, ok := c.Get("index"); ok {
+		t.Fatal("stale output is cached as up to date")
+	}
+
+	jus = compileCached(t, c, root, "index")
+	data = jus.ToFormatBytes()
+	c.Put("index", data, jus)
+	if b, ok := c.Get("index"); !ok || string(b) != string(data) {
+		t.Fatal("no cache hit after recompile")
+	}
+}
+
+func TestCompileCacheScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "juscache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "code")
+	os.MkdirAll(root, 0755)
+	ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("<div>index</div>"), 0644)
+	cacheDir := filepath.Join(dir, "cache")
+
+	a := NewCompileCache(cacheDir, "a")
+	jus := compileCached(t, a, root, "index")
+	a.Put("index", jus.ToFormatBytes(), jus)
+
+	//同一个缓存目录，只读取相同工程的缓存
+	if _, ok := NewCompileCache(cacheDir, "a").Get("index"); !ok {
+		t.Error("disk cache of the same scope isn't loaded")
+	}
+	if _, ok := NewCompileCache(cacheDir, "b").Get("index"); ok {
+		t.Error("disk cache of another scope is used")
+	}
+}
+
+func TestCompileCacheDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "juscache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "code")
+	os.MkdirAll(root, 0755)
+	ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("<div><span>index</div>"), 0644)
+	cacheDir := filepath.Join(dir, "cache")
+
+	c := NewCompileCache(cacheDir, "a")
+	jus := compileCached(t, c, root, "index")
+	c.Put("index", jus.ToFormatBytes(), jus)
+	want := jus.Diagnostics().List()
+	if len(want) == 0 {
+		t.Fatal("no diagnostics")
+	}
+
+	//从磁盘读取的缓存也保留编译时的诊断信息
+	for _, v := range []*CompileCache{c, NewCompileCache(cacheDir, "a")} {
+		if _, ok := v.Get("index"); !ok {
+			t.Fatal("no cache hit")
+		}
+		got := v.Diagnostics("index")
+		if len(got) != len(want) || got[0].String() != want[0].String() {
+			t.Errorf("diagnostics = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReleaseCache(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":            "cache-path build/cache",
+		"code/index.html": "<div>index</div>",
+	})
+	defer os.RemoveAll(u.RootPath)
+	if _, ok, _ := u.compile("index"); !ok {
+		t.Fatal("index isn't compiled")
+	}
+	if lst, _ := ioutil.ReadDir(filepath.Join(u.RootPath, "build", "cache")); len(lst) == 0 {
+		t.Fatal("no disk cache")
+	}
+	_, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+	if Exist(filepath.Join(out, "build", "cache")) { //工程中的缓存目录不发布
+		t.Error("cache is copied to the release")
+	}
+}
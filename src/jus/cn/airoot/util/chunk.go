@@ -0,0 +1,233 @@
+// chunk.go
+package util
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/**
+ * 公共代码块的名称，多个按需加载的代码块共用的导入内容和脚本放在这里
+ */
+const commonChunkName = "__common__"
+
+/**
+ * 打包时的代码块
+ * 入口代码块和运行时写在一起，按需加载的模块（只通过JUS.loadModule、JUS.addModule、getModule引用）各自成为一个代码块
+ */
+type Chunk struct {
+	Name     string            `json:"-"`
+	File     string            `json:"file"`           //相对于发布目录的路径，入口代码块为空
+	Modules  []string          `json:"modules"`        //包含的模块类名
+	Deps     []string          `json:"deps,omitempty"` //加载前需要先加载的代码块
+	modules  []*ReleaseModule  //包含的模块编译结果
+	packages []string          //包含的外部脚本
+	imports  map[string]string //移到本代码块的公共导入，key为 类名 + " " + 内容md5
+}
+
+func newChunk(name string) *Chunk {
+	return &Chunk{Name: name, Modules: make([]string, 0, 4), modules: make([]*ReleaseModule, 0, 4), imports: make(map[string]string, 4)}
+}
+
+/**
+ * 按需加载的模块引用，参数为字符串常量时才能在编译时确定
+ */
+var lazyModule = regexp.MustCompile(`(?:JUS\.loadModule|JUS\.addModule)\s*\([^,()]*,\s*["']([\w$.]+)["']|getModule\s*\(\s*["']([\w$.]+)["']`)
+
+/**
+ * 编译结果中按需加载的模块，已经静态导入的模块不包括在内
+ * @param data		编译结果
+ * @param graph		编译时的依赖图
+ */
+func lazyRefs(data []byte, graph moduleGraph) []string {
+	lst := make([]string, 0)
+	seen := make(map[string]bool, 4)
+	for _, s := range lazyModule.FindAllSubmatch(data, -1) {
+		name := string(s[1])
+		if name == "" {
+			name = string(s[2])
+		}
+		if _, ok := graph[name]; ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		lst = append(lst, name)
+	}
+	sort.Strings(lst)
+	return lst
+}
+
+/**
+ * 查找模块，先在工程中查找，再到系统类路径中查找，文件名不区分大小写
+ * @return 按文件名修正大小写的类名，与依赖图中的类名相同，模块不存在时为空
+ */
+func (u *JusServer) resolveModule(className string) string {
+	file := strings.Replace(className, ".", "/", -1)
+	for _, root := range []string{u.RootPath + "/code/", u.SysPath + "/code/"} {
+		for _, ext := range []string{".html", ".js", ".css"} {
+			if f := JUSExist(root + file + ext); f != "" {
+				return resolvedName(className, f)
+			}
+		}
+	}
+	return ""
+}
+
+/**
+ * 导入内容的key，类名 + " " + 内容md5
+ */
+func importKey(l formatLine) string {
+	sum := md5.Sum([]byte(l.value))
+	return l.name + " " + hex.EncodeToString(sum[:])
+}
+
+/**
+ * 提取代码块之间共用的模块、导入内容和外部脚本
+ * 入口代码块用到的放在入口代码块中，只被多个按需加载的代码块用到的放在公共代码块中
+ * 共用的导入行在模块中替换为 B 开头的引用，运行时从已加载的代码块中取出原内容
+ * @param chunks	代码块列表，第一个为入口代码块
+ * @param reach		静态导入的模块到导入它的代码块
+ * @return 公共代码块，没有共用内容时为nil
+ */
+func shareChunks(chunks []*Chunk, reach map[string]map[*Chunk]bool) *Chunk {
+	entry, common := chunks[0], newChunk(commonChunkName)
+	for _, c := range chunks[1:] {
+		n := 1 //代码块的根模块不移动
+		for _, m := range c.modules[1:] {
+			if len(reach[m.ClassName]) > 1 {
+				common.Modules = append(common.Modules, m.ClassName)
+				common.modules = append(common.modules, m)
+				c.depend(common.Name)
+				continue
+			}
+			c.Modules[n], c.modules[n] = m.ClassName, m
+			n++
+		}
+		c.Modules, c.modules = c.Modules[0:n], c.modules[0:n]
+	}
+	for _, c := range chunks[1:] { //导入的模块在先遍历的代码块中，移到公共代码块后其它导入它的代码块也要依赖
+		for _, v := range common.Modules {
+			if reach[v][c] {
+				c.depend(common.Name)
+			}
+		}
+	}
+	users := make(map[string]map[*Chunk]bool, 20)
+	lines := make(map[string]string, 20)
+	pkgUsers := make(map[string]map[*Chunk]bool, 4)
+	pkgs := make([]string, 0, 4) //外部脚本按出现的顺序加载
+	for _, c := range chunks {
+		for _, m := range c.modules {
+			if m.data == nil {
+				continue
+			}
+			code := string(m.data)
+			for _, l := range parseFormatLines(code) {
+				if l.cls != "I" || strings.HasPrefix(l.value, "P") {
+					continue
+				}
+				k := importKey(l)
+				if users[k] == nil {
+					users[k] = make(map[*Chunk]bool, 2)
+					lines[k] = code[l.start:l.end]
+				}
+				users[k][c] = true
+			}
+			for _, v := range bundlePackages(code, nil) {
+				if pkgUsers[v] == nil {
+					pkgUsers[v] = make(map[*Chunk]bool, 2)
+					pkgs = append(pkgs, v)
+				}
+				pkgUsers[v][c] = true
+			}
+		}
+	}
+
+	shared := make(map[string]*Chunk, 4)
+	for k, v := range users {
+		if len(v) < 2 {
+			continue
+		}
+		if v[entry] {
+			shared[k] = entry
+		} else {
+			shared[k] = common
+		}
+		shared[k].imports[k] = lines[k]
+	}
+	for _, c := range chunks {
+		for _, m := range c.modules {
+			if m.data != nil {
+				m.data = shareImports(m.data, shared, c)
+				m.Size = int64(len(m.data))
+			}
+		}
+	}
+
+	for _, v := range pkgs {
+		switch c := pkgUsers[v]; {
+		case c[entry]:
+			entry.packages = append(entry.packages, v)
+		case len(c) > 1:
+			common.packages = append(common.packages, v)
+			for o := range c {
+				o.depend(common.Name)
+			}
+		default:
+			for o := range c {
+				o.packages = append(o.packages, v)
+			}
+		}
+	}
+	if len(common.modules) == 0 && len(common.imports) == 0 && len(common.packages) == 0 {
+		return nil
+	}
+	return common
+}
+
+/**
+ * 把共用的导入行替换为引用
+ * @param shared	共用导入的key到所在的代码块
+ * @param c			模块所在的代码块，引用公共代码块时记录依赖
+ */
+func shareImports(data []byte, shared map[string]*Chunk, c *Chunk) []byte {
+	code := string(data)
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	p := 0
+	for _, l := range parseFormatLines(code) {
+		if l.cls != "I" || strings.HasPrefix(l.value, "P") {
+			continue
+		}
+		k := importKey(l)
+		o := shared[k]
+		if o == nil {
+			continue
+		}
+		if o != c && o.Name == commonChunkName {
+			c.depend(o.Name)
+		}
+		buf.WriteString(code[p:l.start])
+		value := "B" + k[len(l.name)+1:]
+		sum := md5.Sum([]byte(value))
+		writeFormatLine(l.cls, l.name, hex.EncodeToString(sum[:]), value, buf)
+		p = l.end
+	}
+	buf.WriteString(code[p:])
+	return buf.Bytes()
+}
+
+/**
+ * 记录依赖的代码块
+ */
+func (c *Chunk) depend(name string) {
+	for _, v := range c.Deps {
+		if v == name {
+			return
+		}
+	}
+	c.Deps = append(c.Deps, name)
+}
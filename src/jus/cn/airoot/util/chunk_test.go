@@ -0,0 +1,103 @@
+// chunk_test.go
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+ * 拆分打包，返回入口代码块注册的内容
+ */
+func splitProject(t *testing.T, files map[string]string) (string, *bundleReg) {
+	u := testProject(t, files)
+	defer os.RemoveAll(u.RootPath)
+	u.ReleaseSplit = true
+	out, err := ioutil.TempDir("", "jusbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := u.BundleTo("index", out)
+	if err != nil {
+		os.RemoveAll(out)
+		t.Fatal(err)
+	}
+	if b.Bytes != dirBytes(t, out) { //包括代码块和manifest.json
+		t.Errorf("bytes = %d, written %d", b.Bytes, dirBytes(t, out))
+	}
+	_, entry := readBundle(t, b.Script)
+	return out, entry
+}
+
+func TestBundleSplitDeps(t *testing.T) {
+	//comp.Row先随page.Detail打包，移到公共代码块后page.List也要依赖公共代码块
+	out, entry := splitProject(t, bundleFiles)
+	defer os.RemoveAll(out)
+	for _, name := range []string{"page.Detail", "page.List"} {
+		if c := entry.Chunks[name]; c == nil || !reflect.DeepEqual(c.Deps, []string{commonChunkName}) {
+			t.Errorf("chunk %s = %+v", name, c)
+		}
+	}
+}
+
+func TestBundleSplit(t *testing.T) {
+	files := make(map[string]string, len(bundleFiles)+1)
+	for k, v := range bundleFiles {
+		files[k] = v
+	}
+	//两个按需加载的页面都导入util.Fmt
+	script := "<script>\nimport util.Fmt;\nfunction f(){ return new Fmt().name(); }\n</script>"
+	files["code/page/Detail.html"] = "<div><comp.Row/>detail" + script + "</div>"
+	files["code/page/List.html"] = "<div><comp.Row/><comp.Row/>list" + script + "</div>"
+	files["code/util/Fmt.js"] = "public function name(){\n\treturn \"fmt\";\n}"
+	out, entry := splitProject(t, files)
+	defer os.RemoveAll(out)
+	if got := moduleNames(entry.Modules); !reflect.DeepEqual(got, []string{"comp.Card", "index"}) {
+		t.Errorf("entry modules = %v", got)
+	}
+	if !reflect.DeepEqual(entry.Packages, []string{"js/lib.js"}) {
+		t.Errorf("entry packages = %v", entry.Packages)
+	}
+	want := map[string]*Chunk{
+		commonChunkName: {File: "chunks/__common__.js", Modules: []string{"comp.Row", "util.Fmt"}},
+		"page.Detail":   {File: "chunks/page.Detail.js", Modules: []string{"page.Detail"}, Deps: []string{commonChunkName}},
+		"page.List":     {File: "chunks/page.List.js", Modules: []string{"page.List"}, Deps: []string{commonChunkName}},
+	}
+	if len(entry.Chunks) != len(want) {
+		t.Fatalf("chunks = %v", entry.Chunks)
+	}
+	for k, w := range want {
+		c := entry.Chunks[k]
+		if c == nil || c.File != w.File || !reflect.DeepEqual(c.Modules, w.Modules) || !reflect.DeepEqual(c.Deps, w.Deps) {
+			t.Errorf("chunk %s = %+v, want %+v", k, c, w)
+			continue
+		}
+		_, reg := readBundle(t, out+"/"+c.File)
+		if got := moduleNames(reg.Modules); !reflect.DeepEqual(got, w.Modules) {
+			t.Errorf("chunk %s modules = %v", k, got)
+		}
+	}
+	if m := readManifest(t, out); len(m.Chunks) != len(want) {
+		t.Errorf("manifest chunks = %v", m.Chunks)
+	}
+
+	//共用的导入内容放在公共代码块中，页面中改为B开头的引用
+	_, common := readBundle(t, out+"/chunks/__common__.js")
+	if len(common.Imports) != 1 {
+		t.Fatalf("common imports = %v", common.Imports)
+	}
+	for k, v := range common.Imports {
+		if !strings.HasPrefix(k, "util.Fmt ") || !strings.Contains(v, "fmt") {
+			t.Errorf("common import %s = %q", k, v)
+		}
+		for _, name := range []string{"page.Detail", "page.List"} {
+			_, reg := readBundle(t, out+"/chunks/"+name+".js")
+			if !strings.Contains(reg.Modules[name], " B"+k[len("util.Fmt "):]) {
+				t.Errorf("%s doesn't reference the common import: %s", name, reg.Modules[name])
+			}
+		}
+	}
+}
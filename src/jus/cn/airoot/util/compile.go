@@ -0,0 +1,78 @@
+// compile.go
+package util
+
+import (
+	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	"sort"
+)
+
+/**
+ * 编译选项
+ */
+type CompileOptions struct {
+	ResPath   string //资源路径，@res 替换为 资源路径/模块路径.RES，为空时为code，与开发服务器相同；发布时为juis
+	SourceMap string //源码映射的输出方式，为空时不输出，SourceMapInline 或 SourceMapFile
+	Minify    bool   //压缩脚本和样式
+}
+
+/**
+ * 一个模块的编译结果
+ */
+type CompileResult struct {
+	ClassName   string        `json:"class"`
+	Data        []byte        `json:"data"`                  //格式化内容，格式见 README/docment/format.md
+	Diagnostics []*Diagnostic `json:"diagnostics,omitempty"` //编译诊断信息
+	SourceMaps  []*SourceMap  `json:"-"`                     //SourceMap为SourceMapFile时需要写出的.map文件
+	Modules     []string      `json:"modules"`               //编译时用到的模块类名，包括本模块
+	Files       []string      `json:"files"`                 //编译时读取的文件和目录，任何一个变化时需要重新编译
+}
+
+/**
+ * 编译一个模块，不使用开发服务器和编译缓存
+ * @param rootPath	工程目录，模块源码在其code目录下
+ * @param sysPath	系统目录，即发布目录中的lib，读取脚本模板和系统模块
+ * @param className	模块类名，可以用/分隔
+ * @param opt		编译选项，为nil时使用默认值
+ * @return 编译结果；模块不存在或编译过程异常时返回错误；有编译错误时同时返回结果和错误，结果中的错误以O行输出
+ */
+func Compile(rootPath string, sysPath string, className string, opt *CompileOptions) (result *CompileResult, err error) {
+	if opt == nil {
+		opt = &CompileOptions{}
+	}
+	jus := &JUS{SYSTEM_PATH: sysPath, CLASS_PATH: sysPath + "/code/", sourceMap: opt.SourceMap, minify: opt.Minify}
+	defer func() { //编译过程中的异常视为编译失败
+		if e := recover(); e != nil {
+			result = nil
+			err = fmt.Errorf("%s: %v", className, e)
+		}
+	}()
+	if !jus.CreateFrom(rootPath+"/code/", "", nil, className) {
+		return nil, fmt.Errorf("%s: module isn't exist.", className)
+	}
+	jus.resPath = IfStr(opt.ResPath == "", "code", opt.ResPath)
+	result = &CompileResult{ClassName: jus.className, Data: jus.ToFormatBytes()}
+	result.Diagnostics = jus.Diagnostics().List()
+	result.SourceMaps = jus.SourceMaps()
+	files := make(map[string]bool, 10)
+	for k, n := range jus.GetRoot().graph {
+		result.Modules = append(result.Modules, k)
+		for f := range n.Files {
+			files[f] = true
+		}
+	}
+	for f := range files {
+		result.Files = append(result.Files, f)
+	}
+	sort.Strings(result.Modules)
+	sort.Strings(result.Files)
+	return result, jus.Diagnostics().Err()
+}
+
+/**
+ * 编译结果的JSON结构，见 format.Module
+ */
+func (r *CompileResult) JSON() ([]byte, error) {
+	return format.ToJSON(r.Data)
+}
@@ -0,0 +1,341 @@
+// compress.go
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * 小于此大小的内容不压缩
+ */
+const minCompressSize = 512
+
+/**
+ * 超过此大小的文件不读入内存，直接由http.FileServer处理
+ */
+const maxEncodeSize = 32 << 20
+
+/**
+ * 预压缩文件，按优先顺序排列
+ * Go标准库没有brotli编码器，.br文件由发布时的brotli命令生成，运行时只使用已有的文件
+ */
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{{"br", ".br"}, {"gzip", ".gz"}}
+
+/**
+ * 内容类型是否适合压缩
+ */
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case strings.HasPrefix(ct, "text/"), strings.HasSuffix(ct, "+json"), strings.HasSuffix(ct, "+xml"):
+		return true
+	}
+	switch ct {
+	case "application/javascript", "application/x-javascript", "application/json", "application/xml", "application/wasm", "image/svg+xml", "image/x-icon":
+		return true
+	}
+	return false
+}
+
+/**
+ * 按 Accept-Encoding 选择编码，q值相同时按offers的顺序
+ * @return 没有可接受的编码时返回空字符串
+ */
+func negotiate(accept string, offers ...string) string {
+	if accept == "" {
+		return ""
+	}
+	q := make(map[string]float64, 4)
+	for _, v := range strings.Split(accept, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		name, weight := v, 1.0
+		if n := strings.IndexByte(v, ';'); n != -1 {
+			name = strings.TrimSpace(v[0:n])
+			p := strings.TrimSpace(v[n+1:])
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					weight = f
+				}
+			}
+		}
+		q[strings.ToLower(name)] = weight
+	}
+	best, bestQ := "", 0.0
+	for _, o := range offers {
+		w, ok := q[o]
+		if !ok {
+			w = q["*"]
+		}
+		if w > bestQ {
+			best, bestQ = o, w
+		}
+	}
+	return best
+}
+
+/**
+ * 按内容生成强ETag
+ */
+func contentETag(data []byte) string {
+	h := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(h[0:16]) + `"`
+}
+
+/**
+ * If-None-Match 是否匹配，按弱比较
+ */
+func etagMatch(header string, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/**
+ * 预压缩文件，比原文件旧时不使用
+ */
+func sibling(file string, ext string, modtime time.Time) string {
+	if file == "" {
+		return ""
+	}
+	fi, err := os.Stat(file + ext)
+	if err != nil || fi.IsDir() || fi.ModTime().Before(modtime) {
+		return ""
+	}
+	return file + ext
+}
+
+/**
+ * 在Vary中加入请求头，已存在时不重复添加
+ */
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+/**
+ * 返回内容，按客户端支持的编码压缩，设置ETag，If-None-Match匹配时返回304
+ * @param name		文件名，用于确定内容类型
+ * @param modtime	修改时间，为零值时不设置Last-Modified
+ * @param data		未压缩的内容
+ * @param file		磁盘上的文件，存在 .br、.gz 预压缩文件时直接使用；编译结果为空字符串
+ */
+func serveEncoded(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, data []byte, file string) {
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		ct := mime.TypeByExtension(filepath.Ext(name))
+		if ct == "" {
+			ct = http.DetectContentType(data)
+		}
+		h.Set("Content-Type", ct)
+	}
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", "no-cache") //每次都验证ETag
+	}
+	addVary(h, "Accept-Encoding")
+
+	encoding := ""
+	if len(data) >= minCompressSize && compressible(h.Get("Content-Type")) {
+		offers := make([]string, 0, 2)
+		for _, v := range precompressed {
+			if v.encoding == "gzip" || sibling(file, v.ext, modtime) != "" { //gzip可以即时压缩
+				offers = append(offers, v.encoding)
+			}
+		}
+		encoding = negotiate(req.Header.Get("Accept-Encoding"), offers...)
+	}
+	var body []byte //预压缩文件的内容
+	for _, v := range precompressed {
+		if f := sibling(file, v.ext, modtime); v.encoding == encoding && f != "" {
+			body, _ = ioutil.ReadFile(f)
+		}
+	}
+	if body == nil && encoding != "gzip" {
+		encoding = ""
+	}
+
+	tag := contentETag(data)
+	if encoding != "" { //不同编码是不同的表示，ETag不同
+		tag = tag[0:len(tag)-1] + "-" + encoding + `"`
+		h.Set("Content-Encoding", encoding)
+	}
+	h.Set("ETag", tag)
+	if etagMatch(req.Header.Get("If-None-Match"), tag) {
+		h.Del("Content-Type")
+		h.Del("Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if encoding == "gzip" && body == nil { //没有预压缩文件时即时压缩
+		b, err := gzipBytes(data)
+		if err != nil {
+			fmt.Println("gzip:", req.Method, req.URL.String(), err)
+			h.Del("Content-Encoding")
+			h.Set("ETag", contentETag(data))
+		}
+		body = b
+	}
+	if body == nil {
+		body = data
+	}
+	http.ServeContent(w, req, name, modtime, bytes.NewReader(body))
+}
+
+/**
+ * 静态文件，支持压缩、预压缩文件和ETag
+ * 目录、不存在和过大的文件由http.FileServer处理
+ */
+type staticHandler struct {
+	dir   string
+	files http.Handler
+}
+
+/**
+ * 创建静态文件服务，用于开发服务器和发布目录的生产环境服务
+ * @param dir	根目录
+ */
+func StaticHandler(dir string) http.Handler {
+	return &staticHandler{dir: dir, files: http.FileServer(http.Dir(dir))}
+}
+
+func (s *staticHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	file := filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+	fi, err := os.Stat(file)
+	if err == nil && fi.IsDir() && strings.HasSuffix(req.URL.Path, "/") {
+		index := filepath.Join(file, "index.html")
+		if f, e := os.Stat(index); e == nil && !f.IsDir() {
+			file, fi = index, f
+		}
+	}
+	if err != nil || fi.IsDir() || fi.Size() > maxEncodeSize {
+		s.files.ServeHTTP(w, req)
+		return
+	}
+	serveFile(w, req, file, fi)
+}
+
+/**
+ * 返回磁盘上的文件
+ */
+func serveFile(w http.ResponseWriter, req *http.Request, file string, fi os.FileInfo) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>404</h1>"))
+		return
+	}
+	serveEncoded(w, req, fi.Name(), fi.ModTime(), data, file)
+}
+
+/**
+ * 为发布目录中的文本文件生成 .gz 和 .br 预压缩文件，静态服务器可以直接使用
+ * .br 需要安装 brotli 命令，没有时只生成 .gz
+ * @param dir	发布目录
+ * @return 生成的文件数量
+ */
+func Precompress(dir string) (int, error) {
+	brotli, _ := exec.LookPath("brotli")
+	if brotli == "" {
+		fmt.Println("precompress: brotli isn't installed, skip .br")
+	}
+	count := 0
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(file)
+		if fi.IsDir() || ext == ".gz" || ext == ".br" || fi.Size() < minCompressSize || !compressible(mime.TypeByExtension(ext)) {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		gz, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+		if len(gz) < len(data) { //压缩后没有变小时不生成
+			if err = ioutil.WriteFile(file+".gz", gz, 0666); err != nil {
+				return err
+			}
+			count++
+		}
+		if brotli != "" {
+			if out, err := exec.Command(brotli, "-f", "-q", "11", "-o", file+".br", file).CombinedOutput(); err != nil { //只缺少此文件的.br，继续压缩其他文件
+				fmt.Println("precompress: brotli", file+":", err, strings.TrimSpace(string(out)))
+				os.Remove(file + ".br")
+			} else if b, err := os.Stat(file + ".br"); err == nil && b.Size() >= fi.Size() {
+				os.Remove(file + ".br")
+			} else if err == nil {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+/**
+ * ReleaseCompress 为true时生成预压缩文件
+ */
+func (u *JusServer) precompress(dir string) {
+	if !u.ReleaseCompress {
+		return
+	}
+	n, err := Precompress(dir)
+	if err != nil {
+		fmt.Println("precompress:", err)
+	}
+	fmt.Println("precompress:", n, "files")
+}
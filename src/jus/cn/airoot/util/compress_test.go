@@ -0,0 +1,274 @@
+// compress_test.go
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"gzip;q=0.5, br;q=0.8", "br"},
+		{"GZIP;q=0.5, br;q=0.2", "gzip"},
+		{"*", "br"},
+		{"*;q=0, gzip", "gzip"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+	}
+	for _, v := range tests {
+		if got := negotiate(v.accept, "br", "gzip"); got != v.want {
+			t.Errorf("negotiate(%q) = %q, want %q", v.accept, got, v.want)
+		}
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	tag := `"abc"`
+	for header, want := range map[string]bool{"": false, "*": true, `"abc"`: true, `W/"abc"`: true, `"x", "abc"`: true, `"abc-gzip"`: false} {
+		if etagMatch(header, tag) != want {
+			t.Errorf("etagMatch(%q) = %v", header, !want)
+		}
+	}
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestStaticHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jusstatic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	big := strings.Repeat("var a = 1;\n", 100)
+	files := map[string]string{
+		"a.js":       big,
+		"b.css":      strings.Repeat("a{color:red}\n", 100),
+		"b.css.br":   "BR",
+		"c.txt":      "small",
+		"d.html":     strings.Repeat("<p>d</p>\n", 100),
+		"d.html.gz":  "stale",
+		"index.html": "<h1>index</h1>",
+	}
+	for k, v := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//按map写入的顺序不确定，明确设置修改时间：b.css.br比原文件新，d.html.gz比原文件旧，旧的预压缩文件不使用
+	now := time.Now()
+	for name, mtime := range map[string]time.Time{
+		"b.css":     now.Add(-2 * time.Hour),
+		"b.css.br":  now.Add(-time.Hour),
+		"d.html":    now.Add(-time.Hour),
+		"d.html.gz": now.Add(-2 * time.Hour),
+	} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := StaticHandler(dir)
+	get := func(path, accept, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/a.js", "gzip, br", "")
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "gzip" || !strings.HasSuffix(tag, `-gzip"`) || gunzip(t, w.Body.Bytes()) != big {
+		t.Fatalf("a.js gzip: %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("a.js headers: %v", w.Header())
+	}
+	if w = get("/a.js", "gzip", tag); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("a.js If-None-Match: %d %q", w.Code, w.Body.String())
+	}
+	w = get("/a.js", "", tag) //不压缩时是不同的表示
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "" || w.Body.String() != big || w.Header().Get("ETag") == tag {
+		t.Errorf("a.js identity: %d %v", w.Code, w.Header())
+	}
+
+	tests := []struct {
+		path, accept, encoding, body string
+	}{
+		{"/b.css", "gzip, br", "br", "BR"},
+		{"/b.css", "br;q=0, gzip", "gzip", ""},
+		{"/c.txt", "gzip", "", "small"},
+		{"/d.html", "gzip", "gzip", ""},
+		{"/", "gzip", "", "<h1>index</h1>"},
+	}
+	for _, v := range tests {
+		w := get(v.path, v.accept, "")
+		if w.Code != 200 || w.Header().Get("Content-Encoding") != v.encoding {
+			t.Errorf("%s %q: %d %v", v.path, v.accept, w.Code, w.Header())
+			continue
+		}
+		if v.encoding == "gzip" {
+			if s := gunzip(t, w.Body.Bytes()); s != files[strings.TrimPrefix(v.path, "/")] {
+				t.Errorf("%s: gzip body %q", v.path, s)
+			}
+		} else if w.Body.String() != v.body {
+			t.Errorf("%s: body %q, want %q", v.path, w.Body.String(), v.body)
+		}
+	}
+	if w = get("/none.js", "gzip", ""); w.Code != 404 {
+		t.Errorf("none.js: %d", w.Code)
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		vary []string
+		name string
+		want []string
+	}{
+		{nil, "Accept-Encoding", []string{"Accept-Encoding"}},
+		{[]string{"Accept"}, "Accept-Encoding", []string{"Accept", "Accept-Encoding"}},
+		{[]string{"Accept-Encoding"}, "Accept-Encoding", []string{"Accept-Encoding"}},
+		{[]string{"Origin, accept-encoding"}, "Accept-Encoding", []string{"Origin, accept-encoding"}},
+		{[]string{"*"}, "Accept", []string{"*"}},
+	}
+	for _, v := range tests {
+		h := http.Header{}
+		for _, f := range v.vary {
+			h.Add("Vary", f)
+		}
+		addVary(h, v.name)
+		if got := h.Values("Vary"); !reflect.DeepEqual(got, v.want) {
+			t.Errorf("addVary(%q, %s) = %q, want %q", v.vary, v.name, got, v.want)
+		}
+	}
+}
+
+func TestCompiledETag(t *testing.T) {
+	u := testProject(t, map[string]string{
+		"code/index.html": "<div>" + strings.Repeat("<p>index</p>", 100) + "</div>",
+	})
+	defer os.RemoveAll(u.RootPath)
+	get := func(accept, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/juis/index.js", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		req.Header.Set("If-None-Match", etag)
+		u.root(w, req)
+		return w
+	}
+	w := get("gzip", "")
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(gunzip(t, w.Body.Bytes()), "index") {
+		t.Fatalf("compiled: %d %v", w.Code, w.Header())
+	}
+	if got := w.Header().Values("Vary"); !reflect.DeepEqual(got, []string{"Accept", "Accept-Encoding"}) {
+		t.Errorf("compiled Vary = %q", got)
+	}
+	if w = get("gzip", tag); w.Code != 304 {
+		t.Errorf("compiled If-None-Match: %d", w.Code)
+	}
+	ioutil.WriteFile(filepath.Join(u.RootPath, "code", "index.html"), []byte("<div>"+strings.Repeat("<p>changed</p>", 100)+"</div>"), 0644)
+	if w = get("gzip", tag); w.Code != 200 || w.Header().Get("ETag") == tag {
+		t.Errorf("compiled after change: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestPrecompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jusprecompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "juis"), 0755)
+	big := strings.Repeat("var a = 1;\n", 100)
+	for k, v := range map[string]string{"juis/a.js": big, "b.png": strings.Repeat("\x89PNG", 200), "c.txt": "small"} {
+		ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(k)), []byte(v), 0644)
+	}
+	if _, err := Precompress(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "juis", "a.js.gz"))
+	if err != nil || gunzip(t, data) != big {
+		t.Fatalf("a.js.gz: %v", err)
+	}
+	for _, v := range []string{"b.png.gz", "c.txt.gz", "juis/a.js.gz.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(v))); err == nil {
+			t.Errorf("%s created", v)
+		}
+	}
+	if _, err := Precompress(dir); err != nil { //重复执行时覆盖
+		t.Fatal(err)
+	}
+}
+
+func TestPrecompressBrotliFailed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake brotli is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "jusprecompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "bin")
+	os.MkdirAll(bin, 0755)
+	//参数：-f -q 11 -o 输出文件 输入文件，b.js压缩失败
+	script := "#!/bin/sh\ncase \"$6\" in *b.js) echo broken >&2; printf x > \"$5\"; exit 1;; esac\nprintf BR > \"$5\"\n"
+	if err := ioutil.WriteFile(filepath.Join(bin, "brotli"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	out := filepath.Join(dir, "out")
+	os.MkdirAll(out, 0755)
+	big := strings.Repeat("var a = 1;\n", 100)
+	for _, v := range []string{"a.js", "b.js", "c.js"} {
+		ioutil.WriteFile(filepath.Join(out, v), []byte(big), 0644)
+	}
+	n, err := Precompress(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Precompress() = %d, want 5", n)
+	}
+	for _, v := range []string{"a.js.gz", "a.js.br", "b.js.gz", "c.js.gz", "c.js.br"} {
+		if _, err := os.Stat(filepath.Join(out, v)); err != nil {
+			t.Errorf("%s: %v", v, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "b.js.br")); err == nil {
+		t.Errorf("b.js.br isn't removed")
+	}
+}
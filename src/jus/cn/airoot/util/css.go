@@ -3,7 +3,7 @@ package util
 
 import (
 	"bytes"
-	. "jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
 	"strings"
 )
 
@@ -73,10 +73,22 @@ type CSS struct {
 	selecter    []*Selecter
 	jus         *JUS
 	CurrentPath string
+	diagnostics Diagnostics //解析时的诊断信息
+	minify      bool        //发布时压缩，去掉注释和空白并合并重复的规则
+}
+
+/**
+ * 解析时的诊断信息
+ */
+func (c *CSS) Diagnostics() *Diagnostics {
+	return &c.diagnostics
 }
 
 //从字符串里读CSS内容
 func (c *CSS) ReadFromString(css string) {
+	if c.minify {
+		css = stripCSSComments(css)
+	}
 	rp := 0
 	code := []rune(css)
 	position := 0
@@ -86,6 +98,7 @@ func (c *CSS) ReadFromString(css string) {
 	sel := &Selecter{index: -1}
 	isValue := false
 	lvl := 0 //中括号的数量
+	li := newLineIndex(code)
 out:
 	for position < len(code) {
 		ch = code[position]
@@ -130,7 +143,13 @@ out:
 			continue
 		}
 
+		if ch == '}' && lvl == 0 {
+			line, col := li.lineCol(position - 1)
+			c.diagnostics.Warningf("", line, col, "Unexpected '}'.")
+		}
+
 		if ch == '{' && lvl == 0 {
+			start := position - 1
 			if len(tag) > 0 {
 				sel.Push(&ClassElement{Value: string(tag), ElementType: -1})
 				tag = tag[0:0]
@@ -156,8 +175,7 @@ out:
 							rp++
 
 							if rp == len(res) {
-								ch = code[position]
-								if !c.isChar(ch) {
+								if position >= len(code) || !c.isChar(code[position]) {
 									values.WriteString(c.CurrentPath)
 									break
 								}
@@ -177,6 +195,8 @@ out:
 					continue out
 				}
 			}
+			line, col := li.lineCol(start)
+			c.diagnostics.Errorf("", line, col, "The rule isn't closed.")
 		}
 
 		tag = append(tag, ch)
@@ -276,38 +296,69 @@ func (c *CSS) Length() int {
  * 转换为字符串
  */
 func (c *CSS) ToString(tp int) string {
+	if c.minify {
+		return c.minifyString(tp)
+	}
 	sb := bytes.NewBufferString("")
-	var ce *ClassElement = nil
 	for _, s := range c.selecter {
-		for _, a := range s.Element {
-			ce = a
-			for ce != nil {
-				if c.jus == nil {
-					sb.WriteString(ce.Value + IfStr(ce.ElementType == 0, " ", ""))
-				} else {
-					if ce.Value[0] == '#' {
-						if tp == 0 { //共有属性
-							sb.WriteString("[src_id='" + ce.Value[1:] + "']")
-						} else { //私有属性
-							if c.jus.GetDefine(ce.Value[1:]) == nil {
-								sb.WriteString(ce.Value)
-							} else {
-								sb.WriteString("#" + c.jus.GetDefine(ce.Value[1:]).Name)
-							}
-						}
+		sb.WriteString(c.selecterString(s, tp))
+		sb.WriteString(s.Value)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
 
-					} else {
-						sb.WriteString(ce.Value)
+/**
+ * 压缩后的字符串，相同的规则只保留最后一条，相邻的规则内容相同时合并选择器
+ */
+func (c *CSS) minifyString(tp int) string {
+	rules := make([]cssRule, 0, len(c.selecter))
+	for _, s := range c.selecter {
+		rules = append(rules, cssRule{selecter: strings.TrimSpace(c.selecterString(s, tp)), value: minifyCSSValue(s.Value)})
+	}
+	sb := bytes.NewBufferString("")
+	for _, r := range mergeCSSRules(rules) {
+		sb.WriteString(r.selecter)
+		sb.WriteString(r.value)
+	}
+	return sb.String()
+}
+
+/**
+ * 选择器转换为字符串
+ * @param tp	0:共有属性，#id转换为src_id属性选择器 1:私有属性
+ */
+func (c *CSS) selecterString(s *Selecter, tp int) string {
+	sb := bytes.NewBufferString("")
+	var ce *ClassElement = nil
+	for _, a := range s.Element {
+		ce = a
+		for ce != nil {
+			if c.jus == nil {
+				sb.WriteString(ce.Value + IfStr(ce.ElementType == 0, " ", ""))
+			} else {
+				if ce.Value[0] == '#' {
+					if tp == 0 { //共有属性
+						sb.WriteString("[src_id='" + ce.Value[1:] + "']")
+					} else { //私有属性
+						if c.jus.GetDefine(ce.Value[1:]) == nil {
+							sb.WriteString(ce.Value)
+						} else {
+							sb.WriteString("#" + c.jus.GetDefine(ce.Value[1:]).Name)
+						}
 					}
-					sb.WriteString(IfStr(ce.ElementType == 0, " ", ""))
+
+				} else {
+					sb.WriteString(ce.Value)
 				}
-				ce = ce.Next
+				sb.WriteString(IfStr(ce.ElementType == 0, " ", ""))
 			}
-			sb.WriteString(",")
+			ce = ce.Next
 		}
+		sb.WriteString(",")
+	}
+	if sb.Len() > 0 {
 		sb.Truncate(sb.Len() - 1) //sb = Substring(sb, 0, StringLen(sb)-1)
-		sb.WriteString(s.Value)
-		sb.WriteString("\n")
 	}
 	return sb.String()
 }
@@ -0,0 +1,42 @@
+// css_test.go
+package util
+
+import "testing"
+
+func TestCSSAddDomain(t *testing.T) {
+	tests := []struct {
+		css, want string
+	}{
+		{".a{color:red;}", ".d .a{color:red;}\n"},
+		{"body{margin:0}", ".d{margin:0}\n"},
+		{".a .b,.c>span{x:1}", ".d .a .b,.d .c>span{x:1}\n"},
+		{"#box{x:1}\n$d{y:2}", ".d #box{x:1}\n$d{y:2}\n"}, //$开头的选择器已有作用域
+		{".a:hover{x:1}\n.b{y:2}", ".d .a:hover{x:1}\n.d .b{y:2}\n"},
+	}
+	for _, v := range tests {
+		c := &CSS{}
+		c.ReadFromString(v.css)
+		c.AddDomain(".d")
+		c.ReplaceSelecter("body", ".d")
+		if got := c.ToString(0); got != v.want {
+			t.Errorf("%q = %q, want %q", v.css, got, v.want)
+		}
+	}
+}
+
+func TestCSSMinify(t *testing.T) {
+	tests := []struct {
+		css, want string
+	}{
+		{".a { color : red ; }\n.b{ margin:0 }", ".a{color:red}.b{margin:0}"},
+		{".a{x:1}\n.b{x:1}", ".a,.b{x:1}"},
+		{".a{x:1}\n.b{y:2}\n.a{x:1}", ".b{y:2}.a{x:1}"},
+	}
+	for _, v := range tests {
+		c := &CSS{minify: true}
+		c.ReadFromString(v.css)
+		if got := c.ToString(0); got != v.want {
+			t.Errorf("%q = %q, want %q", v.css, got, v.want)
+		}
+	}
+}
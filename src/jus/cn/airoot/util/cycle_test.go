@@ -0,0 +1,120 @@
+// cycle_test.go
+package util
+
+import (
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	cycleRoot = "testdata/cycle/code/"
+)
+
+/**
+ * 编译测试工程中的模块，返回根模块和编译结果
+ */
+func compileCycle(t *testing.T, className string) (*JUS, []byte) {
+	jus := &JUS{SYSTEM_PATH: testSys, CLASS_PATH: testSys + "/code/"}
+	if !jus.CreateFrom(cycleRoot, "", nil, className) {
+		t.Fatalf("%s isn't exist", className)
+	}
+	jus.resPath = "code"
+	return jus, jus.ToFormatBytes()
+}
+
+func TestCycleOf(t *testing.T) {
+	chain := []string{"c.C", "b.B", "a.A"} //从当前模块到根模块
+	tests := []struct {
+		className string
+		want      []string
+	}{
+		{"a.A", []string{"a.A", "b.B", "c.C", "a.A"}},
+		{"b.B", []string{"b.B", "c.C", "b.B"}},
+		{"c.C", []string{"c.C", "c.C"}},
+		{"a/A", []string{"a.A", "b.B", "c.C", "a.A"}},
+		{" b.B ", []string{"b.B", "c.C", "b.B"}},
+		{"d.D", nil},
+	}
+	for _, v := range tests {
+		if got := cycleOf(chain, v.className); !reflect.DeepEqual(got, v.want) {
+			t.Errorf("cycleOf(%q) = %v, want %v", v.className, got, v.want)
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		className string
+		want      string
+	}{
+		{"cyc.A", "cyc.A -> cyc.B -> cyc.A"}, //A使用B的标签，B使用A的标签
+		{"cyc.B", "cyc.B -> cyc.A -> cyc.B"}, //
+		{"cyc.Self", "cyc.Self -> cyc.Self"}, //使用自己的标签
+		{"cyc.C", "cyc.C -> cyc.D -> cyc.C"}, //import 互相导入
+		{"cyc.E", "cyc.E -> cyc.F -> cyc.E"}, //E使用F的标签，F扩展E
+		{"cyc.F", "cyc.F -> cyc.E -> cyc.F"}, //
+		{"cyc.G", "cyc.G -> ext.X -> cyc.G"}, //G导入X，X的内部类 extends G
+		{"ext.X", "ext.X -> cyc.G -> ext.X"}, //
+	}
+	for _, v := range tests {
+		jus, data := compileCycle(t, v.className)
+		msg := cycleMessage(strings.Split(v.want, " -> "))
+		found := false
+		for _, d := range jus.Diagnostics().List() {
+			if d.Severity == DiagError && d.Message == msg {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: diagnostics = %v, want %q", v.className, jus.Diagnostics().List(), msg)
+		}
+		_, lines, err := format.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", v.className, err)
+		}
+		found = false
+		for _, l := range lines {
+			if l.Type == "O" && strings.HasSuffix(l.Value, msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no O line with %q", v.className, msg)
+		}
+	}
+}
+
+func TestNoCycle(t *testing.T) {
+	//同一个组件使用两次、多个模块导入同一个脚本不是循环依赖
+	//ok.Layout 中 ok.Box 嵌套在另一个 ok.Box 的内容里，内容由 ok.Box 扩展的模块展开，也不是循环依赖
+	for _, className := range []string{"ok.Page", "ok.Card", "ok.Helper", "ok.Layout"} {
+		jus, _ := compileCycle(t, className)
+		if err := jus.Diagnostics().Err(); err != nil {
+			t.Errorf("%s: %v", className, err)
+		}
+	}
+}
+
+func TestLazyNoCycle(t *testing.T) {
+	//只通过按需加载互相引用的模块不是循环依赖，各自单独编译
+	tests := []struct {
+		className string
+		lazy      string //编译结果中保留的按需加载
+	}{
+		{"lazy.A", `JUS.loadModule(document.body, "lazy.B")`},
+		{"lazy.B", `getModule("lazy.A", __APPDOMAIN__)`},
+		{"lazy.C", `JUS.addModule(document.body, "lazy.C")`}, //C使用D的标签，D按需加载C
+		{"lazy.D", `JUS.addModule(document.body, "lazy.C")`},
+	}
+	for _, v := range tests {
+		jus, data := compileCycle(t, v.className)
+		if err := jus.Diagnostics().Err(); err != nil {
+			t.Errorf("%s: %v", v.className, err)
+		}
+		if !strings.Contains(string(data), v.lazy) {
+			t.Errorf("%s: %q not found", v.className, v.lazy)
+		}
+	}
+}
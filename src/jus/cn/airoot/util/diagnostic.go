@@ -0,0 +1,156 @@
+// diagnostic.go
+package util
+
+import (
+	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 诊断信息级别
+ */
+const (
+	DiagError   = "error"
+	DiagWarning = "warning"
+)
+
+/**
+ * 编译诊断信息
+ */
+type Diagnostic struct {
+	Severity string `json:"severity"`       //error 或 warning
+	Message  string `json:"message"`        //信息内容
+	File     string `json:"file,omitempty"` //源文件路径
+	Line     int    `json:"line"`           //行号，从1开始，0表示未知
+	Col      int    `json:"col"`            //列号，从1开始，0表示未知
+}
+
+/**
+ * 转为 file:line:col: severity: message 格式
+ */
+func (d *Diagnostic) String() string {
+	sb := d.File
+	if d.Line > 0 {
+		sb += ":" + strconv.Itoa(d.Line)
+		if d.Col > 0 {
+			sb += ":" + strconv.Itoa(d.Col)
+		}
+	}
+	if sb != "" {
+		sb += ": "
+	}
+	return sb + d.Severity + ": " + d.Message
+}
+
+/**
+ * 诊断信息收集器，零值即可使用
+ */
+type Diagnostics struct {
+	list []*Diagnostic
+}
+
+/**
+ * 添加一条诊断信息，相同的信息只记录一次
+ */
+func (d *Diagnostics) Add(severity string, file string, line int, col int, message string) {
+	if file != "" {
+		file = filepath.ToSlash(filepath.Clean(file))
+	}
+	for _, v := range d.list {
+		if v.Severity == severity && v.File == file && v.Line == line && v.Col == col && v.Message == message {
+			return
+		}
+	}
+	d.list = append(d.list, &Diagnostic{Severity: severity, Message: message, File: file, Line: line, Col: col})
+}
+
+func (d *Diagnostics) Errorf(file string, line int, col int, format string, a ...interface{}) {
+	d.Add(DiagError, file, line, col, fmt.Sprintf(format, a...))
+}
+
+func (d *Diagnostics) Warningf(file string, line int, col int, format string, a ...interface{}) {
+	d.Add(DiagWarning, file, line, col, fmt.Sprintf(format, a...))
+}
+
+/**
+ * 按源码位置记录错误，位置没有记录文件时使用file
+ */
+func (d *Diagnostics) ErrorAt(pos Position, file string, format string, a ...interface{}) {
+	d.Errorf(IfStr(pos.File == "", file, pos.File), pos.Line, pos.Col, format, a...)
+}
+
+/**
+ * 按源码位置记录警告，位置没有记录文件时使用file
+ */
+func (d *Diagnostics) WarningAt(pos Position, file string, format string, a ...interface{}) {
+	d.Warningf(IfStr(pos.File == "", file, pos.File), pos.Line, pos.Col, format, a...)
+}
+
+/**
+ * 将其他收集器的信息移入本收集器，并清空来源
+ * @param src	来源收集器
+ * @param file	来源没有记录文件时使用的文件路径
+ */
+func (d *Diagnostics) Merge(src *Diagnostics, file string) {
+	if src == nil || src == d {
+		return
+	}
+	for _, v := range src.list {
+		d.Add(v.Severity, IfStr(v.File == "", file, v.File), v.Line, v.Col, v.Message)
+	}
+	src.list = nil
+}
+
+/**
+ * 按文件、行、列排序后的诊断信息
+ */
+func (d *Diagnostics) List() []*Diagnostic {
+	lst := make([]*Diagnostic, len(d.list))
+	copy(lst, d.list)
+	sort.SliceStable(lst, func(a, b int) bool {
+		if lst[a].File != lst[b].File {
+			return lst[a].File < lst[b].File
+		}
+		if lst[a].Line != lst[b].Line {
+			return lst[a].Line < lst[b].Line
+		}
+		return lst[a].Col < lst[b].Col
+	})
+	return lst
+}
+
+func (d *Diagnostics) Len() int {
+	return len(d.list)
+}
+
+/**
+ * 是否有错误级别的信息
+ */
+func (d *Diagnostics) HasError() bool {
+	for _, v := range d.list {
+		if v.Severity == DiagError {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * 有错误时返回包含所有错误信息的error，否则返回nil
+ */
+func (d *Diagnostics) Err() error {
+	lst := make([]string, 0)
+	for _, v := range d.List() {
+		if v.Severity == DiagError {
+			lst = append(lst, v.String())
+		}
+	}
+	if len(lst) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(lst, "\n"))
+}
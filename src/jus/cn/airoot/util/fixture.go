@@ -0,0 +1,277 @@
+// fixture.go
+package util
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/**
+ * 接口录制回放的模式
+ */
+const (
+	fixtureOff    = iota //直接转发
+	fixtureRecord        //转发并保存请求和响应
+	fixtureReplay        //不转发，返回保存的响应
+)
+
+/**
+ * 一次请求和响应，保存为JSON文件
+ */
+type fixture struct {
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Query    string      `json:"query,omitempty"`
+	Body     string      `json:"body,omitempty"` //请求体，不是文本时不保存
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response"`
+	Base64   bool        `json:"base64,omitempty"` //响应不是文本时按base64保存
+	Time     time.Time   `json:"time"`
+}
+
+/**
+ * 按路径转发的接口录制和回放
+ * 文件保存在 <目录>/<请求路径>/<方法>.<查询参数hash>.<请求体hash>.json
+ */
+type fixtureStore struct {
+	sync.RWMutex
+	mode      int
+	dir       string //保存目录
+	matchBody bool   //回放时是否匹配请求体
+}
+
+func newFixtureStore() *fixtureStore {
+	return &fixtureStore{}
+}
+
+/**
+ * 解析 upstream-mode 的值
+ */
+func parseFixtureMode(s string) (int, error) {
+	switch s {
+	case "", "off":
+		return fixtureOff, nil
+	case "record":
+		return fixtureRecord, nil
+	case "replay":
+		return fixtureReplay, nil
+	}
+	return fixtureOff, fmt.Errorf("upstream-mode: %s isn't record, replay or off", s)
+}
+
+func (t *fixtureStore) reset(mode int, dir string, matchBody bool) {
+	t.Lock()
+	defer t.Unlock()
+	t.mode, t.dir, t.matchBody = mode, dir, matchBody
+}
+
+func (t *fixtureStore) current() int {
+	t.RLock()
+	defer t.RUnlock()
+	return t.mode
+}
+
+/**
+ * 保存目录，开发服务器监视工程时排除
+ */
+func (t *fixtureStore) path() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.dir
+}
+
+func shortHash(data []byte) string {
+	h := sha1.Sum(data)
+	return hex.EncodeToString(h[:4])
+}
+
+/**
+ * 请求对应的目录和文件名前缀 <方法>.<查询参数hash>.
+ * 查询参数按名称排序后计算，顺序不同的请求相同
+ */
+func (t *fixtureStore) prefix(req *http.Request) (string, string) {
+	dir := filepath.Join(t.dir, filepath.FromSlash(path.Clean("/"+req.URL.Path))) //不能写到目录以外
+	return dir, req.Method + "." + shortHash([]byte(req.URL.Query().Encode())) + "."
+}
+
+/**
+ * 读取请求体，读取后放回请求中
+ */
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+/**
+ * 转发请求，并保存请求和响应
+ * WebSocket和text/event-stream的响应不保存
+ */
+func (t *fixtureStore) record(p *proxyRoute, w http.ResponseWriter, req *http.Request) {
+	body, err := readBody(req)
+	if err != nil {
+		proxyError(w, req, err)
+		return
+	}
+	t.RLock()
+	dir, prefix := t.prefix(req)
+	t.RUnlock()
+	file := filepath.Join(dir, prefix+shortHash(body)+".json")
+	f := &fixture{Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery}
+	if utf8.Valid(body) {
+		f.Body = string(body)
+	}
+	h := *p.handler
+	h.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode == http.StatusSwitchingProtocols || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			return nil
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		f.Status, f.Header, f.Time = resp.StatusCode, resp.Header.Clone(), time.Now()
+		f.Header.Del("Content-Length")
+		if utf8.Valid(data) {
+			f.Response = string(data)
+		} else {
+			f.Response, f.Base64 = base64.StdEncoding.EncodeToString(data), true
+		}
+		if err := f.save(file); err != nil {
+			fmt.Println("record:", err)
+		} else {
+			fmt.Println("record", req.Method, req.URL.RequestURI(), "-->", file)
+		}
+		return nil
+	}
+	h.ServeHTTP(w, req)
+}
+
+func (f *fixture) save(file string) error {
+	data, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+/**
+ * 查找保存的响应，不匹配请求体时返回最后保存的
+ */
+func (t *fixtureStore) find(req *http.Request) (string, error) {
+	t.RLock()
+	dir, prefix := t.prefix(req)
+	matchBody := t.matchBody
+	t.RUnlock()
+	if matchBody {
+		body, err := readBody(req)
+		if err != nil {
+			return "", err
+		}
+		file := filepath.Join(dir, prefix+shortHash(body)+".json")
+		if _, err := os.Stat(file); err != nil {
+			return "", err
+		}
+		return file, nil
+	}
+	lst, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var found os.FileInfo
+	for _, fi := range lst {
+		if !fi.IsDir() && strings.HasPrefix(fi.Name(), prefix) && strings.HasSuffix(fi.Name(), ".json") {
+			if found == nil || fi.ModTime().After(found.ModTime()) {
+				found = fi
+			}
+		}
+	}
+	if found == nil {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(dir, found.Name()), nil
+}
+
+/**
+ * 返回保存的响应，没有时返回404
+ */
+func (t *fixtureStore) replay(w http.ResponseWriter, req *http.Request) {
+	f := &fixture{}
+	file, err := t.find(req)
+	if err == nil {
+		var data []byte
+		if data, err = ioutil.ReadFile(file); err == nil {
+			err = json.Unmarshal(data, f)
+		}
+	}
+	if err != nil {
+		fmt.Println("replay:", req.Method, req.URL.RequestURI(), err)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>404</h1>"))
+		return
+	}
+	data := []byte(f.Response)
+	if f.Base64 {
+		data, _ = base64.StdEncoding.DecodeString(f.Response)
+	}
+	keys := make([]string, 0, len(f.Header))
+	for k := range f.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.Header()[k] = f.Header[k]
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(f.Status)
+	w.Write(data)
+}
+
+/**
+ * 从 .jus 中读取录制回放的设置
+ * upstream-mode record|replay|off，upstream-fixtures 保存目录，upstream-match-body true
+ */
+func (u *JusServer) loadFixtures() {
+	mode := fixtureOff
+	if v := u.GetAttr("upstream-mode"); len(v) > 0 {
+		m, err := parseFixtureMode(v[0])
+		if err != nil {
+			fmt.Println(err)
+		}
+		mode = m
+	}
+	dir := "fixtures"
+	if v := u.GetAttr("upstream-fixtures"); len(v) > 0 {
+		dir = v[0]
+	}
+	matchBody := false
+	if v := u.GetAttr("upstream-match-body"); len(v) > 0 {
+		matchBody = v[0] == "true"
+	}
+	u.fixtures.reset(mode, u.localDir(dir), matchBody)
+}
@@ -0,0 +1,83 @@
+// fixture_test.go
+package util
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixtureRecordReplay(t *testing.T) {
+	hits := 0
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits++
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("X-Upstream", req.Method)
+		w.WriteHeader(201)
+		io.WriteString(w, req.URL.RequestURI()+"|"+string(body))
+	}))
+	dir, err := ioutil.TempDir("", "jusfixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u := proxyServer(time.Second, false)
+	u.AddProxy("/api/", up.URL)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		u.hasUrl(req.URL, w, req)
+		return w
+	}
+	u.fixtures.reset(fixtureRecord, dir, false)
+	for _, v := range [][3]string{
+		{"GET", "/api/users?b=2&a=1", ""},
+		{"POST", "/api/users", `{"name":"a"}`},
+		{"GET", "/api/bin", "\xff\x00"},
+	} {
+		if w := do(v[0], v[1], v[2]); w.Code != 201 {
+			t.Fatalf("record %s %s: %d", v[0], v[1], w.Code)
+		}
+	}
+	up.Close()
+	if hits != 3 {
+		t.Fatalf("hits = %d", hits)
+	}
+
+	u.fixtures.reset(fixtureReplay, dir, false)
+	tests := []struct {
+		method, url, body string
+		code              int
+		want              string
+	}{
+		{"GET", "/api/users?a=1&b=2", "", 201, "/users?b=2&a=1|"}, //查询参数顺序不同
+		{"POST", "/api/users", `{"name":"b"}`, 201, `/users|{"name":"a"}`},
+		{"GET", "/api/bin", "", 201, "/bin|\xff\x00"},
+		{"GET", "/api/users?a=2", "", 404, "<h1>404</h1>"},
+		{"DELETE", "/api/users", "", 404, "<h1>404</h1>"},
+		{"GET", "/api/../../x", "", 404, "<h1>404</h1>"},
+	}
+	for _, v := range tests {
+		w := do(v.method, v.url, v.body)
+		if w.Code != v.code || w.Body.String() != v.want {
+			t.Errorf("replay %s %s: %d %q, want %d %q", v.method, v.url, w.Code, w.Body.String(), v.code, v.want)
+		}
+		if v.code == 201 && w.Header().Get("X-Upstream") != v.method {
+			t.Errorf("replay %s %s: header %v", v.method, v.url, w.Header())
+		}
+	}
+
+	u.fixtures.reset(fixtureReplay, dir, true)
+	if w := do("POST", "/api/users", `{"name":"b"}`); w.Code != 404 {
+		t.Errorf("match body: %d %q", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/users", `{"name":"a"}`); w.Code != 201 {
+		t.Errorf("match body: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+// golden_test.go
+package util
+
+import (
+	"bytes"
+	"flag"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "重新生成 testdata/golden 中的期望结果")
+
+const goldenRoot = "testdata/golden/"
+
+/**
+ * 编译 testdata/golden/code 中的模块，与 testdata/golden/<类名>.golden 比较
+ * 修改编译器后确认输出的变化是预期的，再用 go test -run TestGolden -update 更新期望结果
+ */
+func TestGolden(t *testing.T) {
+	for _, className := range []string{"index", "page", "comp.Card", "util.Helper"} {
+		jus := &JUS{SYSTEM_PATH: testSys, CLASS_PATH: testSys + "/code/"}
+		if !jus.CreateFrom(goldenRoot+"code/", "", nil, className) {
+			t.Fatalf("%s isn't exist", className)
+		}
+		jus.resPath = "code"
+		got := jus.ToFormatBytes()
+		if err := jus.Diagnostics().Err(); err != nil {
+			t.Errorf("%s: %v", className, err)
+		}
+
+		file := filepath.Join(goldenRoot, className+".golden")
+		if *update {
+			if err := ioutil.WriteFile(file, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("%s: %v (go test -update 生成)", className, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: %s", className, goldenDiff(got, want))
+		}
+	}
+}
+
+/**
+ * 按行比较，返回第一个不同的行
+ */
+func goldenDiff(got []byte, want []byte) string {
+	_, gl, err := format.Decode(got)
+	if err != nil {
+		return "decode: " + err.Error()
+	}
+	_, wl, err := format.Decode(want)
+	if err != nil {
+		return "decode golden: " + err.Error()
+	}
+	for i := 0; i < len(gl) || i < len(wl); i++ {
+		switch {
+		case i >= len(gl):
+			return "missing line " + wl[i].Type + " " + wl[i].Name
+		case i >= len(wl):
+			return "extra line " + gl[i].Type + " " + gl[i].Name
+		case *gl[i] != *wl[i]:
+			return "line " + gl[i].Type + " " + gl[i].Name + " differs:\n got: " + gl[i].Value + "\nwant: " + wl[i].Value
+		}
+	}
+	return "header differs"
+}
+
+func TestTempNames(t *testing.T) {
+	//默认参数的临时变量按每次编译计数，同一个模块编译两次结果相同
+	var first []byte
+	for i := 0; i < 2; i++ {
+		jus := &JUS{SYSTEM_PATH: testSys, CLASS_PATH: testSys + "/code/"}
+		if !jus.CreateFrom(goldenRoot+"code/", "", nil, "comp.Defaults") {
+			t.Fatal("comp.Defaults isn't exist")
+		}
+		jus.resPath = "code"
+		got := jus.ToFormatBytes()
+		if first == nil {
+			first = got
+			continue
+		}
+		if !bytes.Equal(got, first) {
+			t.Fatalf("second compile differs: %s", goldenDiff(got, first))
+		}
+	}
+	for _, v := range []string{"_a0", "_a1", "_a2"} { //HTML和js中的脚本共用计数器，名称不重复
+		if !bytes.Contains(first, []byte(v+"=")) {
+			t.Errorf("no %s in %s", v, first)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package util
 
 import (
 	"bytes"
-	. "jus/str"
-	. "jus/tool"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/tool"
+	"sort"
+	"strings"
 )
 
 //特殊关键字
@@ -19,6 +21,19 @@ func isKeyWord(value string) bool {
 	return false
 }
 
+//没有结束标签的元素
+var voidElements = [...]string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr"}
+
+//判断是不是无结束标签的元素
+func isVoidElement(value string) bool {
+	for _, v := range voidElements {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 type StringBuffer []rune
 
 //返回此对象的String
@@ -39,6 +54,9 @@ type HTML struct {
 	tagList []string          //内部属性列表，方便排序
 	tagType int               //HTML结束类型
 	list    []*HTML           //内部的HTML列表
+	pos     Position          //源码位置
+
+	diagnostics Diagnostics //解析时的诊断信息，只记录在读取的根节点上
 }
 
 /**
@@ -71,7 +89,7 @@ func (p *HTML) init() {
 			continue
 		}
 
-		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\t' {
+		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
 			if len(tmp) > 0 {
 				lst = append(lst, &Ch{string(tmp), 0})
 				tmp = tmp[0:0]
@@ -241,6 +259,10 @@ func (h *HTML) read(code []rune, index int) (*HTML, int) {
 	if index != -1 {
 		position = index
 	}
+	li := newLineIndex(code)
+	start := 0 //当前节点的开始位置
+	line, col := 0, 0
+	unpaired := false //标签配对是否已无法判断
 	sb := StringBuffer{}
 	var ch rune
 	var tag *HTML
@@ -255,12 +277,15 @@ m:
 		ch = code[position]
 		position++
 		if ch == '<' {
+			start = position - 1
+			line, col = li.lineCol(start)
 			//tagName
 			for position < len(code) {
 				ch = code[position]
 				position++
 				if ch == '(' || ch == '{' || ch == ' ' || ch == '!' || ch == '>' || (ch == '/' && code[position-2] != '<') {
 					if ch == '!' {
+						isNote := position+1 < len(code) && code[position] == '-' && code[position+1] == '-'
 						k := 0
 						sb = sb[0:0]
 						keys := []rune("-->")
@@ -272,7 +297,7 @@ m:
 								k++
 								if k == len(keys) {
 									sb = sb[:(len(sb) - k + 2)]
-									parent.list = append(parent.list, &HTML{tag: "!", value: sb.toString(), parent: parent, tagType: 0, tagData: make(map[string]string, 20)})
+									parent.list = append(parent.list, &HTML{tag: "!", value: sb.toString(), parent: parent, tagType: 0, tagData: make(map[string]string, 20), pos: li.span(start, position)})
 									sb = sb[0:0] //清除
 									tagName = ""
 									block--
@@ -282,6 +307,9 @@ m:
 								k = 0
 							}
 						}
+						if isNote && k != len(keys) {
+							h.diagnostics.Errorf("", line, col, "comment isn't closed.")
+						}
 						continue m
 					} else {
 						tagName = string(sb)
@@ -312,16 +340,33 @@ m:
 
 			}
 
+			if tagName == "" {
+				h.diagnostics.Errorf("", line, col, "tag name is empty.")
+				sb = sb[0:0] //清除
+				continue m
+			}
 			if tagName[0] == '/' {
-				parent = parent.parent
 				sb = sb[0:0] //清除
+				if parent == h {
+					h.diagnostics.Errorf("", line, col, "<%s> has no start tag.", tagName)
+					continue m
+				}
+				if !strings.EqualFold(tagName[1:], parent.tag) {
+					if isVoidElement(parent.tag) { //无结束标签的元素吞掉了后面的结束标签，此后的配对无法判断
+						unpaired = true
+					} else if !unpaired {
+						h.diagnostics.Warningf("", line, col, "<%s> doesn't match <%s> at %d:%d.", tagName, parent.tag, parent.pos.Line, parent.pos.Col)
+					}
+				}
+				parent.pos.End = position
+				parent = parent.parent
 				block--
 				if block == 0 && index != -1 {
 					return h, position
 				}
 			} else {
 				tagTemp = append(tagTemp, tagName)
-				tag = &HTML{tag: tagName, value: sb.toString(), parent: parent, tagType: tagType}
+				tag = &HTML{tag: tagName, value: sb.toString(), parent: parent, tagType: tagType, pos: li.span(start, position)}
 				tag.Create()
 				parent.list = append(parent.list, tag)
 				parent = tag
@@ -329,6 +374,7 @@ m:
 				block++
 				if isKeyWord(tagName) {
 					k := 0
+					inner := position //内容开始位置
 					keys := []rune("</" + tagName + ".")
 					for position < len(code) {
 						ch = code[position]
@@ -341,8 +387,9 @@ m:
 						} else {
 							if k > 1 && ch == '>' {
 								sb = sb[:(len(sb) - k - 1)]
-								parent.list = append(parent.list, &HTML{value: sb.toString(), parent: parent, tagType: -1, tagData: make(map[string]string, 20)})
+								parent.list = append(parent.list, &HTML{value: sb.toString(), parent: parent, tagType: -1, tagData: make(map[string]string, 20), pos: li.span(inner, inner+len(sb))})
 								sb = sb[0:0] //清除
+								parent.pos.End = position
 								parent = parent.parent
 								block--
 								break
@@ -350,6 +397,9 @@ m:
 							k = 0
 						}
 					}
+					if parent == tag {
+						h.diagnostics.Errorf("", line, col, "<%s> isn't closed.", tagName)
+					}
 				} else if tagType == 0 {
 					parent = parent.parent
 					block--
@@ -360,6 +410,7 @@ m:
 			}
 
 		} else { //文字
+			start = position - 1
 			sb = sb[0:0]
 			sb = append(sb, ch)
 			for position < len(code) {
@@ -371,7 +422,7 @@ m:
 				sb = append(sb, ch)
 			}
 			if len(sb) != 0 {
-				parent.list = append(parent.list, &HTML{value: sb.toString(), parent: parent, tagType: -1, tagData: make(map[string]string, 20)})
+				parent.list = append(parent.list, &HTML{value: sb.toString(), parent: parent, tagType: -1, tagData: make(map[string]string, 20), pos: li.span(start, position)})
 				sb = sb[0:0] //清除
 
 			}
@@ -387,10 +438,57 @@ m:
 	}
 
 	//变换为HTML
-
+	if index == -1 {
+		unclosed := make([]*HTML, 0)
+		for p := parent; p != nil && p != h && !unpaired; p = p.parent {
+			if isVoidElement(p.tag) {
+				unpaired = true
+			}
+			unclosed = append(unclosed, p)
+		}
+		if !unpaired {
+			for _, p := range unclosed {
+				h.diagnostics.Warningf("", p.pos.Line, p.pos.Col, "<%s> isn't closed.", p.tag)
+			}
+		}
+	}
 	return h, position
 }
 
+/**
+ * 节点在源码中的位置
+ */
+func (h *HTML) Position() Position {
+	return h.pos
+}
+
+/**
+ * 设置节点在源码中的位置
+ */
+func (h *HTML) SetPosition(pos Position) {
+	h.pos = pos
+}
+
+/**
+ * 为此节点及子节点中未记录文件的位置设置源文件
+ * @param file	源文件路径
+ */
+func (h *HTML) SetFile(file string) {
+	if h.pos.IsValid() && h.pos.File == "" {
+		h.pos.File = file
+	}
+	for _, v := range h.list {
+		v.SetFile(file)
+	}
+}
+
+/**
+ * 解析时的诊断信息
+ */
+func (h *HTML) Diagnostics() *Diagnostics {
+	return &h.diagnostics
+}
+
 //返回标签名称
 func (h *HTML) TagName() string {
 	return h.tag
@@ -547,6 +645,9 @@ func (h *HTML) RemoveChildByTagName(tagName string) {
  * @return
  */
 func (h *HTML) ReplaceWith(html *HTML) *HTML {
+	if !html.pos.IsValid() { //替换的内容没有源码位置时，沿用被替换节点的位置
+		html.pos = h.pos
+	}
 	if h.parent != nil {
 		for i, v := range h.parent.list {
 			if v == h {
@@ -635,6 +736,9 @@ func (h *HTML) CopyFrom(html *HTML) {
 			h.SetAttr(v.Name, v.Value)
 		}
 	}
+	if html.pos.IsValid() { //复制后此节点代表被复制的节点
+		h.pos = html.pos
+	}
 }
 
 /**
@@ -643,12 +747,34 @@ func (h *HTML) CopyFrom(html *HTML) {
  */
 func (h *HTML) Attrs() []*Attr {
 	arr := make([]*Attr, 0, 20)
-	for name, value := range h.tagData {
-		arr = append(arr, &Attr{Name: name, Value: value})
+	for _, name := range h.attrNames() {
+		arr = append(arr, &Attr{Name: name, Value: h.tagData[name]})
 	}
 	return arr
 }
 
+/**
+ * 属性名称列表，读取时的属性保持原顺序，之后设置的属性按名称排序，保证每次输出相同
+ */
+func (h *HTML) attrNames() []string {
+	names := make([]string, 0, len(h.tagData))
+	seen := make(map[string]bool, len(h.tagData))
+	for _, k := range h.tagList {
+		if _, ok := h.tagData[k]; ok && !seen[k] {
+			seen[k] = true
+			names = append(names, k)
+		}
+	}
+	n := len(names)
+	for k := range h.tagData {
+		if !seen[k] {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names[n:])
+	return names
+}
+
 //在指定节点追加HTML
 func (h *HTML) Append(list *HTML) {
 	if list.tag == "" {
@@ -777,8 +903,8 @@ func (h *HTML) ToString() string {
 	if h.parent != nil {
 		sb.WriteString("<")
 		sb.WriteString(h.tag)
-		for i, v := range h.tagData {
-			sb.WriteString(" " + i + "=" + "\"" + v + "\"")
+		for _, i := range h.attrNames() {
+			sb.WriteString(" " + i + "=" + "\"" + h.tagData[i] + "\"")
 		}
 		if h.tagType == 0 {
 			sb.WriteString("/>")
@@ -808,8 +934,8 @@ func (h *HTML) ToStringBytes() []byte {
 	if h.parent != nil {
 		sb.WriteString("<")
 		sb.WriteString(h.tag)
-		for i, v := range h.tagData {
-			sb.WriteString(" " + i + "=" + "\"" + v + "\"")
+		for _, i := range h.attrNames() {
+			sb.WriteString(" " + i + "=" + "\"" + h.tagData[i] + "\"")
 		}
 		if h.tagType == 0 {
 			sb.WriteString("/>")
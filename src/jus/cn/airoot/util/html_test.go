@@ -0,0 +1,152 @@
+// html_test.go
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTMLToString(t *testing.T) {
+	tests := []struct {
+		html, want string
+	}{
+		{`<div id="a" class='b'>x<span>y</span></div>`, `<div id="a" class="b">x<span>y</span></div>`},
+		{`<div a=1 b='2' c="3" d></div>`, `<div a="1" b="2" c="3" d=""></div>`},
+		{`<input value="1"/>`, `<input value="1"/>`},
+		{`<comp.Card/>`, `<comp.Card/>`},
+		{`<!-- 注释 --><p>a</p>`, `<!-- 注释 --><p>a</p>`},
+		{`<script>if(a<b){}</script>`, `<script>if(a<b){}</script>`},
+		{`<style>a>b{}</style>`, `<style>a>b{}</style>`},
+		{`<a href="x">&amp;</a>text`, `<a href="x">&amp;</a>text`},
+		{`<card(1,'a') id="x"></card>`, `<card id="x"></card>`},
+		{`<div><span></div>`, `<div><span></span></div>`},
+	}
+	for _, v := range tests {
+		if got := (&HTML{}).ReadFromString(v.html).ToString(); got != v.want {
+			t.Errorf("ReadFromString(%q).ToString() = %q, want %q", v.html, got, v.want)
+		}
+	}
+}
+
+func TestHTMLTree(t *testing.T) {
+	h := (&HTML{}).ReadFromString("<div>\n  <b -red id=x>t</b>\n  <card(1,'a') id=\"c\"></card>\n</div>text")
+	if n := len(h.Child()); n != 2 {
+		t.Fatalf("len(Child()) = %d, want 2", n)
+	}
+	div, text := h.At(0), h.At(1)
+	if div.TagName() != "div" || !text.IsText() || text.ToString() != "text" {
+		t.Errorf("children = %q, %q", div.TagName(), text.ToString())
+	}
+	b := h.GetElementById("x")
+	if b == nil {
+		t.Fatal("GetElementById(x) = nil")
+	}
+	if got := b.GetAttrCmd(); !reflect.DeepEqual(got, []string{"-red"}) {
+		t.Errorf("GetAttrCmd() = %q", got)
+	}
+	if pos := b.Position(); pos.Line != 2 || pos.Col != 3 {
+		t.Errorf("Position() = %v, want 2:3", pos)
+	}
+	if got := div.Text(); got != "\n  t\n  \n" {
+		t.Errorf("Text() = %q", got)
+	}
+	if got := h.GetElementById("c").GetConstructerParameter(); got != `1 , "a"` {
+		t.Errorf("GetConstructerParameter() = %q", got)
+	}
+	if got := len(h.GetElementsByTagName("b")); got != 1 {
+		t.Errorf("len(GetElementsByTagName(b)) = %d", got)
+	}
+}
+
+func TestHTMLDiagnostics(t *testing.T) {
+	tests := []struct {
+		html     string
+		severity string
+		message  string
+		line     int
+		col      int
+	}{
+		{"<div><span></div>", DiagWarning, "</div> doesn't match <span> at 1:6.", 1, 12},
+		{"<p>a</p>\n</q>", DiagError, "</q> has no start tag.", 2, 1},
+	}
+	for _, v := range tests {
+		found := false
+		for _, d := range (&HTML{}).ReadFromString(v.html).Diagnostics().List() {
+			if d.Severity == v.severity && d.Message == v.message && d.Line == v.line && d.Col == v.col {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: no %s %q at %d:%d", v.html, v.severity, v.message, v.line, v.col)
+		}
+	}
+	if err := (&HTML{}).ReadFromString("<div><p>a</p></div>").Diagnostics().Err(); err != nil {
+		t.Errorf("unexpected %v", err)
+	}
+}
+
+func TestHTMLPosition(t *testing.T) {
+	h := (&HTML{}).ReadFromString("<div id=a>\n  <b id=b>t</b>\n\t<p id=c>\n    <i id=d></i></p>\n<span\n  id=e>中文<u id=f></u></span></div>")
+	tests := []struct {
+		id        string
+		line, col int
+	}{
+		{"a", 1, 1},
+		{"b", 2, 3},
+		{"c", 3, 2},
+		{"d", 4, 5},
+		{"e", 5, 1},
+		{"f", 6, 10},
+	}
+	for _, v := range tests {
+		n := h.GetElementById(v.id)
+		if n == nil {
+			t.Errorf("GetElementById(%s) = nil", v.id)
+			continue
+		}
+		if pos := n.Position(); pos.Line != v.line || pos.Col != v.col {
+			t.Errorf("%s: Position() = %v, want %d:%d", v.id, pos, v.line, v.col)
+		}
+	}
+}
+
+func TestHTMLPositionKept(t *testing.T) {
+	src := "<div>\n  <b id=x>t</b>\n</div>"
+	tests := []struct {
+		name      string
+		edit      func(b *HTML) *HTML
+		line, col int
+	}{
+		{"CopyFrom", func(b *HTML) *HTML {
+			n := (&HTML{}).Create()
+			n.CopyFrom(b)
+			return n
+		}, 2, 3},
+		{"CopyFrom created", func(b *HTML) *HTML {
+			b.CopyFrom((&HTML{}).Create())
+			return b
+		}, 2, 3},
+		{"ReplaceWith created", func(b *HTML) *HTML {
+			return b.ReplaceWith((&HTML{}).Create())
+		}, 2, 3},
+		{"ReplaceWith parsed", func(b *HTML) *HTML {
+			return b.ReplaceWith((&HTML{}).ReadFromString("\n\n <i id=i></i>").GetElementById("i"))
+		}, 3, 2},
+	}
+	for _, v := range tests {
+		h := (&HTML{}).ReadFromString(src)
+		n := v.edit(h.GetElementById("x"))
+		if pos := n.Position(); pos.Line != v.line || pos.Col != v.col {
+			t.Errorf("%s: Position() = %v, want %d:%d", v.name, pos, v.line, v.col)
+		}
+	}
+	h := (&HTML{}).ReadFromString(src)
+	n := h.GetElementById("x").ReplaceWith((&HTML{}).Create())
+	if got := len(h.GetElementsByTagName("b")); got != 0 {
+		t.Errorf("len(GetElementsByTagName(b)) = %d after ReplaceWith()", got)
+	}
+	h.SetFile("a.html")
+	if got := n.Position().String(); got != "a.html:2:3" {
+		t.Errorf("SetFile() = %q, want a.html:2:3", got)
+	}
+}
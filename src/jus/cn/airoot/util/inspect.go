@@ -0,0 +1,172 @@
+// inspect.go
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/tool"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 模块编译过程的记录，开发服务器的 /index.inspect?类名 显示
+ */
+type Inspect struct {
+	Class       string                `json:"class"`
+	Stages      []*InspectStage       `json:"stages"`      //ReadHTML各阶段之后的HTML
+	Packages    map[string]string     `json:"packages"`    //pkgMap，标签名到类名
+	Ids         map[string]*InspectId `json:"ids"`         //idMap，源码中的id到生成的id
+	Runs        []*RunElem            `json:"runs"`        //runList，执行顺序
+	Lines       []*format.Line        `json:"lines"`       //最终的格式化内容
+	Diagnostics []*Diagnostic         `json:"diagnostics"` //编译诊断信息
+}
+
+/**
+ * 一个编译阶段
+ */
+type InspectStage struct {
+	Name string `json:"name"` //阶段名称，即ReadHTML中调用的方法名
+	HTML string `json:"html"`
+}
+
+/**
+ * 生成的id
+ */
+type InspectId struct {
+	Id        string `json:"id"`
+	Component bool   `json:"component"` //是否为组件
+}
+
+/**
+ * 记录ReadHTML一个阶段之后的HTML，只记录被检查的根模块
+ */
+func (j *JUS) stage(name string) {
+	if j.inspect == nil {
+		return
+	}
+	j.inspect.Stages = append(j.inspect.Stages, &InspectStage{Name: name, HTML: j.html.ToString()})
+}
+
+/**
+ * 编译模块并记录每个阶段，不使用也不更新编译缓存
+ * @param className	模块类名
+ * @return 编译记录，模块不存在时返回nil
+ */
+func (u *JusServer) Inspect(className string) *Inspect {
+	in := &Inspect{Class: className, Stages: make([]*InspectStage, 0, 6)}
+	jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/", inspect: in}
+	if !jus.CreateFrom(u.RootPath+"/code/", "", nil, className) {
+		return nil
+	}
+	jus.resPath = "code"
+	b := jus.ToFormatBytes()
+	in.Packages = jus.pkgMap
+	in.Ids = make(map[string]*InspectId, len(jus.idMap))
+	for k, v := range jus.idMap {
+		in.Ids[k] = &InspectId{Id: v.Name, Component: v.HTMLObjectType == 1}
+	}
+	in.Runs = jus.runList
+	in.Diagnostics = jus.Diagnostics().List()
+	_, in.Lines, _ = format.Decode(b) //出错时返回出错前的行
+	return in
+}
+
+/**
+ * 显示模块的编译过程，?format=json 或 Accept: application/json 时输出JSON
+ */
+func (u *JusServer) inspectEvt(w http.ResponseWriter, req *http.Request) {
+	className := req.URL.RawQuery
+	if n := strings.IndexByte(className, '&'); n != -1 {
+		className = className[0:n]
+	}
+	in := u.Inspect(className)
+	if in == nil {
+		w.WriteHeader(404)
+		w.Write([]byte("<h1>404</h1>"))
+		return
+	}
+	if wantJSON(req) {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(in); err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(in.ToHTML())
+}
+
+/**
+ * 编译记录的HTML页面
+ */
+func (in *Inspect) ToHTML() []byte {
+	e := html.EscapeString
+	sb := bytes.NewBufferString("<html><head><meta charset=\"utf-8\"><title>" + e(in.Class) + "</title><style>" +
+		"body{font-family:monospace;font-size:13px;} pre{background:#f4f4f4;padding:8px;white-space:pre-wrap;word-break:break-all;}" +
+		"table{border-collapse:collapse;} td,th{border:1px solid #ccc;padding:2px 6px;text-align:left;vertical-align:top;}" +
+		"</style></head><body>")
+	sb.WriteString("<h1>" + e(in.Class) + "</h1>")
+	sb.WriteString("<p><a href=\"?" + e(in.Class) + "&format=json\">JSON</a></p>")
+
+	if len(in.Diagnostics) > 0 {
+		sb.WriteString("<h2>diagnostics</h2><pre>")
+		for _, v := range in.Diagnostics {
+			sb.WriteString(e(v.String()) + "\n")
+		}
+		sb.WriteString("</pre>")
+	}
+	if len(in.Stages) == 0 { //独立的JavaScript文件没有这些阶段
+		sb.WriteString("<p>no stages</p>")
+	}
+	for _, v := range in.Stages {
+		sb.WriteString("<h2>" + e(v.Name) + "</h2><pre>" + e(v.HTML) + "</pre>")
+	}
+
+	sb.WriteString("<h2>pkgMap</h2><table><tr><th>tag</th><th>class</th></tr>")
+	pkgs := make([]string, 0, len(in.Packages))
+	for k := range in.Packages {
+		pkgs = append(pkgs, k)
+	}
+	sort.Strings(pkgs)
+	for _, k := range pkgs {
+		sb.WriteString("<tr><td>" + e(k) + "</td><td>" + e(in.Packages[k]) + "</td></tr>")
+	}
+	sb.WriteString("</table>")
+
+	ids := make([]string, 0, len(in.Ids))
+	for k := range in.Ids {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	sb.WriteString("<h2>idMap</h2><table><tr><th>src_id</th><th>id</th><th>component</th></tr>")
+	for _, k := range ids {
+		sb.WriteString("<tr><td>" + e(k) + "</td><td>" + e(in.Ids[k].Id) + "</td><td>" + strconv.FormatBool(in.Ids[k].Component) + "</td></tr>")
+	}
+	sb.WriteString("</table>")
+
+	sb.WriteString("<h2>runList</h2><table><tr><th>#</th><th>type</th><th>name</th><th>value</th></tr>")
+	for i, v := range in.Runs {
+		sb.WriteString(fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>", i, e(v.Type), e(strconv.Quote(v.Name)), e(v.Value)))
+	}
+	sb.WriteString("</table>")
+
+	sb.WriteString("<h2>format</h2><table><tr><th>type</th><th>name</th><th>md5</th><th>value</th></tr>")
+	for _, v := range in.Lines {
+		sb.WriteString("<tr><td>" + e(v.Type) + "</td><td>" + e(strconv.Quote(v.Name)) + "</td><td>" + v.Hash + "</td><td><pre>" + e(v.Value) + "</pre></td></tr>")
+	}
+	sb.WriteString("</table></body></html>")
+	return sb.Bytes()
+}
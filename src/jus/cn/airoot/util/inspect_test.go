@@ -0,0 +1,68 @@
+// inspect_test.go
+package util
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                "",
+		"code/index.html":     `<div><span id="t">hi</span><comp.Card id="card"/></div>`,
+		"code/comp/Card.html": `<div class="card"><span id="title">card</span></div>`,
+	})
+	defer os.RemoveAll(u.RootPath)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		u.root(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	w := get("/index.inspect?index&format=json")
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("%d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	in := &Inspect{}
+	if err := json.Unmarshal(w.Body.Bytes(), in); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, v := range in.Stages {
+		names = append(names, v.Name)
+	}
+	if want := []string{"rootHTML", "importHTML", "overHTML", "packageHTML", "domainHTML", "scanHTML"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("stages = %v, want %v", names, want)
+	}
+	if !strings.Contains(in.Stages[0].HTML, `<comp.Card id="card"/>`) || !strings.Contains(in.Stages[5].HTML, `class_id="comp.Card"`) {
+		t.Errorf("stages = %+v", in.Stages)
+	}
+	if v := in.Ids["card"]; v == nil || !v.Component || !strings.HasSuffix(v.Id, "card") {
+		t.Errorf("ids[card] = %+v", v)
+	}
+	if v := in.Ids["t"]; v == nil || v.Component {
+		t.Errorf("ids[t] = %+v", v)
+	}
+	if len(in.Lines) == 0 || in.Lines[len(in.Lines)-1].Type != "H" || in.Lines[len(in.Lines)-1].Name != "index" {
+		t.Errorf("lines = %+v", in.Lines)
+	}
+
+	w = get("/index.inspect?index")
+	body := w.Body.String()
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("%d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, v := range []string{"<h2>rootHTML</h2>", "<h2>scanHTML</h2>", "&lt;comp.Card id=&#34;card&#34;/&gt;", "<h2>idMap</h2>", "<h2>runList</h2>", "<h2>format</h2>"} {
+		if !strings.Contains(body, v) {
+			t.Errorf("page doesn't contain %s", v)
+		}
+	}
+
+	if w = get("/index.inspect?none"); w.Code != 404 {
+		t.Errorf("missing module: %d", w.Code)
+	}
+}
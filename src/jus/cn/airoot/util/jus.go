@@ -7,10 +7,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
-	. "jus"
-	. "jus/str"
-	. "jus/tool"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/tool"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -67,6 +70,20 @@ type JUS struct {
 	moduleMap           map[string]*Attr //模块地图
 	runList             []*RunElem       //run列表，用于记录模块的执行顺序，非常重要的一个字段
 	IsImport            string           //是否为导入类
+	diagnostics         *Diagnostics     //编译诊断信息，只记录在根模块上
+	scriptIndex         sourceIndex      //scriptBuffer到源码的位置索引
+	sourceMap           string           //源码映射的输出方式，为空时不输出，只在根模块上设置
+	sourceMaps          []*SourceMap     //发布时需要写出的.map文件
+	sourceMapCount      map[string]int   //每个类已生成的源码映射数量
+	graph               moduleGraph      //编译时发现的模块依赖，只记录在根模块上
+	sources             *sourceCache     //发布时多个模块共享的源文件，只在根模块上设置
+	minify              bool             //发布时压缩脚本，只在根模块上设置
+	inspect             *Inspect         //记录编译的各个阶段，只在被检查的根模块上设置
+	lint                *lintState       //静态检查时记录的内容，根模块上设置时开始检查
+	script              string           //正在本模块中编译的导入的JavaScript模块，属于编译链
+	owner               *JUS             //写出本模块标签、扩展或导入的模块，编译链沿此向上
+	tempCount           int              //默认参数临时变量的数量，只在根模块上使用
+	cache               *CompileCache    //开发服务器的编译缓存，读取文件前记录hash，只在根模块上设置
 }
 
 /**
@@ -128,41 +145,49 @@ func (j *JUS) CreateFrom(root string, domain string, node *HTML, className strin
 	}
 	j.relativePath = strings.Replace(className, ".", "/", -1)
 	file := j.relativePath
+	depends := make([]string, 0, 6) //找到文件后再记录，依赖图按找到的文件名记录类名
 	if root == "" {
 		j.path = file
-		j.htmlPath = JUSExist(file + ".html")
-		j.jsPath = JUSExist(file + ".js")
-		j.cssPath = JUSExist(file + ".css")
+		j.htmlPath = j.exist(file + ".html")
+		j.jsPath = j.exist(file + ".js")
+		j.cssPath = j.exist(file + ".css")
+		depends = append(depends, file+".html", file+".js", file+".css")
 	} else {
 		if file[0] == '$' {
 			j.path = j.CLASS_PATH + "/" + file[1:]
-			j.htmlPath = JUSExist(j.path + ".html")
-			j.jsPath = JUSExist(j.path + ".js")
-			j.cssPath = JUSExist(j.path + ".css")
+			j.htmlPath = j.exist(j.path + ".html")
+			j.jsPath = j.exist(j.path + ".js")
+			j.cssPath = j.exist(j.path + ".css")
+			depends = append(depends, j.path+".html", j.path+".js", j.path+".css")
 		} else {
 			j.path = root + "/" + file
-			j.htmlPath = JUSExist(j.path + ".html")
-			j.jsPath = JUSExist(j.path + ".js")
-			j.cssPath = JUSExist(j.path + ".css")
+			j.htmlPath = j.exist(j.path + ".html")
+			j.jsPath = j.exist(j.path + ".js")
+			j.cssPath = j.exist(j.path + ".css")
+			depends = append(depends, j.path+".html", j.path+".js", j.path+".css") //工程中新建同名模块时也要重新编译
 			if j.htmlPath == "" && j.jsPath == "" && j.cssPath == "" {
 				j.path = j.CLASS_PATH + "/" + file
-				j.htmlPath = JUSExist(j.path + ".html")
-				j.jsPath = JUSExist(j.path + ".js")
-				j.cssPath = JUSExist(j.path + ".css")
+				j.htmlPath = j.exist(j.path + ".html")
+				j.jsPath = j.exist(j.path + ".js")
+				j.cssPath = j.exist(j.path + ".css")
+				depends = append(depends, j.path+".html", j.path+".js", j.path+".css")
 			}
 			//fmt.Println(j.htmlPath, j.jsPath)
 		}
 
 	}
+	j.dependFile(depends...)
 	j.dirPath = Substring(j.path, 0, LastIndex(j.path, "/"))
 
 	if j.htmlPath != "" {
 		j.html = &HTML{}
-		t, err := GetCode(j.htmlPath)
+		t, err := j.getCode(j.htmlPath)
 		if err != nil {
 			return false
 		}
 		j.html.ReadFromString(t) //j.html.ReadFromString(j.scanMedia(t))
+		j.html.SetFile(j.htmlPath)
+		j.Diagnostics().Merge(j.html.Diagnostics(), j.htmlPath)
 	} else if j.jsPath != "" {
 		j.PushImportScript(&Attr{className, ""}) //change by sunxy 2018-3-2
 		j.scriptFile = true
@@ -184,6 +209,12 @@ func (j *JUS) PushImportScript(value *Attr) {
 	if j.GetRoot().scriptElement == nil {
 		j.GetRoot().scriptElement = make(map[string]*Attr, 10)
 	}
+	if (value.Name != j.className || j.htmlPath != "") && Index(value.Name, "/") == -1 { //独立的JavaScript模块通过导入自己定义
+		if path := j.cyclePath(value.Name); path != nil {
+			j.Diagnostics().Errorf(j.sourcePath(), 0, 0, "%s", cycleMessage(path))
+			return
+		}
+	}
 	if j.GetRoot().scriptElement[value.Name] == nil {
 		sb := bytes.NewBufferString("")
 		if Index(value.Name, "/") != -1 || Index(value.Name, "\\") != -1 {
@@ -199,8 +230,14 @@ func (j *JUS) PushImportScript(value *Attr) {
 			if ft.IsScript() {
 				scriptObj := &Script{}
 				scriptObj.CreateFrom(j, j.root, j.domain, j.paramValue, j.extendsScriptBuffer, strings.TrimSpace(value.Name))
+				scriptObj.file = ft.jsPath
+				scriptObj.index = fileIndex(ft.jsPath)
 				tpr, _ := ft.GetInitString()
-				j.ToFormatLine("I", value.Name, "S"+scriptObj.ReadFromString(tpr), sb)
+				script := j.script
+				j.script = strings.TrimSpace(value.Name)
+				code := scriptObj.ReadFromString(tpr)
+				j.script = script
+				j.ToFormatLine("I", value.Name, "S"+code, sb)
 				j.GetRoot().scriptElementBuffer = append(j.GetRoot().scriptElementBuffer, sb.String()) //j.GetRoot().scriptElementBuffer = append(j.GetRoot().scriptElementBuffer, "\t_MODULE_CONTENT_LIST_[\f]['"+strings.TrimSpace(value.Name)+"'] = "+scriptObj.ReadFromString(j.scanMedia(tpr))+";\r\n")
 			} else {
 				j.ToFormatLine("I", value.Name, "H"+ft.ToFormatString(), sb)
@@ -208,8 +245,8 @@ func (j *JUS) PushImportScript(value *Attr) {
 			}
 		} else {
 			//j.GetRoot().scriptElementBuffer = append(j.GetRoot().scriptElementBuffer, "\t____ERROR____(\""+value.Name+" isn't Exist.\");\r\n")
-			j.ToFormatLine("O", value.Name, value.Name+" isn't Exist.", sb)
-			j.GetRoot().scriptElementBuffer = append(j.GetRoot().scriptElementBuffer, sb.String())
+			//错误信息由ToFormatBytes统一以O行输出
+			j.Diagnostics().Errorf(j.sourcePath(), 0, 0, "%s isn't Exist.", value.Name)
 		}
 	}
 }
@@ -229,13 +266,13 @@ func (j *JUS) PushCommandScript(value *Attr) {
  */
 func (j *JUS) GetInitString() (string, bool) {
 	if j.htmlPath != "" {
-		t, err := GetCode(j.htmlPath)
+		t, err := j.getCode(j.htmlPath)
 		if err != nil {
 			return "", false
 		}
 		return t, true
 	} else if j.jsPath != "" {
-		t, err := GetCode(j.jsPath)
+		t, err := j.getCode(j.jsPath)
 		if err != nil {
 			return "", false
 		}
@@ -257,10 +294,78 @@ func (j *JUS) GetInitString() (string, bool) {
  */
 func (j *JUS) CreateFromParent(root string, domain string, node *HTML, className string, parent *JUS) bool {
 	j.parent = parent
-	return j.CreateFrom(root, domain, node, className)
+	j.owner = parent.ownerOf(node)
+	ok := j.CreateFrom(root, domain, node, className)
+	parent.dependModule(j.graphName())
+	return ok
 
 }
 
+/**
+ * 写出节点的模块
+ * <@content /> 中的节点在外层模块的文件中定义，却由内层模块展开，按节点的源文件沿parent找到定义它的模块
+ * @return 节点没有源文件或找不到时返回本模块
+ */
+func (j *JUS) ownerOf(node *HTML) *JUS {
+	if node == nil || node.Position().File == "" {
+		return j
+	}
+	for p := j; p != nil; p = p.parent {
+		if p.htmlPath == node.Position().File {
+			return p
+		}
+	}
+	return j
+}
+
+/**
+ * 编译链上的类名，从本模块到根模块
+ * 编译链只包含类定义中的标签、扩展类和导入，<@content /> 的展开不属于编译链；导入的JavaScript模块在导入它的模块中编译
+ */
+func (j *JUS) chain() []string {
+	lst := make([]string, 0, 4)
+	for p := j; p != nil; p = p.owner {
+		if p.script != "" {
+			lst = append(lst, p.script)
+		}
+		lst = append(lst, p.className)
+	}
+	return lst
+}
+
+/**
+ * 在本模块中使用className是否形成循环依赖
+ * @return 循环的路径，例如 [a.A a.B a.A]，没有循环时返回nil
+ */
+func (j *JUS) cyclePath(className string) []string {
+	return cycleOf(j.chain(), className)
+}
+
+/**
+ * @param chain		编译链，从当前模块到根模块
+ * @param className	要加入编译链的类名
+ */
+func cycleOf(chain []string, className string) []string {
+	className = strings.TrimSpace(Replace(Replace(className, "/", "."), "\\", "."))
+	for i, v := range chain {
+		if v == className {
+			path := make([]string, 0, i+2)
+			for k := i; k >= 0; k-- {
+				path = append(path, chain[k])
+			}
+			return append(path, className)
+		}
+	}
+	return nil
+}
+
+/**
+ * 循环依赖的错误信息
+ */
+func cycleMessage(path []string) string {
+	return "circular dependency: " + strings.Join(path, " -> ")
+}
+
 func (j *JUS) SetConstructor(value *Attr) *JUS {
 	j.paramValue = value
 	return j
@@ -336,6 +441,166 @@ func (j *JUS) GetRoot() *JUS {
 	return j
 }
 
+/**
+ * 获取编译诊断信息，子模块的信息都记录在根模块上
+ */
+func (j *JUS) Diagnostics() *Diagnostics {
+	root := j.GetRoot()
+	if root.diagnostics == nil {
+		root.diagnostics = &Diagnostics{}
+	}
+	return root.diagnostics
+}
+
+/**
+ * 为生成的脚本附加源码映射，开发模式内联在脚本中，发布时记录在根模块上，由发布程序写为.map文件
+ * @param className	脚本所属的类
+ * @param code		生成的脚本，运行时以eval执行
+ * @param marks		脚本中记录的源码位置，相对于被解析的代码
+ * @param index		被解析的代码到源码的位置索引
+ */
+func (j *JUS) attachSourceMap(className string, code string, marks []codeMark, index *sourceIndex) string {
+	root := j.GetRoot()
+	if root.sourceMap == "" || index == nil {
+		return code
+	}
+	lst := make([]codeMark, 0, len(marks))
+	for _, v := range marks {
+		if v.pos = index.resolve(v.pos); v.pos.IsValid() {
+			lst = append(lst, v)
+		}
+	}
+	if len(lst) == 0 {
+		return code
+	}
+	if root.sourceMapCount == nil {
+		root.sourceMapCount = make(map[string]int, 2)
+	}
+	n := root.sourceMapCount[className]
+	root.sourceMapCount[className]++
+	name := strings.Replace(className, ".", "/", -1) + IfStr(n > 0, "."+strconv.Itoa(n), "") + ".js"
+	sm := NewSourceMap(path.Base(name), []string{j.root, j.CLASS_PATH}, lst)
+	url := ""
+	if root.sourceMap == SourceMapFile {
+		sm.Name = name + ".map"
+		root.sourceMaps = append(root.sourceMaps, sm)
+		url = path.Base(sm.Name)
+	} else {
+		url = sm.DataURL()
+	}
+	return code + "\r\n" + mapTrailer(name, url)
+}
+
+/**
+ * 发布时需要写出的.map文件
+ */
+func (j *JUS) SourceMaps() []*SourceMap {
+	return j.GetRoot().sourceMaps
+}
+
+/**
+ * 本模块在依赖图中的节点
+ */
+func (j *JUS) dependNode() *moduleNode {
+	root := j.GetRoot()
+	if root.graph == nil {
+		root.graph = make(moduleGraph, 10)
+	}
+	n := root.graph[j.graphName()]
+	if n == nil {
+		n = &moduleNode{Files: make(map[string]string, 4)}
+		root.graph[j.graphName()] = n
+	}
+	return n
+}
+
+/**
+ * 依赖图中的类名，模块文件名不区分大小写，按找到的文件名修正类名的大小写
+ * 例如 <component.vbox> 和 component.VBox 都记录为 component.VBox，打包时只打包一次
+ */
+func (j *JUS) graphName() string {
+	for _, v := range []string{j.htmlPath, j.jsPath, j.cssPath} {
+		if v != "" {
+			return resolvedName(j.className, v)
+		}
+	}
+	return j.className
+}
+
+/**
+ * @param className	写法中的类名
+ * @param file		找到的模块文件
+ */
+func resolvedName(className string, file string) string {
+	name := filepath.Base(file)
+	name = name[0 : len(name)-len(filepath.Ext(name))]
+	return className[0:strings.LastIndex(className, ".")+1] + name
+}
+
+/**
+ * 读取源文件，发布时从共享的源文件中读取
+ */
+func (j *JUS) getCode(path string) (string, error) {
+	if s := j.GetRoot().sources; s != nil {
+		return s.code(path)
+	}
+	return GetCode(path)
+}
+
+/**
+ * 查找模块文件，文件名不区分大小写
+ */
+func (j *JUS) exist(name string) string {
+	if s := j.GetRoot().sources; s != nil {
+		return s.exist(name)
+	}
+	return JUSExist(name)
+}
+
+/**
+ * 记录编译时读取的文件或目录，文件不存在也需要记录，创建后需要重新编译
+ * 在读取之前调用，设置了编译缓存时同时记录此时的hash
+ */
+func (j *JUS) dependFile(path ...string) {
+	n := j.dependNode()
+	cache := j.GetRoot().cache
+	for _, v := range path {
+		if abs, err := filepath.Abs(v); err == nil {
+			v = abs
+		}
+		if _, ok := n.Files[v]; ok { //只记录第一次读取前的hash
+			continue
+		}
+		n.Files[v] = ""
+		if cache != nil {
+			n.Files[v] = cache.fileHash(v)
+		}
+	}
+}
+
+/**
+ * 记录本模块依赖的模块，包括@import、标签、extends和import引用的模块
+ */
+func (j *JUS) dependModule(className string) {
+	if className == "" || className == j.className {
+		return
+	}
+	n := j.dependNode()
+	for _, v := range n.Deps {
+		if v == className {
+			return
+		}
+	}
+	n.Deps = append(n.Deps, className)
+}
+
+/**
+ * 模块的源文件路径，优先为html文件
+ */
+func (j *JUS) sourcePath() string {
+	return IfStr(j.htmlPath != "", j.htmlPath, j.jsPath)
+}
+
 /**
  * 添加静态函数表达式
  * @param className
@@ -409,6 +674,8 @@ func (j *JUS) overHTML(node []*HTML) {
 				if t != nil {
 					t.ReplaceWith(p)
 
+				} else if p.TagName() != "" {
+					j.lintAt(p.Position(), j.htmlPath, "@override <%s id=\"%s\"> doesn't match any element of %s.", p.TagName(), p.GetAttr("id"), j.className)
 				}
 			}
 		}
@@ -501,6 +768,7 @@ func (j *JUS) scanHTML(child []*HTML) {
 					p.SetAttr("src_id", p.GetAttr("id"))
 					p.SetAttr("id", p.GetAttr("domain")+p.GetAttr("id"))
 				}
+				j.lintId(p)
 			}
 		}
 
@@ -515,6 +783,7 @@ func (j *JUS) scanHTML(child []*HTML) {
 				v = strings.ToLower(v)
 				attrName = j.pkgMap[v]
 				if attrName != "" {
+					j.lintUse(v)
 					p.SetAttrName(v, attrName)
 					j.PushCommandScript(&Attr{attrName, "-" + v + "\001" + attrName + "\001" + p.GetAttr("id") + "\001" + attrValue})
 					j.PushImportScript(&Attr{attrName, ""})
@@ -533,7 +802,10 @@ func (j *JUS) scanHTML(child []*HTML) {
 			}
 			var tFunc *JUS = &JUS{SYSTEM_PATH: j.SYSTEM_PATH, CLASS_PATH: j.CLASS_PATH, IsImport: j.IsImport}
 
-			if tFunc.CreateFromParent(j.root, p.GetAttr("id"), p, tagName, j) {
+			if path := j.ownerOf(p).cyclePath(tagName); path != nil { //标签展开会无限递归
+				j.Diagnostics().ErrorAt(p.Position(), j.htmlPath, "%s", cycleMessage(path))
+				tHTML = (&HTML{}).ReadFromString("<div style='font-size:14px;font-weight:bold;background-color: #E91E63;color: #fefefe;padding: 5px;border-radius: 5px;display: inline;'>" + strings.Replace(cycleMessage(path), ">", "&gt;", -1) + "</div>")
+			} else if tFunc.CreateFromParent(j.root, p.GetAttr("id"), p, tagName, j) {
 				tFunc.resPath = j.resPath
 				if tFunc.IsScript() {
 					tFunc.SetConstructor(&Attr{tagName, p.GetConstructerParameter()}).setExtend(p.GetAttr("id") == j.domain)
@@ -564,6 +836,7 @@ func (j *JUS) scanHTML(child []*HTML) {
 					}
 				}
 			} else {
+				j.Diagnostics().ErrorAt(p.Position(), j.htmlPath, "<%s> isn't exist.", tagName)
 				tHTML = (&HTML{}).ReadFromString("<div style='font-size:14px;font-weight:bold;background-color: #E91E63;color: #fefefe;padding: 5px;border-radius: 5px;display: inline;'>" + tagName + " isn't exist.</div>")
 			}
 			if p == j.html {
@@ -581,6 +854,7 @@ func (j *JUS) componentInitParam(value *Attr) string {
 	s := j.componentInitCode(value)
 	script := &HTMLScript{}
 	script.CreateFrom(j, j.root, j.domain, j.paramValue, j.innerValue, j.extendsScriptBuffer)
+	script.file = j.htmlPath
 	str := script.FormatString(s)
 	return str
 }
@@ -690,27 +964,39 @@ func (j *JUS) importHTML() {
 		}
 
 		fl := j.CLASS_PATH + "/" + strings.Replace(path, ".", "/", -1)
+		j.dependFile(fl)
 
+		found := false
 		lst, err := ioutil.ReadDir(fl)
 		if err == nil {
 			for _, f := range lst {
 				if !f.IsDir() && (fileName == "" || fileName == f.Name()) {
+					found = true
 					j.pkgMap[strings.ToLower(Substring(f.Name(), 0, LastIndex(f.Name(), ".")))] = path + "." + Substring(f.Name(), 0, LastIndex(f.Name(), "."))
 					//fmt.Println(strings.ToLower(Substring(f.Name(), 0, LastIndex(f.Name(), "."))), path+"."+Substring(f.Name(), 0, LastIndex(f.Name(), ".")))
 				}
 			}
 		}
 		fl = j.root + "/" + strings.Replace(path, ".", "/", -1)
+		j.dependFile(fl)
 
 		lst, err = ioutil.ReadDir(fl)
 		if err == nil {
 			for _, f := range lst {
 				if !f.IsDir() && (fileName == "" || fileName == f.Name()) {
+					found = true
 					j.pkgMap[strings.ToLower(Substring(f.Name(), 0, LastIndex(f.Name(), ".")))] = path + "." + Substring(f.Name(), 0, LastIndex(f.Name(), "."))
 					//fmt.Println(strings.ToLower(Substring(f.Name(), 0, LastIndex(f.Name(), "."))), path+"."+Substring(f.Name(), 0, LastIndex(f.Name(), ".")))
 				}
 			}
 		}
+		if l := j.linter(); l != nil && value != "" {
+			if !found {
+				j.lintAt(sets[i].Position(), j.htmlPath, "@import %s isn't exist.", value)
+			} else if fileName != "" { //只检查导入单个类是否使用
+				l.imports[strings.ToLower(Substring(fileName, 0, LastIndex(fileName, ".")))] = sets[i]
+			}
+		}
 
 		path = ""
 		fileName = ""
@@ -740,12 +1026,27 @@ func (j *JUS) rootHTML() {
 	}
 	child = j.html.Filter("script")
 	for _, v := range child {
-		j.scriptBuffer.Write(ListToHTMLStringBytes(v.Child()))
+		j.writeScript(v.Child())
 		v.Remove()
 	}
 
 }
 
+/**
+ * 将<script>节点的内容加入scriptBuffer，并记录源码位置
+ */
+func (j *JUS) writeScript(child []*HTML) {
+	for _, v := range child {
+		value := v.ToString()
+		pos := Position{}
+		if v.tagType == -1 { //只有文本是源码原样
+			pos = v.pos
+		}
+		j.scriptIndex.Write(pos, value)
+		j.scriptBuffer.WriteString(value)
+	}
+}
+
 /**
  *
  */
@@ -764,11 +1065,13 @@ func (j *JUS) packageHTML(child []*HTML) {
 
 		//替换Module TagName 变为真是的tagName
 		if j.pkgMap[tagName] != "" {
+			j.lintUse(tagName)
 			tagName = j.pkgMap[tagName]
 			p.SetTagName(tagName)
 		}
 
 		if extName != "" && j.pkgMap[extName] != "" {
+			j.lintUse(extName)
 			extName = j.pkgMap[extName]
 			p.SetTagName(tagName + ":" + extName)
 		}
@@ -800,7 +1103,7 @@ func (j *JUS) domainHTML(child []*HTML) {
 		}
 
 		if "script" == tagName || "~script" == tagName {
-			j.scriptBuffer.Write(ListToHTMLStringBytes(p.Child()))
+			j.writeScript(p.Child())
 			p.Remove()
 			continue
 		}
@@ -834,11 +1137,12 @@ func (j *JUS) domainHTML(child []*HTML) {
 func (j *JUS) includeCode(h []*HTML) {
 	for _, p := range h {
 		if p.TagName() == "@include" {
-			tpr, err := GetCode(j.root + "/" + p.GetAttr("value"))
+			j.dependFile(j.root + "/" + p.GetAttr("value"))
+			tpr, err := j.getCode(j.root + "/" + p.GetAttr("value"))
 			if err != nil {
-				fmt.Println(j.root + "/" + p.GetAttr("value") + " isn't Exists.")
+				j.Diagnostics().ErrorAt(p.Position(), j.htmlPath, "%s isn't Exists.", j.root+"/"+p.GetAttr("value"))
 			}
-			p.ReplaceWithFormString(tpr)
+			p.ReplaceWithFormString(tpr).SetFile(j.root + "/" + p.GetAttr("value"))
 		}
 		j.includeCode(p.Child())
 	}
@@ -909,6 +1213,7 @@ func (j *JUS) scanMedia(value string) string {
 				}
 				f := Substring(path, 0, LastIndex(path, ".")) + ".res/" + Substring(string(tmp), 1, len(tmp)-1)
 				//fmt.Println(filepath.Abs(f))
+				j.dependFile(f)
 				if Exist(f) {
 					data, _ := GetBytes(f)
 					sb.WriteString("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
@@ -1020,7 +1325,9 @@ func (j *JUS) ReadHTML() *HTML {
 					}
 					var tFunc *JUS = &JUS{SYSTEM_PATH: j.SYSTEM_PATH, CLASS_PATH: j.CLASS_PATH}
 					j.idMap[v2.GetAttr("src_id")] = &HTMLObject{Name: v2.GetAttr("id"), HTMLObjectType: 1}
-					if tFunc.CreateFromParent(j.root, v2.GetAttr("id"), v2, v2.TagName(), j) {
+					if path := j.ownerOf(v2).cyclePath(v2.TagName()); path != nil {
+						j.Diagnostics().ErrorAt(v2.Position(), j.jsPath, "%s", cycleMessage(path))
+					} else if tFunc.CreateFromParent(j.root, v2.GetAttr("id"), v2, v2.TagName(), j) {
 						fmt.Println("TagName>>", v2.TagName(), tFunc.IsScript())
 						if tFunc.IsScript() {
 							tFunc.SetConstructor(&Attr{v2.TagName(), v2.GetConstructerParameter()}).setExtend(v2.GetAttr("id") == j.domain)
@@ -1070,7 +1377,9 @@ func (j *JUS) ReadHTML() *HTML {
 	}
 
 	j.rootHTML()
+	j.stage("rootHTML")
 	j.importHTML()
+	j.stage("importHTML")
 	j.initObj(j.html)
 	j.includeCode([]*HTML{j.html})
 	htmls := j.html.GetUnTextChild()
@@ -1080,17 +1389,21 @@ func (j *JUS) ReadHTML() *HTML {
 	//加载外部CSS
 	if j.cssPath != "" {
 		css := &HTML{}
-		tpr, _ := GetCode(j.cssPath)
+		tpr, _ := j.getCode(j.cssPath)
 		css.ReadFromString("<style>" + tpr + "</style>")
 		j.html.Append(css)
 	}
 
 	j.overHTML(j.innerContent)
+	j.stage("overHTML")
 	j.packageHTML([]*HTML{j.html})
+	j.stage("packageHTML")
 	j.domainHTML([]*HTML{j.html})
+	j.stage("domainHTML")
 	if j.styleBuffer.Len() > 0 {
-		j.style = &CSS{jus: j, CurrentPath: j.resPath + "/" + j.relativePath + ".RES"}
+		j.style = &CSS{jus: j, CurrentPath: j.resPath + "/" + j.relativePath + ".RES", minify: j.GetRoot().minify}
 		j.style.ReadFromString(j.scanMedia(j.styleBuffer.String()))
+		j.Diagnostics().Merge(j.style.Diagnostics(), IfStr(j.cssPath != "", j.cssPath, j.htmlPath))
 	}
 
 	j.html.SetAttr("isComponent", "true")
@@ -1098,9 +1411,12 @@ func (j *JUS) ReadHTML() *HTML {
 	j.html.SetAttr("isroot", "true")
 
 	j.scanHTML([]*HTML{j.html})
+	j.stage("scanHTML")
 	j.componentId([]*HTML{j.html})
 	if j.contentTo != "" {
-		j.scriptBuffer.WriteString("____." + j.contentTo + "=_MODULE_INNER_[__DOMAIN__];")
+		value := "____." + j.contentTo + "=_MODULE_INNER_[__DOMAIN__];"
+		j.scriptIndex.Write(Position{}, value)
+		j.scriptBuffer.WriteString(value)
 	}
 
 	if j.html.GetAttr("class") == "" || Index(j.html.GetAttr("class"), j.domain) == -1 {
@@ -1116,7 +1432,10 @@ func (j *JUS) ReadHTML() *HTML {
 	//开始组装参数
 	script := &HTMLScript{}
 	script.CreateFrom(j, j.root, j.domain, j.paramValue, j.innerValue, j.extendsScriptBuffer)
+	script.file = j.htmlPath
+	script.index = &j.scriptIndex
 	scriptCodeString := script.ReadFromString(j.scriptBuffer.String())
+	script.index = nil
 	scriptCode.WriteString("</script>")
 	j.html.InsertFromString(scriptCode.String(), 0)
 
@@ -1140,7 +1459,9 @@ func (j *JUS) ReadHTML() *HTML {
 	if j.jsPath != "" {
 		script = &HTMLScript{}
 		script.CreateFrom(j, j.root, j.domain, j.paramValue, j.innerValue, j.extendsScriptBuffer)
-		tpr, _ := GetCode(j.jsPath)
+		script.file = j.jsPath
+		script.index = fileIndex(j.jsPath)
+		tpr, _ := j.getCode(j.jsPath)
 		scriptString := script.ReadFromString(tpr) //scriptString = script.ReadFromString(j.scanMedia(tpr))
 
 		if len(scriptString) != 0 {
@@ -1151,10 +1472,12 @@ func (j *JUS) ReadHTML() *HTML {
 	}
 
 	if j.cssBuffer.Len() > 0 {
-		j.css = &CSS{jus: j, CurrentPath: j.resPath + "/" + j.relativePath + ".RES"}
+		j.css = &CSS{jus: j, CurrentPath: j.resPath + "/" + j.relativePath + ".RES", minify: j.GetRoot().minify}
 		j.css.ReadFromString(j.scanMedia(j.cssBuffer.String()))
+		j.Diagnostics().Merge(j.css.Diagnostics(), j.htmlPath)
 		j.AddStyleCode(j.className, j.cssFormat())
 	}
+	j.lintImports()
 	//最终加入静态函数变量
 	if j.parent == nil {
 		st := bytes.NewBufferString("")
@@ -1163,8 +1486,8 @@ func (j *JUS) ReadHTML() *HTML {
 			sb.WriteString(v)
 		}
 		j.staticCode = j.GetStaticCodeMap()
-		for name, value := range j.staticCode {
-			for _, attr := range value {
+		for _, name := range attrKeys(j.staticCode) { //按名称输出，保证每次编译结果相同
+			for _, attr := range j.staticCode[name] {
 				st.WriteString("__POS_VALUE__")
 				st.WriteString(attr.Value)
 				//st.WriteString("__ADD_STATIC_METHOD__('" + name + "','" + attr.Name + "',__POS_VALUE__" + ",__APPDOMAIN__);")
@@ -1174,8 +1497,8 @@ func (j *JUS) ReadHTML() *HTML {
 			}
 		}
 		j.staticScript = j.GetStaticMap()
-		for name, value := range j.staticScript {
-			for _, attr := range value {
+		for _, name := range attrKeys(j.staticScript) {
+			for _, attr := range j.staticScript[name] {
 				st.WriteString("__POS_VALUE__" + attr.Value + ";\r\n")
 				//st.WriteString("__ADD_STATIC_METHOD__('" + name + "','" + attr.Name + "',__POS_VALUE__" + ",\f);")
 				j.ToFormatLine("S", name, attr.Name+" "+st.String(), sb)
@@ -1210,7 +1533,13 @@ func (j *JUS) ReadHTML() *HTML {
 		sb.Reset()
 		sb.WriteString("<css>")
 		j.styleCode = j.GetStyleCodeMap()
-		for name, value := range j.styleCode {
+		names := make([]string, 0, len(j.styleCode))
+		for name := range j.styleCode {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := j.styleCode[name]
 			j.ToFormatLine("A", name, value, sb)
 			//sb.WriteString(strconv.Itoa(StringLen(name)))
 			//sb.WriteRune('%')
@@ -1241,6 +1570,8 @@ func (j *JUS) ReadHTML() *HTML {
 func (j *JUS) componentInitCode(value *Attr) string {
 	ms := &MScript{}
 	ms.ReadFromString(value.Value)
+	j.Diagnostics().Merge(ms.Diagnostics(), j.htmlPath)
+	ms.names = j.tempNames()
 	sb := bytes.NewBufferString("")
 	for _, v := range ms.GetJUIScriptData() {
 		if v.Value == "this" && v.Domain == "class" {
@@ -1284,6 +1615,25 @@ func (j *JUS) AddRun(attr *RunElem) {
 	j.runList = append(j.runList, attr)
 }
 
+/**
+ * 按名称排序的类名列表
+ */
+func attrKeys(m map[string][]*Attr) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+ * 默认参数临时变量的计数器，根模块的一次编译中共用，每次编译的结果相同
+ */
+func (j *JUS) tempNames() *int {
+	return &j.GetRoot().tempCount
+}
+
 func (j *JUS) getName() string {
 	if j.parent != nil {
 		return j.parent.getName()
@@ -1309,20 +1659,17 @@ func (j *JUS) ToFormatLine(cls string, moduleName string, value string, data *by
 		return bs
 	}
 	j.GetModuleMap()[bs] = &Attr{Name: moduleName}
-	data.WriteString(cls)
-	data.WriteString(strconv.Itoa(StringLen(moduleName)))
-	data.WriteString("%")
-	data.WriteString(strconv.Itoa(StringLen(value)))
-	data.WriteByte(' ')
-	data.WriteString(moduleName)
-	data.WriteByte(' ')
-	data.WriteString(bs)
-	data.WriteByte(' ')
-	data.WriteString(value)
-	data.WriteString("\r\n")
+	writeFormatLine(cls, moduleName, bs, value, data)
 	return bs
 }
 
+/**
+ * 输出一行格式化内容：类型 名称长度%内容长度 名称 md5 内容
+ */
+func writeFormatLine(cls string, moduleName string, hash string, value string, data *bytes.Buffer) {
+	(&format.Line{Type: cls, Name: moduleName, Hash: hash, Value: value}).WriteTo(data)
+}
+
 /**
  * 格式化输出内容
  * @param cls		信息类型
@@ -1330,15 +1677,14 @@ func (j *JUS) ToFormatLine(cls string, moduleName string, value string, data *by
  * @param value		内容
  */
 func (j *JUS) ToFormatRun(cls string, domain string, value string, data *bytes.Buffer) {
-	data.WriteString(cls)
-	data.WriteString(strconv.Itoa(StringLen(domain)))
-	data.WriteString("%")
-	data.WriteString(strconv.Itoa(StringLen(value)))
-	data.WriteByte(' ')
-	data.WriteString(domain)
-	data.WriteByte(' ')
-	data.WriteString(value)
-	data.WriteString("\r\n")
+	writeFormatRun(cls, domain, value, data)
+}
+
+/**
+ * 输出一行执行内容，与格式化内容相同但没有md5
+ */
+func writeFormatRun(cls string, domain string, value string, data *bytes.Buffer) {
+	(&format.Line{Type: cls, Name: domain, Value: value}).WriteTo(data)
 }
 
 /**
@@ -1348,6 +1694,9 @@ func (j *JUS) ToFormatBytes() []byte {
 	result := j.ReadHTML()
 	stls := result.GetElementsByTagName("css") //获取公共css属性
 	json := bytes.NewBufferString("")
+	if j.parent == nil { //根模块以头部行开始，写明格式版本
+		format.WriteHeader(json)
+	}
 
 	for _, v := range stls {
 		json.WriteString(ListToHTMLString(v.Child()))
@@ -1370,6 +1719,13 @@ func (j *JUS) ToFormatBytes() []byte {
 		v.Remove()
 	}
 	//json.Write(j.contentToInitBuf.Bytes())
+	if j.parent == nil { //编译错误以O行输出，由运行时显示
+		for _, v := range j.Diagnostics().List() {
+			if v.Severity == DiagError {
+				j.ToFormatLine("O", j.className, v.String(), json)
+			}
+		}
+	}
 	j.ToFormatLine("H", j.className, result.ToString(), json)
 	for _, v := range j.runList {
 		j.ToFormatRun("R"+v.Type, v.Name, v.Value, json)
@@ -1377,6 +1733,13 @@ func (j *JUS) ToFormatBytes() []byte {
 	return json.Bytes()
 }
 
+/**
+ * 编译结果的JSON结构，内容与ToFormatBytes相同，结构见 format.Module
+ */
+func (j *JUS) ToFormatJSON() ([]byte, error) {
+	return format.ToJSON(j.ToFormatBytes())
+}
+
 func (j *JUS) ToFormatString() string {
 	return string(j.ToFormatBytes())
 }
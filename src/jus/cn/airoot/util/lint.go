@@ -0,0 +1,200 @@
+// lint.go
+package util
+
+import (
+	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * 静态检查时记录的内容，检查发现的问题都以警告记录在根模块的诊断信息中
+ */
+type lintState struct {
+	imports map[string]*HTML //@import导入的单个类，标签名到@import节点，使用后移除
+	ids     map[string]*HTML //已出现的id，只在根模块上记录
+}
+
+/**
+ * 一个模块的检查结果
+ */
+type LintModule struct {
+	ClassName   string        `json:"class"`
+	Status      string        `json:"status"` //ok、warning 或 error
+	Diagnostics []*Diagnostic `json:"diagnostics,omitempty"`
+}
+
+/**
+ * 检查结果统计
+ */
+type LintSummary struct {
+	Modules  int `json:"modules"`
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+}
+
+/**
+ * 本模块的检查记录，不在检查时返回nil
+ */
+func (j *JUS) linter() *lintState {
+	if j.GetRoot().lint == nil {
+		return nil
+	}
+	if j.lint == nil {
+		j.lint = &lintState{imports: make(map[string]*HTML, 4)}
+	}
+	return j.lint
+}
+
+/**
+ * 检查时记录一条警告
+ */
+func (j *JUS) lintAt(pos Position, file string, format string, a ...interface{}) {
+	if j.linter() != nil {
+		j.Diagnostics().WarningAt(pos, file, format, a...)
+	}
+}
+
+/**
+ * 标签名对应的@import已被使用
+ */
+func (j *JUS) lintUse(tagName string) {
+	if l := j.linter(); l != nil {
+		delete(l.imports, tagName)
+	}
+}
+
+/**
+ * 检查重复的id，id为加上作用域后的最终id
+ */
+func (j *JUS) lintId(p *HTML) {
+	if j.linter() == nil {
+		return
+	}
+	root := j.GetRoot().lint
+	if root.ids == nil {
+		root.ids = make(map[string]*HTML, 20)
+	}
+	id := p.GetAttr("id")
+	if q := root.ids[id]; q != nil {
+		pos := q.Position()
+		if pos.File != "" {
+			pos.File = filepath.ToSlash(filepath.Clean(pos.File))
+		}
+		j.lintAt(p.Position(), j.htmlPath, "duplicate id \"%s\", first defined at %s.", p.GetAttr("src_id"), pos)
+		return
+	}
+	root.ids[id] = p
+}
+
+/**
+ * 报告没有使用的@import
+ */
+func (j *JUS) lintImports() {
+	l := j.linter()
+	if l == nil {
+		return
+	}
+	names := make([]string, 0, len(l.imports))
+	for k := range l.imports {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		j.lintAt(l.imports[k].Position(), j.htmlPath, "@import %s isn't used.", j.pkgMap[k])
+	}
+	l.imports = make(map[string]*HTML, 0)
+}
+
+/**
+ * 静态检查工程中的所有模块，只编译不写出
+ * 除编译时的错误外，还报告未使用的导入、不存在的$id和#id引用、重复的id、找不到元素的@override
+ * 多个模块中重复的问题只在第一个模块中报告
+ */
+func (u *JusServer) Lint() []*LintModule {
+	src := u.RootPath + "/code/"
+	names := make([]string, 0)
+	seen := make(map[string]bool, 20)
+	filepath.Walk(src, func(f string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(f)
+		if ext != ".html" && ext != ".js" {
+			return nil
+		}
+		rel, _ := filepath.Rel(src, f)
+		name := Replace(filepath.ToSlash(strings.TrimSuffix(rel, ext)), "/", ".")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+
+	list := make([]*LintModule, 0, len(names))
+	reported := make(map[string]bool, 20)
+	for _, name := range names {
+		m := &LintModule{ClassName: name, Status: "ok"}
+		for _, v := range u.lintModule(name) {
+			if reported[v.String()] {
+				continue
+			}
+			reported[v.String()] = true
+			m.Diagnostics = append(m.Diagnostics, v)
+			if v.Severity == DiagError {
+				m.Status = "error"
+			} else if m.Status == "ok" {
+				m.Status = "warning"
+			}
+		}
+		list = append(list, m)
+	}
+	return list
+}
+
+/**
+ * 检查一个模块，编译过程中的异常记录为错误
+ */
+func (u *JusServer) lintModule(className string) (diag []*Diagnostic) {
+	jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/", lint: &lintState{imports: make(map[string]*HTML, 4)}}
+	defer func() {
+		if e := recover(); e != nil {
+			d := jus.Diagnostics()
+			d.Errorf(jus.sourcePath(), 0, 0, "%v", e)
+			diag = d.List()
+		}
+	}()
+	if !jus.CreateFrom(u.RootPath+"/code/", "", nil, className) {
+		return []*Diagnostic{{Severity: DiagError, Message: className + " isn't Exist."}}
+	}
+	jus.resPath = "code"
+	jus.ToFormatBytes()
+	return jus.Diagnostics().List()
+}
+
+/**
+ * 统计检查结果
+ */
+func LintSummarize(list []*LintModule) *LintSummary {
+	s := &LintSummary{}
+	for _, m := range list {
+		s.Modules++
+		for _, v := range m.Diagnostics {
+			if v.Severity == DiagError {
+				s.Errors++
+			} else {
+				s.Warnings++
+			}
+		}
+	}
+	return s
+}
+
+func (s *LintSummary) String() string {
+	return fmt.Sprintf("modules: %d, errors: %d, warnings: %d", s.Modules, s.Errors, s.Warnings)
+}
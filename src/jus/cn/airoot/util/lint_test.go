@@ -0,0 +1,87 @@
+// lint_test.go
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                "",
+		"code/comp/Row.html":  `<div class="row"><span id="x">row</span></div>`,
+		"code/comp/Card.html": `<div class="card"><span id="title">card</span></div>`,
+		"code/util/Fmt.js":    "public function name(){\n\treturn 1;\n}",
+		"code/good.html":      "<div>\n\t<comp.Card id=\"c\"/>\n\t<script>\n\t\tfunction f(){ $c.dom; }\n\t</script>\n</div>",
+		"code/bad.html": strings.Join([]string{
+			"<div>",
+			"\t<@import value=\"comp.Row\" />",
+			"\t<@import value=\"comp.Card\" />",
+			"\t<@import value=\"comp.None\" />",
+			"\t<span id=\"t\">a</span>",
+			"\t<span id=\"t\">b</span>",
+			"\t<Card/>",
+			"\t<script>",
+			"\t\timport util.Fmt;",
+			"\t\tfunction f(){ $t.text(1); $missing.text(2); }",
+			"\t</script>",
+			"</div>",
+		}, "\n"),
+		"code/hash.html":   "<div>\n\t<span id=\"t\">a</span>\n\t<script>\n\t\tfunction f(){ #t.show(); #nope.show(); }\n\t</script>\n</div>",
+		"code/over.html":   "<div>\n\t<comp.Card id=\"c\">\n\t\t<@override>\n\t\t\t<span id=\"title\">new</span>\n\t\t\t<span id=\"nope\">x</span>\n\t\t</@override>\n\t</comp.Card>\n</div>",
+		"code/blue.js":     "class Blue extends util.Fmt {\n\tpublic function name(){\n\t\treturn 2;\n\t}\n}",
+		"code/ext.js":      "class Red extends util.None {\n\tpublic function name(){\n\t\treturn 1;\n\t}\n}",
+		"code/loop/A.html": "<div><loop.B/></div>",
+		"code/loop/B.html": "<div><loop.A/></div>",
+	})
+	defer os.RemoveAll(u.RootPath)
+	code := filepath.ToSlash(u.RootPath) + "/code/"
+
+	list := u.Lint()
+	want := map[string][]string{
+		"bad": {
+			"bad.html:2:2: warning: @import comp.Row isn't used.",
+			"bad.html:4:2: warning: @import comp.None isn't exist.",
+			"bad.html:6:2: warning: duplicate id \"t\", first defined at " + code + "bad.html:5:2.",
+			"bad.html:9:3: warning: import util.Fmt isn't used.",
+			"bad.html:10:29: warning: $missing isn't defined.",
+		},
+		"blue":      nil,
+		"comp.Card": nil,
+		"comp.Row":  nil,
+		"ext":       {"ext.js: error: Load Class Path Error: util.None"}, //继承的类不存在
+		"good":      nil,
+		"hash":      {"hash.html:4:29: warning: #nope isn't defined."},
+		"loop.A":    {"loop/B.html:1:6: error: circular dependency: loop.A -> loop.B -> loop.A"},
+		"loop.B":    {"loop/A.html:1:6: error: circular dependency: loop.B -> loop.A -> loop.B"},
+		"over":      {"over.html:5:4: warning: @override <span id=\"nope\"> doesn't match any element of comp.Card."},
+		"util.Fmt":  nil,
+	}
+	status := map[string]string{"bad": "warning", "ext": "error", "hash": "warning", "loop.A": "error", "loop.B": "error", "over": "warning"}
+	names := []string{}
+	for _, m := range list {
+		names = append(names, m.ClassName)
+		var got []string
+		for _, v := range m.Diagnostics {
+			got = append(got, strings.TrimPrefix(filepath.ToSlash(v.String()), code))
+		}
+		if !reflect.DeepEqual(got, want[m.ClassName]) {
+			t.Errorf("%s: %q, want %q", m.ClassName, got, want[m.ClassName])
+		}
+		if s := status[m.ClassName]; m.Status != s && !(s == "" && m.Status == "ok") {
+			t.Errorf("%s: status %s", m.ClassName, m.Status)
+		}
+	}
+	if want := []string{"bad", "blue", "comp.Card", "comp.Row", "ext", "good", "hash", "loop.A", "loop.B", "over", "util.Fmt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("modules = %v, want %v", names, want)
+	}
+	if s := LintSummarize(list); *s != (LintSummary{Modules: 11, Errors: 3, Warnings: 7}) {
+		t.Errorf("summary = %s", s)
+	}
+	if Exist(u.RootPath + "/juis") { //只检查，不写出
+		t.Error("lint writes output")
+	}
+}
@@ -0,0 +1,202 @@
+// metrics.go
+package util
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 请求用时的分段，单位秒
+ */
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+/**
+ * 用时分布
+ */
+type histogram struct {
+	counts []uint64 //小于等于各分段的数量
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, b := range durationBuckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+/**
+ * 模块的编译统计，不包括使用缓存的请求
+ */
+type compileStat struct {
+	count uint64
+	sum   float64
+	max   float64
+}
+
+/**
+ * 开发服务器的请求统计，/index.metrics 按Prometheus文本格式输出
+ */
+type accessMetrics struct {
+	sync.Mutex
+	requests  map[[3]string]uint64 //方法、类型、状态码到请求数量
+	bytes     map[string]uint64    //类型到响应字节数
+	durations map[string]*histogram
+	compiles  map[string]*compileStat //模块类名到编译统计
+}
+
+func newAccessMetrics() *accessMetrics {
+	return &accessMetrics{
+		requests:  make(map[[3]string]uint64),
+		bytes:     make(map[string]uint64),
+		durations: make(map[string]*histogram),
+		compiles:  make(map[string]*compileStat),
+	}
+}
+
+/**
+ * 记录一次请求
+ */
+func (m *accessMetrics) observe(method string, kind string, status int, bytes int64, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.requests[[3]string{method, kind, strconv.Itoa(status)}]++
+	m.bytes[kind] += uint64(bytes)
+	h := m.durations[kind]
+	if h == nil {
+		h = &histogram{}
+		m.durations[kind] = h
+	}
+	h.observe(d.Seconds())
+}
+
+/**
+ * 记录一次模块编译
+ */
+func (m *accessMetrics) observeCompile(className string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	c := m.compiles[className]
+	if c == nil {
+		c = &compileStat{}
+		m.compiles[className] = c
+	}
+	s := d.Seconds()
+	c.count++
+	c.sum += s
+	if s > c.max {
+		c.max = s
+	}
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/**
+ * 标签，值按Prometheus的规则转义
+ */
+func promLabels(pairs ...string) string {
+	sb := &strings.Builder{}
+	sb.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(pairs[i] + `="` + labelReplacer.Replace(pairs[i+1]) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+ * 按Prometheus文本格式输出
+ */
+func (m *accessMetrics) writeTo(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+	fmt.Fprintln(w, "# HELP jus_http_requests_total Number of HTTP requests by method, kind and status.")
+	fmt.Fprintln(w, "# TYPE jus_http_requests_total counter")
+	keys := make([][3]string, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "jus_http_requests_total%s %d\n", promLabels("method", k[0], "kind", k[1], "status", k[2]), m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP jus_http_response_bytes_total Bytes written in response bodies by kind.")
+	fmt.Fprintln(w, "# TYPE jus_http_response_bytes_total counter")
+	for _, k := range sortedKeys(m.bytes) {
+		fmt.Fprintf(w, "jus_http_response_bytes_total%s %d\n", promLabels("kind", k), m.bytes[k])
+	}
+
+	fmt.Fprintln(w, "# HELP jus_http_request_duration_seconds Time to serve a request by kind.")
+	fmt.Fprintln(w, "# TYPE jus_http_request_duration_seconds histogram")
+	for _, k := range sortedKeys(m.durations) {
+		h := m.durations[k]
+		for i, b := range durationBuckets {
+			fmt.Fprintf(w, "jus_http_request_duration_seconds_bucket%s %d\n", promLabels("kind", k, "le", promFloat(b)), h.counts[i])
+		}
+		fmt.Fprintf(w, "jus_http_request_duration_seconds_bucket%s %d\n", promLabels("kind", k, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "jus_http_request_duration_seconds_sum%s %s\n", promLabels("kind", k), promFloat(h.sum))
+		fmt.Fprintf(w, "jus_http_request_duration_seconds_count%s %d\n", promLabels("kind", k), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP jus_module_compile_seconds Time to compile a module, cache hits excluded.")
+	fmt.Fprintln(w, "# TYPE jus_module_compile_seconds summary")
+	modules := sortedKeys(m.compiles)
+	for _, k := range modules {
+		c := m.compiles[k]
+		fmt.Fprintf(w, "jus_module_compile_seconds_sum%s %s\n", promLabels("module", k), promFloat(c.sum))
+		fmt.Fprintf(w, "jus_module_compile_seconds_count%s %d\n", promLabels("module", k), c.count)
+	}
+	fmt.Fprintln(w, "# HELP jus_module_compile_seconds_max Slowest compile of a module.")
+	fmt.Fprintln(w, "# TYPE jus_module_compile_seconds_max gauge")
+	for _, k := range modules {
+		fmt.Fprintf(w, "jus_module_compile_seconds_max%s %s\n", promLabels("module", k), promFloat(m.compiles[k].max))
+	}
+}
+
+/**
+ * 输出请求统计
+ */
+func (u *JusServer) metricsEvt(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	u.metrics.writeTo(w)
+}
@@ -0,0 +1,352 @@
+// minify.go
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+/**
+ * 发布时压缩脚本，工程中 release-minify 设置
+ * 在MScript的标签流上处理：去掉注释和多余的空白，缩短私有域（__pri__、__inpri__）中的成员名称
+ * 同一个脚本中的所有私有域共用一张名称表，内部class引用外部私有成员时名称保持一致
+ */
+type minifier struct {
+	names map[string]string //私有成员原名称到短名称
+	count int
+}
+
+/**
+ * 私有域中的成员引用，例如 __pri__.count
+ */
+var priMember = regexp.MustCompile(`(^|[^\w$])(__pri__|__inpri__)\.([A-Za-z_$][\w$]*)`)
+
+/**
+ * 以私有域结尾，后面的 . 和名称在其它标签中
+ */
+var priScope = regexp.MustCompile(`(^|[^\w$])(__pri__|__inpri__)$`)
+
+/**
+ * 不缩短的私有成员，init由生成的构造函数按名称调用
+ */
+var minifyKeep = map[string]bool{"init": true}
+
+func newMinifier() *minifier {
+	return &minifier{names: make(map[string]string, 20)}
+}
+
+/**
+ * 私有成员的短名称，同一名称每次返回相同的结果
+ */
+func (m *minifier) rename(name string) string {
+	if minifyKeep[name] {
+		return name
+	}
+	if v, ok := m.names[name]; ok {
+		return v
+	}
+	v := ""
+	for {
+		v = shortName(m.count)
+		m.count++
+		if !minifyKeep[v] && !jsReserved[v] {
+			break
+		}
+	}
+	m.names[name] = v
+	return v
+}
+
+const shortChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+/**
+ * 第n个短名称：a..Z、aa..ZZ ...
+ */
+func shortName(n int) string {
+	v := ""
+	for {
+		v = string(shortChars[n%len(shortChars)]) + v
+		n = n/len(shortChars) - 1
+		if n < 0 {
+			return v
+		}
+	}
+}
+
+var jsReserved = map[string]bool{"do": true, "if": true, "in": true, "for": true, "let": true, "new": true, "try": true, "var": true}
+
+/**
+ * 压缩标签列表
+ * @param lst		标签列表
+ * @param nested	内部class等已经输出过的标签，内容不再处理
+ * @return 压缩后的标签列表，标签的源码位置不变
+ */
+func (m *minifier) Tags(lst []*Tag, nested map[*Tag][]codeMark) []*Tag {
+	out := make([]*Tag, 0, len(lst))
+	gap := 0       //前面被去掉的空白，1:空格 2:换行
+	last := ""     //上一个输出的内容
+	scope := false //上一个标签以私有域名称结尾
+	dot := false   //上一个标签是私有域名称后的 .
+	for _, t := range lst {
+		if t.TagType < -1 { //注释
+			continue
+		}
+		value := t.Value
+		trail := 0
+		_, isNested := nested[t]
+		literal := isNested || t.TagType == 7 || t.TagType == 12 || (t.TagType == 1 && isQuoted(value))
+		if !literal {
+			if strings.TrimSpace(value) == "" {
+				gap = maxGap(gap, value)
+				continue
+			}
+			trim := strings.TrimLeft(value, " \t\r\n")
+			gap = maxGap(gap, value[0:len(value)-len(trim)])
+			value = strings.TrimRight(trim, " \t\r\n")
+			trail = maxGap(0, trim[len(value):])
+			if dot && t.TagType == 0 && isIdent(value) { //__pri__ . name 分成多个标签
+				value = m.rename(value)
+			}
+			dot = scope && t.TagType == 9 && value == "."
+			value = priMember.ReplaceAllStringFunc(value, func(v string) string {
+				s := priMember.FindStringSubmatch(v)
+				return s[1] + s[2] + "." + m.rename(s[3])
+			})
+			scope = priScope.MatchString(value)
+		} else {
+			scope, dot = false, false
+		}
+		if sep := separator(gap, last, value); sep == " " {
+			out = append(out, &Tag{Value: sep, TagType: -1})
+		} else if sep != "" {
+			out = append(out, &Tag{Value: sep, TagType: 5})
+		}
+		if value != t.Value {
+			c := *t
+			c.Value = value
+			t = &c
+		}
+		out = append(out, t)
+		last = value
+		gap = trail
+	}
+	if gap == 2 { //后面还会拼接生成的代码，例如Getter Setter
+		out = append(out, &Tag{Value: "\n", TagType: 5})
+	} else if gap == 1 {
+		out = append(out, &Tag{Value: " ", TagType: -1})
+	}
+	return out
+}
+
+func isQuoted(value string) bool {
+	return len(value) > 0 && strings.IndexByte("'\"`", value[0]) >= 0
+}
+
+func isIdent(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if !isIdentChar(value[i]) {
+			return false
+		}
+	}
+	return len(value) > 0
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 0x80 || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+/**
+ * 空白的类型，1:空格 2:换行
+ */
+func maxGap(gap int, value string) int {
+	if strings.ContainsAny(value, "\r\n") {
+		return 2
+	}
+	if value != "" && gap == 0 {
+		return 1
+	}
+	return gap
+}
+
+/**
+ * 去掉空白后两段内容之间需要保留的分隔符
+ * 换行只在前后明显不会自动补分号时去掉，空格只在连接后会改变含义时保留
+ */
+func separator(gap int, last string, next string) string {
+	if gap == 0 || last == "" || next == "" {
+		return ""
+	}
+	a, b := last[len(last)-1], next[0]
+	if gap == 2 && !strings.ContainsRune(";{,(", rune(a)) && !strings.ContainsRune("}),;.", rune(b)) {
+		return "\n"
+	}
+	if (isIdentChar(a) && isIdentChar(b)) || (a == b && (a == '+' || a == '-')) || (a == '/' && (b == '/' || b == '*')) || (a >= '0' && a <= '9' && b == '.') {
+		return " "
+	}
+	return ""
+}
+
+//--------------------------------CSS----------------------------------------
+
+/**
+ * 一条样式规则
+ */
+type cssRule struct {
+	selecter string
+	value    string //包括大括号
+}
+
+/**
+ * 去掉CSS注释，字符串中的内容不变
+ */
+func stripCSSComments(css string) string {
+	sb := strings.Builder{}
+	var quote byte
+	for i := 0; i < len(css); i++ {
+		ch := css[i]
+		if quote != 0 {
+			if ch == '\\' && i+1 < len(css) {
+				sb.WriteByte(ch)
+				i++
+				ch = css[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		} else if ch == '"' || ch == '\'' {
+			quote = ch
+		} else if ch == '/' && i+1 < len(css) && css[i+1] == '*' {
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				break
+			}
+			i += end + 3
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+/**
+ * 压缩规则内容，去掉多余的空白和完全相同的重复声明，重复的声明保留最后一条
+ * 包含嵌套规则时只合并空白
+ * @param value	规则内容，包括大括号
+ */
+func minifyCSSValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '{' || value[len(value)-1] != '}' {
+		return collapseCSSSpace(value)
+	}
+	body := value[1 : len(value)-1]
+	if strings.ContainsAny(body, "{}") {
+		return collapseCSSSpace(value)
+	}
+	decls := make([]string, 0, 8)
+	for _, d := range splitCSS(body, ';') {
+		n := strings.IndexByte(d, ':')
+		if n == -1 {
+			if d = collapseCSSSpace(d); d != "" {
+				decls = append(decls, d)
+			}
+			continue
+		}
+		decls = append(decls, strings.TrimSpace(d[0:n])+":"+collapseCSSSpace(d[n+1:]))
+	}
+	last := make(map[string]int, len(decls))
+	for i, d := range decls {
+		last[d] = i
+	}
+	lst := make([]string, 0, len(decls))
+	for i, d := range decls {
+		if last[d] == i {
+			lst = append(lst, d)
+		}
+	}
+	return "{" + strings.Join(lst, ";") + "}"
+}
+
+/**
+ * 按分隔符拆分，字符串和括号中的分隔符不拆分，例如url(data:...;base64,...)
+ */
+func splitCSS(value string, sep byte) []string {
+	lst := make([]string, 0, 8)
+	var quote byte
+	level, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			level++
+		case ch == ')':
+			level--
+		case ch == sep && level == 0:
+			lst = append(lst, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(lst, value[start:])
+}
+
+/**
+ * 连续的空白合并为一个空格，字符串中的内容不变
+ */
+func collapseCSSSpace(value string) string {
+	sb := strings.Builder{}
+	var quote byte
+	space := false
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if quote == 0 && (ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n') {
+			space = true
+			continue
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		if quote != 0 {
+			if ch == '\\' && i+1 < len(value) {
+				sb.WriteByte(ch)
+				i++
+				ch = value[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		} else if ch == '"' || ch == '\'' {
+			quote = ch
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+/**
+ * 合并规则：选择器和内容都相同的规则只保留最后一条，相邻的规则内容相同时合并选择器
+ * 只合并相邻的规则，不改变样式的层叠顺序
+ */
+func mergeCSSRules(rules []cssRule) []cssRule {
+	last := make(map[cssRule]int, len(rules))
+	for i, r := range rules {
+		last[r] = i
+	}
+	lst := make([]cssRule, 0, len(rules))
+	for i, r := range rules {
+		if last[r] != i || r.value == "{}" {
+			continue
+		}
+		if n := len(lst) - 1; n >= 0 && lst[n].value == r.value && r.selecter != "" && lst[n].selecter != "" && r.selecter[0] != '@' && lst[n].selecter[0] != '@' {
+			lst[n].selecter += "," + r.selecter
+			continue
+		}
+		lst = append(lst, r)
+	}
+	return lst
+}
@@ -0,0 +1,81 @@
+// minify_test.go
+package util
+
+import "testing"
+
+/**
+ * 按发布压缩的方式处理一段脚本
+ */
+func minifyJS(m *minifier, js string) string {
+	ms := &MScript{}
+	ms.ReadFromString(js)
+	return ms.ToStringFrom(m.Tags(ms.lst, nil))
+}
+
+func TestMinifySeparator(t *testing.T) {
+	//换行只在不会改变自动补分号的结果时去掉
+	tests := []struct {
+		js, want string
+	}{
+		{"function f(){\n\treturn\n\tx;\n}", "function f(){return\nx;}"}, //return后换行返回undefined
+		{"a\n++b;", "a\n++b;"},                             //++属于下一行
+		{"a = b\n/re+/g.test(c);", "a=b\n/re+/g.test(c);"}, //正则表达式前的换行
+		{"var a = 1\nvar b = 2;", "var a=1\nvar b=2;"},
+		{"var a = 1;\nvar b = 2;", "var a=1;var b=2;"},
+		{"if (a) {\n\tb();\n}\nc();", "if(a){b();}\nc();"},
+		{"x = a - -b; y = a + +b;", "x=a- -b;y=a+ +b;"}, //连接后会变成 -- ++
+		{"z = 1 .toString();", "z=1 .toString();"},
+		{"var s = 'a  b'; // c\n/* d */ s = s;", "var s='a  b';s=s;"},
+	}
+	for _, v := range tests {
+		if got := minifyJS(newMinifier(), v.js); got != v.want {
+			t.Errorf("%q = %q, want %q", v.js, got, v.want)
+		}
+	}
+}
+
+func TestMinifyPrivate(t *testing.T) {
+	tests := []struct {
+		js, want string
+	}{
+		{"__pri__.count = 1;\n__pri__.count++;\n__inpri__.name = __pri__.count;", "__pri__.a=1;__pri__.a++;__inpri__.b=__pri__.a;"},
+		{"__pri__ . total = 2;\n__inpri__ . total++;", "__pri__.a=2;__inpri__.a++;"}, //名称和.分成多个标签
+		{"var s = \"__pri__.count\", q = '__inpri__.count'; __pri__.count = s;", "var s=\"__pri__.count\",q='__inpri__.count';__pri__.a=s;"},
+		{"// __pri__.count\n/* __inpri__.name */ __pri__.size = 1;", "__pri__.a=1;"}, //注释中的名称不占用短名称
+		{"var r = /__pri__.x/g;\n__pri__.x = r;", "var r=/__pri__.x/g;__pri__.a=r;"},
+		{"__pri__.init = function(){};\n__inpri__.init();\n__pri__.total = 2;", "__pri__.init=function f1(){};__inpri__.init();__pri__.a=2;"},
+		{"this.__pri__.count = 1; my__pri__.count = 2;", "this.__pri__.a=1;my__pri__.count=2;"},
+	}
+	for _, v := range tests {
+		if got := minifyJS(newMinifier(), v.js); got != v.want {
+			t.Errorf("%q = %q, want %q", v.js, got, v.want)
+		}
+	}
+}
+
+func TestMinifyShared(t *testing.T) {
+	//同一个脚本的内部class共用名称表，引用外部私有成员时名称一致
+	m := newMinifier()
+	if got := minifyJS(m, "__pri__.first = 1;\n__pri__.second = 2;"); got != "__pri__.a=1;__pri__.b=2;" {
+		t.Fatalf("outer = %q", got)
+	}
+	if got := minifyJS(m, "__inpri__.third = __pri__.second;"); got != "__inpri__.c=__pri__.b;" {
+		t.Errorf("inner = %q", got)
+	}
+}
+
+func TestShortName(t *testing.T) {
+	for n, want := range map[int]string{0: "a", 25: "z", 26: "A", 51: "Z", 52: "aa", 53: "ab", 52 + 52*52: "aaa"} {
+		if got := shortName(n); got != want {
+			t.Errorf("shortName(%d) = %q, want %q", n, got, want)
+		}
+	}
+	m := newMinifier()
+	m.count = 4*52 + 14 //shortName为 do
+	if got := m.rename("x"); got != "dp" {
+		t.Errorf("rename skips reserved word: %q", got)
+	}
+	if got := m.rename("init"); got != "init" {
+		t.Errorf("rename(init) = %q", got)
+	}
+}
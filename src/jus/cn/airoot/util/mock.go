@@ -0,0 +1,400 @@
+// mock.go
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+/**
+ * 模拟接口
+ * .jus 中的 mock* 按方法和路径返回指定文件，可以设置状态码、延迟和响应头
+ * 工程的 mock 目录按路径对应文件，例如 GET /api/users/7 返回 mock/api/users/{id}.json
+ * 文件名以 .tmpl 结束时按 text/template 生成内容
+ */
+type mockRoute struct {
+	method   string        //请求方法，*匹配所有方法
+	segments []string      //路径分段，{name}为参数
+	file     string        //响应文件，相对于工程目录
+	status   int           //状态码
+	delay    time.Duration //响应前等待的时间
+	header   http.Header   //额外的响应头
+}
+
+/**
+ * 模拟接口列表
+ */
+type mockTable struct {
+	sync.RWMutex
+	routes []*mockRoute
+	dir    string //mock目录
+}
+
+/**
+ * 模板中可以使用的请求信息
+ */
+type mockRequest struct {
+	Method string
+	Path   string
+	Params map[string]string //路径参数
+	Query  url.Values
+	Header http.Header
+	Body   string
+	JSON   interface{} //请求体为JSON时解析后的内容
+}
+
+/**
+ * 模板函数
+ */
+var mockFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newMockTable() *mockTable {
+	return &mockTable{}
+}
+
+/**
+ * 路径按/分段，去掉首尾的/
+ */
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+/**
+ * 是否为路径参数 {name}
+ */
+func isParam(seg string) bool {
+	return len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}'
+}
+
+/**
+ * 解析 .jus 中的一条设置
+ * mock* <方法> <路径> <文件> [status=200] [delay=300ms] [type=内容类型] [header=名称:值]...
+ */
+func parseMockRoute(v []string) (*mockRoute, error) {
+	if len(v) < 3 {
+		return nil, fmt.Errorf("mock: need <method> <path> <file>")
+	}
+	r := &mockRoute{method: strings.ToUpper(v[0]), segments: splitPath(v[1]), file: v[2], status: 200, header: http.Header{}}
+	for _, o := range v[3:] {
+		n := strings.IndexByte(o, '=')
+		if n == -1 {
+			return nil, fmt.Errorf("mock %s: %s isn't name=value", v[1], o)
+		}
+		name, value := o[0:n], o[n+1:]
+		switch name {
+		case "status":
+			s, err := strconv.Atoi(value)
+			if err != nil || s < 100 || s > 999 {
+				return nil, fmt.Errorf("mock %s: bad status %s", v[1], value)
+			}
+			r.status = s
+		case "delay":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("mock %s: bad delay %s", v[1], value)
+			}
+			r.delay = d
+		case "type":
+			r.header.Set("Content-Type", value)
+		case "header":
+			k := strings.IndexByte(value, ':')
+			if k == -1 {
+				return nil, fmt.Errorf("mock %s: header %s isn't name:value", v[1], value)
+			}
+			r.header.Add(strings.TrimSpace(value[0:k]), strings.TrimSpace(value[k+1:]))
+		default:
+			return nil, fmt.Errorf("mock %s: unknown option %s", v[1], name)
+		}
+	}
+	return r, nil
+}
+
+/**
+ * 路径是否匹配，返回路径参数和匹配的固定分段数量
+ */
+func (r *mockRoute) match(method string, segments []string) (map[string]string, int) {
+	if (r.method != "*" && r.method != method) || len(segments) != len(r.segments) {
+		return nil, -1
+	}
+	params := make(map[string]string, 2)
+	exact := 0
+	for i, v := range r.segments {
+		if isParam(v) {
+			params[v[1:len(v)-1]] = segments[i]
+		} else if v == segments[i] {
+			exact++
+		} else {
+			return nil, -1
+		}
+	}
+	return params, exact
+}
+
+/**
+ * 重新设置模拟接口
+ * @param root	工程目录
+ * @param lst	.jus 中的 mock* 设置
+ */
+func (t *mockTable) load(root string, lst [][]string) {
+	routes := make([]*mockRoute, 0, len(lst))
+	for _, v := range lst {
+		r, err := parseMockRoute(v)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if !filepath.IsAbs(r.file) {
+			r.file = filepath.Join(root, r.file)
+		}
+		fmt.Println("mock", r.method, "/"+strings.Join(r.segments, "/"), "-->", r.file)
+		routes = append(routes, r)
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.routes = routes
+	t.dir = filepath.Join(root, "mock")
+}
+
+/**
+ * mock目录，发布时不复制
+ */
+func (t *mockTable) path() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.dir
+}
+
+/**
+ * 查找请求对应的模拟接口，.jus 中的设置优先，固定分段多的优先
+ */
+func (t *mockTable) find(method string, path string) (*mockRoute, map[string]string) {
+	segments := splitPath(path)
+	t.RLock()
+	defer t.RUnlock()
+	var found *mockRoute
+	var params map[string]string
+	best := -1
+	for _, r := range t.routes {
+		if p, n := r.match(method, segments); n > best {
+			found, params, best = r, p, n
+		}
+	}
+	if found != nil {
+		return found, params
+	}
+	if t.dir == "" || len(segments) == 0 {
+		return nil, nil
+	}
+	params = make(map[string]string, 2)
+	if file := findMockFile(t.dir, method, segments, params); file != "" {
+		return &mockRoute{method: method, file: file, status: 200, header: http.Header{}}, params
+	}
+	return nil, nil
+}
+
+/**
+ * 在mock目录中查找文件，固定名称优先于{参数}
+ * 最后一段对应 名称.方法.扩展名 或 名称.扩展名，指定方法的优先
+ */
+func findMockFile(dir string, method string, segments []string, params map[string]string) string {
+	lst, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	seg := segments[0]
+	if len(segments) > 1 {
+		for _, pass := range []bool{false, true} {
+			for _, fi := range lst {
+				name := fi.Name()
+				if !fi.IsDir() || (pass && !isParam(name)) || (!pass && name != seg) {
+					continue
+				}
+				if file := findMockFile(filepath.Join(dir, name), method, segments[1:], params); file != "" {
+					if pass {
+						params[name[1:len(name)-1]] = seg
+					}
+					return file
+				}
+			}
+		}
+		return ""
+	}
+	for _, pass := range []bool{false, true} {
+		for _, base := range []string{"." + method, ""} {
+			for _, fi := range lst {
+				name := fi.Name()
+				if fi.IsDir() {
+					continue
+				}
+				n := strings.TrimSuffix(name, ".tmpl")
+				n = strings.TrimSuffix(n, filepath.Ext(n))
+				if !strings.HasSuffix(n, base) {
+					continue
+				}
+				n = n[0 : len(n)-len(base)]
+				if base == "" && isMethodSuffix(n) { //其他方法的文件
+					continue
+				}
+				if (!pass && n == seg) || (pass && isParam(n)) {
+					if pass {
+						params[n[1:len(n)-1]] = seg
+					}
+					return filepath.Join(dir, name)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+/**
+ * 文件名是否以 .方法 结束，例如 users.POST
+ */
+func isMethodSuffix(name string) bool {
+	n := strings.LastIndexByte(name, '.')
+	if n == -1 || n == len(name)-1 {
+		return false
+	}
+	return strings.ToUpper(name[n+1:]) == name[n+1:]
+}
+
+/**
+ * 返回模拟接口的响应
+ */
+func (r *mockRoute) serve(w http.ResponseWriter, req *http.Request, params map[string]string) {
+	data, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		fmt.Println("mock:", err)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>404</h1>"))
+		return
+	}
+	name := r.file
+	if strings.HasSuffix(name, ".tmpl") {
+		name = strings.TrimSuffix(name, ".tmpl")
+		if data, err = renderMock(r.file, data, req, params); err != nil {
+			fmt.Println("mock:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(r.status)
+	w.Write(data)
+}
+
+/**
+ * 按模板生成响应内容
+ */
+func renderMock(file string, data []byte, req *http.Request, params map[string]string) ([]byte, error) {
+	tpl, err := template.New(filepath.Base(file)).Funcs(mockFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	m := &mockRequest{Method: req.Method, Path: req.URL.Path, Params: params, Query: req.URL.Query(), Header: req.Header, Body: string(body)}
+	json.Unmarshal(body, &m.JSON)
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/**
+ * 判断是否有模拟接口，在反向代理之前处理
+ */
+func (u *JusServer) hasMock(w http.ResponseWriter, req *http.Request) bool {
+	r, params := u.mocks.find(req.Method, req.URL.Path)
+	if r == nil {
+		return false
+	}
+	markAccess(w, accessMock)
+	r.serve(w, req, params)
+	return true
+}
+
+/**
+ * 从 .jus 中读取模拟接口
+ */
+func (u *JusServer) loadMock() {
+	lst := make([][]string, 0)
+	for _, v := range u.GetData() {
+		if len(v) > 0 && isMockAttr(v[0]) {
+			lst = append(lst, v[1:])
+		}
+	}
+	u.mocks.load(u.RootPath, lst)
+}
+
+/**
+ * 是否为模拟接口的设置，mock1、mock2 等
+ */
+func isMockAttr(name string) bool {
+	if !strings.HasPrefix(name, "mock") {
+		return false
+	}
+	_, err := strconv.Atoi(name[len("mock"):])
+	return len(name) == len("mock") || err == nil
+}
+
+/**
+ * 代理到本地目录时，相对路径按工程目录计算
+ */
+func (u *JusServer) localDir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(u.RootPath, dir)
+}
+
+/**
+ * 返回本地目录中的文件，不存在时返回404
+ * @param dir	本地目录
+ * @param name	相对于目录的路径
+ */
+func serveDir(w http.ResponseWriter, req *http.Request, dir string, name string) {
+	file := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))) //不能访问目录以外的文件
+	if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+		serveFile(w, req, file, fi)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("<h1>404</h1>"))
+}
@@ -0,0 +1,105 @@
+// mock_test.go
+package util
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMock(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus": strings.Join([]string{
+			"mock1 GET /api/users/{id} mock/user.json.tmpl status=201 delay=30ms header=X-Mock:1",
+			"mock2 * /api/users/me mock/me.json",
+			"mock3 POST /api/login mock/login.json.tmpl type=text/plain",
+			"pattern1 /api/ http://127.0.0.1:1/", //模拟接口优先于反向代理
+			"pattern2 /static/ static",
+		}, "\r\n"),
+		"mock/user.json.tmpl":         `{"id":"{{.Params.id}}","q":"{{.Query.Get "q"}}"}`,
+		"mock/me.json":                `{"id":"me"}`,
+		"mock/login.json.tmpl":        `{{.JSON.name}} {{json .Params}}`,
+		"mock/api/items.json":         `[1,2]`,
+		"mock/api/items.POST.json":    `{"created":true}`,
+		"mock/api/items/{id}.json":    `{"item":1}`,
+		"mock/api/items/{id}/tags.js": `tags`,
+		"static/a.txt":                "static a",
+	})
+	defer os.RemoveAll(u.RootPath)
+	tests := []struct {
+		method, url, body string
+		code              int
+		want              string
+		header            string //Content-Type
+	}{
+		{"GET", "/api/users/7?q=x", "", 201, `{"id":"7","q":"x"}`, "application/json"},
+		{"DELETE", "/api/users/me", "", 200, `{"id":"me"}`, "application/json"},
+		{"POST", "/api/login", `{"name":"jus"}`, 200, `jus {}`, "text/plain"},
+		{"GET", "/api/items", "", 200, `[1,2]`, "application/json"},
+		{"POST", "/api/items", "", 200, `{"created":true}`, "application/json"},
+		{"PUT", "/api/items", "", 200, `[1,2]`, "application/json"},
+		{"GET", "/api/items/3", "", 200, `{"item":1}`, "application/json"},
+		{"GET", "/api/items/3/tags", "", 200, `tags`, "text/javascript; charset=utf-8"},
+		{"GET", "/static/a.txt", "", 200, "static a", "text/plain; charset=utf-8"},
+		{"GET", "/static/none.txt", "", 404, "<h1>404</h1>", ""},
+		{"GET", "/static/../.jus", "", 404, "<h1>404</h1>", ""},
+	}
+	for _, v := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, v.url, strings.NewReader(v.body))
+		req.URL.Path = strings.Split(v.url, "?")[0] //httptest不清理路径中的..
+		start := time.Now()
+		u.root(w, req)
+		if w.Code != v.code || w.Body.String() != v.want {
+			t.Errorf("%s %s: %d %q, want %d %q", v.method, v.url, w.Code, w.Body.String(), v.code, v.want)
+		}
+		if v.header != "" && w.Header().Get("Content-Type") != v.header {
+			t.Errorf("%s %s: Content-Type %q, want %q", v.method, v.url, w.Header().Get("Content-Type"), v.header)
+		}
+		if v.code == 201 && (w.Header().Get("X-Mock") != "1" || time.Since(start) < 30*time.Millisecond) {
+			t.Errorf("%s %s: header %v, delay %v", v.method, v.url, w.Header(), time.Since(start))
+		}
+	}
+}
+
+func TestMockRouteParse(t *testing.T) {
+	for _, v := range [][]string{
+		{"GET", "/a"},
+		{"GET", "/a", "a.json", "status=abc"},
+		{"GET", "/a", "a.json", "delay=1"},
+		{"GET", "/a", "a.json", "header=X"},
+		{"GET", "/a", "a.json", "other=1"},
+		{"GET", "/a", "a.json", "status"},
+	} {
+		if _, err := parseMockRoute(v); err == nil {
+			t.Errorf("parseMockRoute(%q) = nil error", v)
+		}
+	}
+	for name, want := range map[string]bool{"mock": true, "mock1": true, "mock12": true, "mocks": false, "mock-a": false, "pattern1": false} {
+		if isMockAttr(name) != want {
+			t.Errorf("isMockAttr(%q) = %v", name, !want)
+		}
+	}
+}
+
+func TestReleaseMock(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                  "",
+		"code/index.html":       "<div>index</div>",
+		"mock/api/users.json":   `[{"id":7}]`,
+		"static/api/users.json": `[]`,
+	})
+	defer os.RemoveAll(u.RootPath)
+	_, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+
+	if Exist(filepath.Join(out, "mock")) { //模拟接口只在开发服务器中使用
+		t.Error("mock is copied to the release")
+	}
+	if !Exist(filepath.Join(out, "static", "api", "users.json")) {
+		t.Error("static file isn't copied")
+	}
+}
@@ -4,19 +4,11 @@ package util
 import (
 	"bytes"
 	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
 	"strconv"
 	"strings"
 )
 
-//---------------------------UName-----------------------------
-
-var __COUNT__ int = -1
-
-func getName() string {
-	__COUNT__++
-	return "a" + strconv.Itoa(__COUNT__)
-}
-
 //----------------------------Var-------------------------------
 
 type Var struct {
@@ -50,23 +42,24 @@ type Tag struct {
 	Value        string
 	TagType      int //-4:大注释,-3：中注释,-2:小注释,-1:隐含字符,0：字符，1：字符串,2：运算符,3:域操作符,4:语句结束符,5:换行符,6:数字,7:正则表达式,8:元素自动转换符,9点,10类型声明符,11:三目运算符,12:XML对象
 	Cls          string
-	PType        int  //参数域
-	IsClass      bool //是否为类
-	IsInnerClass bool //是否为内部类
-	IsKeyWord    bool //是否为关键字
-	IsStatic     bool //是否为全局变量
-	IsPublic     bool //是否为公开
-	IsFunction   bool //是否为声明函数
-	IsVar        bool //是否为声明变量
-	IsAttr       bool //是否为前引用的属性
-	IsParameter  bool //是否为参数
-	IsType       bool //是声明变量类型
-	IsParamValue bool //是否为函数参数默认值
-	IsObjectAttr bool //是否为JSON OBject
-	IsSet        bool //是否为Setter
-	IsGet        bool //是否为Getter
-	IsAnonymous  bool //是否为匿名函数
-	Note         *Tag //是否有注释
+	PType        int      //参数域
+	IsClass      bool     //是否为类
+	IsInnerClass bool     //是否为内部类
+	IsKeyWord    bool     //是否为关键字
+	IsStatic     bool     //是否为全局变量
+	IsPublic     bool     //是否为公开
+	IsFunction   bool     //是否为声明函数
+	IsVar        bool     //是否为声明变量
+	IsAttr       bool     //是否为前引用的属性
+	IsParameter  bool     //是否为参数
+	IsType       bool     //是声明变量类型
+	IsParamValue bool     //是否为函数参数默认值
+	IsObjectAttr bool     //是否为JSON OBject
+	IsSet        bool     //是否为Setter
+	IsGet        bool     //是否为Getter
+	IsAnonymous  bool     //是否为匿名函数
+	Note         *Tag     //是否有注释
+	Pos          Position //源码位置，相对于被解析的代码，转换时生成的标签没有位置
 }
 
 //-------------------------Class----------------------
@@ -135,6 +128,10 @@ type MScript struct {
 	tag        *Tag
 	defNode    *Tag //被定义文本注释
 	fc         int  //匿名函数递增变量
+	names      *int //默认参数临时变量的计数器，同一个根模块编译的脚本共用，为nil时只在本脚本中计数
+
+	diagnostics Diagnostics //解析时的诊断信息
+	li          lineIndex   //行首位置表，用于计算诊断信息的行列号
 }
 
 /**
@@ -144,6 +141,7 @@ type MScript struct {
  */
 func (m *MScript) ReadFromString(js string) {
 	m.tag = &Tag{Value: "", TagType: -99}
+	m.li = nil
 	m.domainList = make(map[string]*TagSet, 10)
 
 	//00装入关键字
@@ -160,6 +158,7 @@ func (m *MScript) ReadFromString(js string) {
 	var p *Tag = nil
 	var tp *Tag = nil
 	tag := make([]rune, 0, 1000)
+	tagStart := 0 //当前字符组的开始位置
 	tType := 0
 	for m.position < codeLength {
 		ch = m.code[m.position]
@@ -175,12 +174,14 @@ func (m *MScript) ReadFromString(js string) {
 			nt, err := m.isCareNote()
 			if err == nil {
 				if nt != 2 {
+					start := m.position - 1
 					tp = &Tag{Value: m.readCareNote(nt), TagType: nt}
+					tp.Pos = Position{Start: start, End: m.position}
 					m.lst = append(m.lst, tp)
 					continue
 				}
 			} else {
-				fmt.Println("MScript: read note has errors.")
+				m.errorf(m.position-1, "%s", err.Error())
 				continue
 			}
 
@@ -193,13 +194,15 @@ func (m *MScript) ReadFromString(js string) {
 				} else {
 					tType = 0
 				}
-				p = &Tag{Value: string(tag), TagType: tType}
+				p = &Tag{Value: string(tag), TagType: tType, Pos: Position{Start: tagStart, End: tagStart + len(tag)}}
 
 				m.lst = append(m.lst, p)
 				tag = tag[0:0]
 			}
 			m.position--
+			start := m.position
 			tp = &Tag{Value: m.ReadString(), TagType: 7}
+			tp.Pos = Position{Start: start, End: m.position}
 			m.lst = append(m.lst, tp)
 			continue
 		}
@@ -211,15 +214,17 @@ func (m *MScript) ReadFromString(js string) {
 				} else {
 					tType = 0
 				}
-				p = &Tag{Value: string(tag), TagType: tType}
+				p = &Tag{Value: string(tag), TagType: tType, Pos: Position{Start: tagStart, End: tagStart + len(tag)}}
 
 				m.lst = append(m.lst, p)
 				tag = tag[0:0]
 			}
 			m.position--
+			start := m.position
 			var tXML *HTML = nil
 			tXML, m.position = (&HTML{}).ReadOneBlock(m.code, m.position)
-			tp = &Tag{Value: ListToHTMLString(tXML.At(0).Child()), TagType: 12} //XML对象
+			m.diagnostics.Merge(tXML.Diagnostics(), "")
+			tp = &Tag{Value: ListToHTMLString(tXML.At(0).Child()), TagType: 12, Pos: Position{Start: start, End: m.position}} //XML对象
 			m.lst = append(m.lst, tp)
 			continue
 		}
@@ -231,13 +236,16 @@ func (m *MScript) ReadFromString(js string) {
 				} else {
 					tType = 0
 				}
-				p = &Tag{Value: string(tag), TagType: tType}
+				p = &Tag{Value: string(tag), TagType: tType, Pos: Position{Start: tagStart, End: tagStart + len(tag)}}
 
 				m.lst = append(m.lst, p)
 				tag = tag[0:0]
 			}
 			m.position--
-			m.lst = append(m.lst, &Tag{Value: m.ReadString(), TagType: 1})
+			start := m.position
+			tp = &Tag{Value: m.ReadString(), TagType: 1}
+			tp.Pos = Position{Start: start, End: m.position}
+			m.lst = append(m.lst, tp)
 			continue
 		}
 
@@ -248,11 +256,12 @@ func (m *MScript) ReadFromString(js string) {
 				} else {
 					tType = 0
 				}
-				p = &Tag{Value: string(tag), TagType: tType}
+				p = &Tag{Value: string(tag), TagType: tType, Pos: Position{Start: tagStart, End: tagStart + len(tag)}}
 				m.lst = append(m.lst, p)
 				tag = tag[0:0]
 			}
 			if ch == '!' || ch == '.' || ch == '\r' || ch == '\n' || ch == '{' || ch == '}' || ch == '(' || ch == ')' || ch == '[' || ch == ']' || ch == ';' || ch == ':' || ch == ',' || ch == '?' || ch == '>' || ch == '=' || ch == '<' || ch == '&' || ch == '|' || ch == '%' || ch == ' ' || ch == '\t' || ch == '+' || ch == '-' || ch == '*' || ch == '/' || ch == '#' {
+				n := len(m.lst)
 				if ch == ' ' || ch == '\t' {
 					m.lst = append(m.lst, &Tag{Value: string(ch), TagType: -1})
 				} else if ch == ';' {
@@ -268,11 +277,14 @@ func (m *MScript) ReadFromString(js string) {
 				} else {
 					m.lst = append(m.lst, &Tag{Value: string(ch), TagType: 2})
 				}
-
+				m.lst[n].Pos = Position{Start: m.position - 1, End: m.position}
 			}
 
 			continue
 		}
+		if len(tag) == 0 {
+			tagStart = m.position - 1
+		}
 		tag = append(tag, ch)
 	}
 
@@ -282,7 +294,7 @@ func (m *MScript) ReadFromString(js string) {
 		} else {
 			tType = 0
 		}
-		p = &Tag{Value: string(tag), TagType: tType}
+		p = &Tag{Value: string(tag), TagType: tType, Pos: Position{Start: tagStart, End: tagStart + len(tag)}}
 		m.lst = append(m.lst, p)
 		tag = tag[0:0]
 	}
@@ -290,15 +302,20 @@ func (m *MScript) ReadFromString(js string) {
 	//02归拢数字
 	tlst := make([]*Tag, 0, 1000)
 	tag = tag[0:0]
+	var pos Position //归拢后的位置
 	for _, p := range m.lst {
 		if p.TagType == 9 || p.TagType == 6 {
+			if len(tag) == 0 {
+				pos.Start = p.Pos.Start
+			}
+			pos.End = p.Pos.End
 			tag = appendRunes(tag, []rune(p.Value))
 		} else {
 			if len(tag) != 0 {
 				if len(tag) == 1 {
-					tlst = append(tlst, &Tag{Value: string(tag), TagType: 9})
+					tlst = append(tlst, &Tag{Value: string(tag), TagType: 9, Pos: pos})
 				} else {
-					tlst = append(tlst, &Tag{Value: string(tag), TagType: 6})
+					tlst = append(tlst, &Tag{Value: string(tag), TagType: 6, Pos: pos})
 				}
 				tag = tag[0:0]
 			}
@@ -312,10 +329,14 @@ func (m *MScript) ReadFromString(js string) {
 	tag = tag[0:0]
 	for _, p := range m.lst {
 		if p.TagType == 2 {
+			if len(tag) == 0 {
+				pos.Start = p.Pos.Start
+			}
+			pos.End = p.Pos.End
 			tag = appendRunes(tag, []rune(p.Value))
 		} else {
 			if len(tag) != 0 {
-				tlst = append(tlst, &Tag{Value: string(tag), TagType: 2})
+				tlst = append(tlst, &Tag{Value: string(tag), TagType: 2, Pos: pos})
 				tag = tag[0:0]
 			}
 			tlst = append(tlst, p)
@@ -323,28 +344,40 @@ func (m *MScript) ReadFromString(js string) {
 	}
 
 	if len(tag) != 0 {
-		tlst = append(tlst, &Tag{Value: string(tag), TagType: 2})
+		tlst = append(tlst, &Tag{Value: string(tag), TagType: 2, Pos: pos})
 	}
 	tag = tag[0:0]
 	m.lst = tlst
 	tlst = tlst[0:0]
 	for _, p := range m.lst {
 		if p.TagType == 5 {
+			if len(tag) == 0 {
+				pos.Start = p.Pos.Start
+			}
+			pos.End = p.Pos.End
 			tag = appendRunes(tag, []rune(p.Value))
 		} else {
 			if len(tag) != 0 {
-				tlst = append(tlst, &Tag{Value: string(tag), TagType: 5})
+				tlst = append(tlst, &Tag{Value: string(tag), TagType: 5, Pos: pos})
 				tag = tag[0:0]
 			}
 			tlst = append(tlst, p)
 		}
 	}
 	if len(tag) != 0 {
-		tlst = append(tlst, &Tag{Value: string(tag), TagType: 5})
+		tlst = append(tlst, &Tag{Value: string(tag), TagType: 5, Pos: pos})
 	}
 	m.lst = tlst
 	tlst = tlst[0:0]
 
+	//计算行列号
+	if m.li == nil {
+		m.li = newLineIndex(m.code)
+	}
+	for _, p := range m.lst {
+		p.Pos = m.li.span(p.Pos.Start, p.Pos.End)
+	}
+
 	//04重新归拢语句
 	var note *Tag = nil
 
@@ -464,6 +497,7 @@ func (m *MScript) readCareNote(noteType int) string {
 		}
 	}
 	if noteType == -3 || noteType == -4 {
+		start := m.position - 1
 		end := [2]rune{'*', '/'}
 		pos := 0
 		isNewLine := true
@@ -496,6 +530,9 @@ func (m *MScript) readCareNote(noteType int) string {
 			}
 			sb = append(sb, ch)
 		}
+		if pos != 2 {
+			m.errorf(start, "The Note isn't over.")
+		}
 	}
 	m.position = offset
 	return result
@@ -563,16 +600,19 @@ func (m *MScript) ToStringFrom(lst []*Tag) string {
  */
 func (m *MScript) ReadString() string {
 	sb := make([]rune, 0)
+	start := m.position
 	var t = m.code[m.position]
 	m.position++
 	var ch rune
 	r := false
+	closed := false
 	sb = append(sb, t)
 	for m.position < len(m.code) {
 		ch = m.code[m.position]
 		m.position++
 		sb = append(sb, ch)
 		if ch == t && !r {
+			closed = true
 			break
 		}
 		if ch == '\\' {
@@ -585,10 +625,32 @@ func (m *MScript) ReadString() string {
 			r = false
 		}
 	}
+	if !closed {
+		m.errorf(start, "%s isn't closed.", IfStr(t == '/', "The regular expression", "The string"))
+	}
 
 	return strings.Replace(string(sb), "\r\n", string(t)+" + "+string(t), -1)
 }
 
+/**
+ * 记录一条错误信息
+ * @param offset	错误在代码中的字符位置
+ */
+func (m *MScript) errorf(offset int, format string, a ...interface{}) {
+	if m.li == nil {
+		m.li = newLineIndex(m.code)
+	}
+	line, col := m.li.lineCol(offset)
+	m.diagnostics.Errorf("", line, col, format, a...)
+}
+
+/**
+ * 解析时的诊断信息
+ */
+func (m *MScript) Diagnostics() *Diagnostics {
+	return &m.diagnostics
+}
+
 /**
  * 读取数字
  * @return
@@ -1018,6 +1080,9 @@ func (m *MScript) copyTag(p *Tag, tag *Tag) {
 	p.IsFunction = tag.IsFunction
 	p.IsVar = tag.IsVar
 	p.IsClass = tag.IsClass
+	if !p.Pos.IsValid() {
+		p.Pos = tag.Pos
+	}
 }
 
 func (m *MScript) getName() string {
@@ -1025,6 +1090,18 @@ func (m *MScript) getName() string {
 	return "f" + strconv.Itoa(m.fc)
 }
 
+/**
+ * 默认参数临时变量的名称
+ */
+func (m *MScript) tempName() string {
+	if m.names == nil {
+		m.names = new(int)
+	}
+	name := "_a" + strconv.Itoa(*m.names)
+	*m.names++
+	return name
+}
+
 /**
  * 函数
  * @param lst
@@ -1155,7 +1232,7 @@ func (m *MScript) initFuncParam(lst []*Tag, out *[]*Tag) {
 		if !isArea && p.PType > 0 {
 
 			isArea = true
-			uname := "_" + getName()
+			uname := m.tempName()
 			t := &Tag{Value: uname, TagType: 0}
 			t.SetAttr(5, true)
 			mainLst = append(mainLst, t)
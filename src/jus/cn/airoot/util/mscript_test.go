@@ -0,0 +1,145 @@
+// mscript_test.go
+package util
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/**
+ * 标签转为 类型:值 的列表，空白标签忽略
+ */
+func tokens(m *MScript) string {
+	lst := make([]string, 0, len(m.GetData()))
+	for _, v := range m.GetData() {
+		if v.TagType == -1 {
+			continue
+		}
+		lst = append(lst, strconv.Itoa(v.TagType)+":"+v.Value)
+	}
+	return strings.Join(lst, " ")
+}
+
+func TestMScriptTokens(t *testing.T) {
+	tests := []struct {
+		js, want string
+	}{
+		{"var a = 10;", "0:var 0:a 2:= 6:10 4:;"},
+		{"x = 1.5;", "0:x 2:= 6:1.5 4:;"},
+		{"function f(x){return x+'s';}", "0:function 0:f 3:( 0:x 3:) 3:{ 0:return 0:x 2:+ 1:'s' 4:; 3:}"},
+		{"s = \"a\\\"b\";", "0:s 2:= 1:\"a\\\"b\" 4:;"},
+		{"a = /re/g.test(b) // c\n", "0:a 2:= 7:/re/ 0:g 9:. 0:test 3:( 0:b 3:) -2: c"},
+		{"a = b / c;", "0:a 2:= 0:b 2:/ 0:c 4:;"},
+		{"/** doc */\nclass A {}", "-4:doc  5:\n 0:class 0:A 3:{ 3:}"},
+		{"a\r\nb", "0:a 5:\r\n 0:b"},
+	}
+	for _, v := range tests {
+		m := &MScript{}
+		m.ReadFromString(v.js)
+		if got := tokens(m); got != v.want {
+			t.Errorf("%q:\n got %q\nwant %q", v.js, got, v.want)
+		}
+	}
+}
+
+func TestMScriptToString(t *testing.T) {
+	for _, js := range []string{
+		"var a = 1;",
+		"function f(x){return x+'s';}",
+		"class A { constructor(){} }",
+		"x = 1.5e3 + 0x1f;",
+		"let s = `t${a}`;",
+		"var 中文 = \"两个 😀\";",
+	} {
+		m := &MScript{}
+		m.ReadFromString(js)
+		if got := m.ToString(); got != js {
+			t.Errorf("ToString() = %q, want %q", got, js)
+		}
+	}
+}
+
+func TestMScriptDiagnostics(t *testing.T) {
+	tests := []struct {
+		js, message string
+		line, col   int
+	}{
+		{"var a = 1;\nvar s = \"abc;", "The string isn't closed.", 2, 9},
+		{"a = /abc", "The regular expression isn't closed.", 1, 5},
+		{"a;\n/* note", "The Note isn't over.", 2, 1},
+	}
+	for _, v := range tests {
+		m := &MScript{}
+		m.ReadFromString(v.js)
+		found := false
+		for _, d := range m.Diagnostics().List() {
+			if d.Severity == DiagError && d.Message == v.message && d.Line == v.line && d.Col == v.col {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: diagnostics = %v, want %q at %d:%d", v.js, m.Diagnostics().List(), v.message, v.line, v.col)
+		}
+	}
+}
+
+/**
+ * 第一个值为value的标签
+ */
+func findTag(m *MScript, value string) *Tag {
+	for _, v := range m.GetData() {
+		if v.Value == value {
+			return v
+		}
+	}
+	return nil
+}
+
+func TestMScriptPosition(t *testing.T) {
+	m := &MScript{}
+	m.ReadFromString("var a = 10;\r\n  f('s',\n\t/re/);\n/** 多行\n */ b = \"中\" + c;")
+	tests := []struct {
+		value     string
+		line, col int
+	}{
+		{"var", 1, 1},
+		{"10", 1, 9},
+		{"f", 2, 3},
+		{"'s'", 2, 5},
+		{"/re/", 3, 2},
+		{"b", 5, 5},
+		{"\"中\"", 5, 9},
+		{"c", 5, 15},
+	}
+	for _, v := range tests {
+		tag := findTag(m, v.value)
+		if tag == nil {
+			t.Errorf("%q not found", v.value)
+			continue
+		}
+		if tag.Pos.Line != v.line || tag.Pos.Col != v.col {
+			t.Errorf("%q: Pos = %v, want %d:%d", v.value, tag.Pos, v.line, v.col)
+		}
+	}
+}
+
+func TestMScriptPositionKept(t *testing.T) {
+	m := &MScript{}
+	m.ReadFromString("\n  x = 1;")
+	x := findTag(m, "x")
+	tests := []struct {
+		name      string
+		tag       *Tag
+		line, col int
+	}{
+		{"created", &Tag{Value: "x"}, 2, 3},
+		{"parsed", &Tag{Value: "x", Pos: Position{Line: 5, Col: 1}}, 5, 1},
+	}
+	for _, v := range tests {
+		m.copyTag(v.tag, x)
+		if v.tag.Pos.Line != v.line || v.tag.Pos.Col != v.col {
+			t.Errorf("%s: Pos = %v, want %d:%d", v.name, v.tag.Pos, v.line, v.col)
+		}
+	}
+}
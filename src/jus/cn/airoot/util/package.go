@@ -28,7 +28,7 @@ func (p *Package) uuid() string {
 	for i, v := range p.data {
 		if v == 0 {
 			if s == 1 {
-				return string(p.data[t:i])
+				return string(p.data[t+1 : i])
 			}
 			t = i
 			s++
@@ -43,7 +43,7 @@ func (p *Package) frame() string {
 	for i, v := range p.data {
 		if v == 0 {
 			if s == 2 {
-				return string(p.data[t:i])
+				return string(p.data[t+1 : i])
 			}
 			t = i
 			s++
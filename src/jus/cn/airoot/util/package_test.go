@@ -0,0 +1,36 @@
+// package_test.go
+package util
+
+import "testing"
+
+func TestPackage(t *testing.T) {
+	tests := []struct {
+		data                       string
+		router, uuid, frame, value string
+		dat                        string
+	}{
+		{"user1\x00id-1\x00f2\x00hello", "user1", "id-1", "f2", "hello", "\x00id-1\x00f2\x00hello"},
+		{"room*\x00\x00\x00消息 内容", "room*", "", "", "消息 内容", "\x00\x00\x00消息 内容"},
+		{"user1\x00id-1\x00f2\x00", "user1", "id-1", "f2", "", "\x00id-1\x00f2\x00"},
+		{"user1\x00id-1", "user1", "", "", "", "\x00id-1"},
+		{"user1", "", "", "", "", ""},
+	}
+	for _, v := range tests {
+		p := &Package{from: "God", data: []byte(v.data)}
+		if got := p.router(); got != v.router {
+			t.Errorf("router(%q) = %q, want %q", v.data, got, v.router)
+		}
+		if got := p.uuid(); got != v.uuid {
+			t.Errorf("uuid(%q) = %q, want %q", v.data, got, v.uuid)
+		}
+		if got := p.frame(); got != v.frame {
+			t.Errorf("frame(%q) = %q, want %q", v.data, got, v.frame)
+		}
+		if got := p.value(); got != v.value {
+			t.Errorf("value(%q) = %q, want %q", v.data, got, v.value)
+		}
+		if got := p.getDat(); got != v.dat {
+			t.Errorf("getDat(%q) = %q, want %q", v.data, got, v.dat)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// position.go
+package util
+
+import (
+	"sort"
+	"strconv"
+)
+
+/**
+ * 源码位置
+ * File为空时，位置相对于被解析的字符串
+ */
+type Position struct {
+	File  string //源文件路径
+	Start int    //开始字符位置
+	End   int    //结束字符位置，不包含
+	Line  int    //开始行号，从1开始，0表示未知
+	Col   int    //开始列号，从1开始
+}
+
+/**
+ * 是否记录了位置
+ */
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+/**
+ * 转为 file:line:col 格式
+ */
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
+	}
+	return s
+}
+
+/**
+ * 行首位置表，用于把字符位置换算为行列号
+ */
+type lineIndex []int
+
+func newLineIndex(code []rune) lineIndex {
+	li := lineIndex{0}
+	for i, ch := range code {
+		if ch == '\n' {
+			li = append(li, i+1)
+		}
+	}
+	return li
+}
+
+/**
+ * @param offset	字符位置
+ * @return 行号, 列号，均从1开始
+ */
+func (li lineIndex) lineCol(offset int) (int, int) {
+	if offset < 0 {
+		return 0, 0
+	}
+	n := sort.Search(len(li), func(i int) bool { return li[i] > offset }) - 1
+	return n + 1, offset - li[n] + 1
+}
+
+/**
+ * 生成一段字符区间的位置
+ */
+func (li lineIndex) span(start int, end int) Position {
+	line, col := li.lineCol(start)
+	return Position{Start: start, End: end, Line: line, Col: col}
+}
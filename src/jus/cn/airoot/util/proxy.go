@@ -0,0 +1,312 @@
+// proxy.go
+package util
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 反向代理的默认超时时间
+ */
+const defaultProxyTimeout = 30 * time.Second
+
+/**
+ * 一条代理规则
+ * 目标为http(s)、ws(s)地址时转发请求，否则为本地目录
+ */
+type proxyRoute struct {
+	prefix  string                 //路径前缀或域名
+	path    string                 //配置的目标
+	target  *url.URL               //转发地址，本地目录时为nil
+	handler *httputil.ReverseProxy //转发处理，创建规则时生成
+}
+
+/**
+ * 反向代理列表
+ * 域名规则来自 .jus 中的 proxy*，路径规则来自 pattern*，都按最长前缀匹配
+ * 同一个目标地址共用一个连接池
+ */
+type proxyTable struct {
+	sync.RWMutex
+	hosts      []*proxyRoute              //按域名转发，不修改路径
+	paths      []*proxyRoute              //按路径前缀转发，去掉前缀后转发
+	transports map[string]*http.Transport //scheme://host 到连接池
+	timeout    time.Duration              //连接、TLS握手和等待响应头的超时时间
+	insecure   bool                       //不验证https目标的证书，用于自签名证书的测试环境
+}
+
+func newProxyTable() *proxyTable {
+	return &proxyTable{transports: make(map[string]*http.Transport, 4), timeout: defaultProxyTimeout}
+}
+
+/**
+ * 目标地址转为转发地址，ws(s)按http(s)转发，升级请求由ReverseProxy透传
+ * @return 本地目录时返回nil
+ */
+func proxyTarget(path string) (*url.URL, error) {
+	lower := strings.ToLower(path)
+	if !(Index(lower, "http://") == 0 || Index(lower, "https://") == 0 || Index(lower, "ws://") == 0 || Index(lower, "wss://") == 0) {
+		return nil, nil
+	}
+	target, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if target.Host == "" {
+		return nil, fmt.Errorf("%s: missing host", path)
+	}
+	switch strings.ToLower(target.Scheme) {
+	case "ws":
+		target.Scheme = "http"
+	case "wss":
+		target.Scheme = "https"
+	}
+	return target, nil
+}
+
+/**
+ * 目标地址的连接池，没有时创建，调用时已加锁
+ */
+func (t *proxyTable) transport(target *url.URL) *http.Transport {
+	key := target.Scheme + "://" + target.Host
+	if tr := t.transports[key]; tr != nil {
+		return tr
+	}
+	dialer := &net.Dialer{Timeout: t.timeout, KeepAlive: 30 * time.Second}
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   t.timeout,
+		ResponseHeaderTimeout: t.timeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: t.insecure},
+	}
+	t.transports[key] = tr
+	return tr
+}
+
+/**
+ * 创建规则
+ * @param prefix	路径前缀或域名
+ * @param path		目标地址或本地目录
+ * @param strip		转发时是否去掉路径前缀
+ */
+func (t *proxyTable) route(prefix string, path string, strip bool) (*proxyRoute, error) {
+	r := &proxyRoute{prefix: prefix, path: path}
+	target, err := proxyTarget(path)
+	if err != nil || target == nil {
+		return r, err
+	}
+	r.target = target
+	r.handler = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			rewriteProxyRequest(req, target, IfStr(strip, prefix, ""))
+		},
+		Transport:    t.transport(target),
+		ErrorHandler: proxyError,
+	}
+	return r, nil
+}
+
+/**
+ * 增加路径规则，前缀相同时替换
+ */
+func (t *proxyTable) addPath(prefix string, path string) error {
+	t.Lock()
+	defer t.Unlock()
+	r, err := t.route(prefix, path, true)
+	if err != nil {
+		return err
+	}
+	t.paths = addRoute(t.paths, r)
+	return nil
+}
+
+/**
+ * 增加域名规则
+ * @param pattern	域名地址，例如 http://api.example.com
+ */
+func (t *proxyTable) addHost(pattern string, path string) error {
+	u, err := url.Parse(pattern)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if host == "" { //只写了域名
+		host = pattern
+	}
+	t.Lock()
+	defer t.Unlock()
+	r, err := t.route(host, path, false)
+	if err != nil {
+		return err
+	}
+	t.hosts = addRoute(t.hosts, r)
+	return nil
+}
+
+/**
+ * 加入规则，保持前缀从长到短排列
+ */
+func addRoute(lst []*proxyRoute, r *proxyRoute) []*proxyRoute {
+	for i, v := range lst {
+		if v.prefix == r.prefix {
+			lst[i] = r
+			return lst
+		}
+	}
+	lst = append(lst, r)
+	sort.SliceStable(lst, func(i, j int) bool {
+		return len(lst[i].prefix) > len(lst[j].prefix)
+	})
+	return lst
+}
+
+/**
+ * 按路径最长前缀查找规则，前缀只在 / 处结束，/api 匹配 /api 和 /api/users，不匹配 /apiv2
+ */
+func (t *proxyTable) matchPath(path string) *proxyRoute {
+	t.RLock()
+	defer t.RUnlock()
+	for _, v := range t.paths {
+		if hasPrefixAt(path, v.prefix, "/") {
+			return v
+		}
+	}
+	return nil
+}
+
+/**
+ * 按域名最长前缀查找规则，域名相同或只多了端口时匹配
+ */
+func (t *proxyTable) matchHost(host string) *proxyRoute {
+	t.RLock()
+	defer t.RUnlock()
+	for _, v := range t.hosts {
+		if hasPrefixAt(host, v.prefix, ":") {
+			return v
+		}
+	}
+	return nil
+}
+
+/**
+ * prefix是否为s的前缀，并且在分隔符处结束
+ * @param sep	分隔符，prefix以它结尾或s中紧接着它时匹配
+ */
+func hasPrefixAt(s string, prefix string, sep string) bool {
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	return len(s) == len(prefix) || strings.HasSuffix(prefix, sep) || strings.HasPrefix(s[len(prefix):], sep)
+}
+
+/**
+ * 清空规则并设置超时，已有的连接池关闭空闲连接后丢弃
+ */
+func (t *proxyTable) reset(timeout time.Duration, insecure bool) {
+	t.Lock()
+	defer t.Unlock()
+	for _, tr := range t.transports {
+		tr.CloseIdleConnections()
+	}
+	t.hosts, t.paths = nil, nil
+	t.transports = make(map[string]*http.Transport, 4)
+	t.timeout, t.insecure = timeout, insecure
+}
+
+/**
+ * 转发前修改请求，Host改为目标地址，原地址写在X-Forwarded-*中
+ * @param strip	去掉的路径前缀，写在X-Forwarded-Prefix中
+ */
+func rewriteProxyRequest(req *http.Request, target *url.URL, strip string) {
+	host, proto := req.Host, "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	path, rawPath := req.URL.Path, req.URL.RawPath
+	if strip != "" {
+		path = stripPrefix(path, strip)
+		if rawPath != "" {
+			rawPath = stripPrefix(rawPath, strip)
+		}
+		if prefix := strings.TrimSuffix(strip, "/"); prefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+		}
+	}
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = singleJoiningSlash(target.Path, path)
+	if rawPath != "" { //保留 %2F 等转义
+		req.URL.RawPath = singleJoiningSlash(target.EscapedPath(), rawPath)
+	}
+	if target.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+	}
+	req.Host = target.Host
+	req.Header.Set("X-Forwarded-Host", host)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "") //不使用Go默认的User-Agent
+	}
+}
+
+/**
+ * 去掉路径前缀，结果以/开始
+ */
+func stripPrefix(path string, prefix string) string {
+	path = strings.TrimPrefix(path, prefix)
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	return path
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+/**
+ * 转发失败时返回502，等待响应超时时返回504
+ */
+func proxyError(w http.ResponseWriter, req *http.Request, err error) {
+	fmt.Println("proxy:", req.Method, req.URL.String(), err)
+	status := http.StatusBadGateway
+	var e net.Error
+	if errors.As(err, &e) && e.Timeout() {
+		status = http.StatusGatewayTimeout
+	}
+	w.WriteHeader(status)
+	w.Write([]byte("<h1>" + http.StatusText(status) + "</h1>"))
+}
+
+/**
+ * 转发请求
+ */
+func (r *proxyRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
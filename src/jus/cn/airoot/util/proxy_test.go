@@ -0,0 +1,196 @@
+// proxy_test.go
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestProxyMatch(t *testing.T) {
+	p := newProxyTable()
+	for _, v := range []string{"/", "/api/", "/api/v2/", "/apis"} {
+		p.addPath(v, "http://127.0.0.1:1"+v)
+	}
+	p.addPath("/api/", "http://127.0.0.1:2/") //相同前缀替换
+	p.addHost("http://api.example.com", "http://127.0.0.1:3")
+	p.addHost("api.example.com.cn", "http://127.0.0.1:4")
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/v2/users", "/api/v2/"},
+		{"/api/v1/users", "/api/"},
+		{"/apis/x", "/apis"},
+		{"/index.html", "/"},
+	}
+	for _, v := range tests {
+		if r := p.matchPath(v.path); r == nil || r.prefix != v.want {
+			t.Errorf("matchPath(%q) = %v, want %q", v.path, r, v.want)
+		}
+	}
+	if r := p.matchPath("/api/x"); r.target.Host != "127.0.0.1:2" {
+		t.Errorf("/api/ target = %s", r.target)
+	}
+	if r := p.matchHost("api.example.com.cn:8080"); r == nil || r.target.Host != "127.0.0.1:4" {
+		t.Errorf("matchHost = %v", r)
+	}
+	if r := p.matchHost("www.example.com"); r != nil {
+		t.Errorf("matchHost(www) = %v", r)
+	}
+}
+
+func TestProxyMatchBoundary(t *testing.T) {
+	//前缀只在 / 或端口处结束，不匹配更长的名称
+	p := newProxyTable()
+	for _, v := range []string{"/api", "/static/", "/v1/api"} {
+		p.addPath(v, "http://127.0.0.1:1"+v)
+	}
+	p.addHost("api.example.com", "http://127.0.0.1:3")
+	paths := []struct {
+		path, want string
+	}{
+		{"/api", "/api"},
+		{"/api/", "/api"},
+		{"/api/users", "/api"},
+		{"/apiv2", ""},
+		{"/apiv2/users", ""},
+		{"/ap", ""},
+		{"/static/a.js", "/static/"},
+		{"/static", ""},
+		{"/staticx/a.js", ""},
+		{"/v1/api/x", "/v1/api"},
+		{"/v1/apis", ""},
+	}
+	for _, v := range paths {
+		got := ""
+		if r := p.matchPath(v.path); r != nil {
+			got = r.prefix
+		}
+		if got != v.want {
+			t.Errorf("matchPath(%q) = %q, want %q", v.path, got, v.want)
+		}
+	}
+	hosts := []struct {
+		host string
+		ok   bool
+	}{
+		{"api.example.com", true},
+		{"api.example.com:8080", true},
+		{"api.example.com.cn", false},
+		{"api.example.community", false},
+		{"www.api.example.com", false},
+	}
+	for _, v := range hosts {
+		if r := p.matchHost(v.host); (r != nil) != v.ok {
+			t.Errorf("matchHost(%q) = %v, want %v", v.host, r, v.ok)
+		}
+	}
+}
+
+/**
+ * 上游服务，返回收到的请求信息
+ */
+func echoUpstream(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("X-Upstream", "1")
+	io.WriteString(w, strings.Join([]string{req.Host, req.URL.RequestURI(), req.Header.Get("X-Forwarded-Host"),
+		req.Header.Get("X-Forwarded-Proto"), req.Header.Get("X-Forwarded-Prefix"), req.Header.Get("X-Forwarded-For")}, "|"))
+}
+
+func proxyServer(timeout time.Duration, insecure bool) *JusServer {
+	u := &JusServer{proxies: newProxyTable(), fixtures: newFixtureStore(), access: newAccessLog(), metrics: newAccessMetrics()}
+	u.proxies.reset(timeout, insecure)
+	return u
+}
+
+func TestProxyForward(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(echoUpstream))
+	defer up.Close()
+	ups := httptest.NewTLSServer(http.HandlerFunc(echoUpstream))
+	defer ups.Close()
+
+	u := proxyServer(time.Second, true)
+	u.AddProxy("/api/", up.URL+"/base?k=1")
+	u.AddProxy("/secure/", ups.URL)
+	host := func(s string) string { return strings.TrimPrefix(strings.TrimPrefix(s, "http://"), "https://") }
+	tests := []struct {
+		url, want string
+	}{
+		{"http://dev.local/api/users?id=2", host(up.URL) + "|/base/users?k=1&id=2|dev.local|http|/api|192.0.2.1"},
+		{"http://dev.local/secure/a%2Fb", host(ups.URL) + "|/a%2Fb|dev.local|http|/secure|192.0.2.1"},
+	}
+	for _, v := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.url, nil)
+		if !u.hasUrl(req.URL, w, req) {
+			t.Fatalf("%s: not proxied", v.url)
+		}
+		if w.Code != 200 || w.Body.String() != v.want || w.Header().Get("X-Upstream") != "1" {
+			t.Errorf("%s: %d %q, want %q", v.url, w.Code, w.Body.String(), v.want)
+		}
+	}
+}
+
+func TestProxyError(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer slow.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	u := proxyServer(50*time.Millisecond, false)
+	u.AddProxy("/slow/", slow.URL)
+	u.AddProxy("/down/", closed.URL)
+	u.AddProxy("/bad/", "http://%zz") //地址错误时不添加
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/slow/x", http.StatusGatewayTimeout},
+		{"/down/x", http.StatusBadGateway},
+	}
+	for _, v := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", v.path, nil)
+		u.hasUrl(req.URL, w, req)
+		if w.Code != v.code {
+			t.Errorf("%s: %d, want %d", v.path, w.Code, v.code)
+		}
+	}
+	if r := u.proxies.matchPath("/bad/x"); r != nil && r.prefix == "/bad/" {
+		t.Errorf("/bad/ added")
+	}
+}
+
+func TestProxyWebSocket(t *testing.T) {
+	up := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer up.Close()
+	u := proxyServer(time.Second, false)
+	u.AddProxy("/socket/", "ws"+strings.TrimPrefix(up.URL, "http"))
+	front := httptest.NewServer(u.logged(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { //经过访问日志时仍可以升级
+		if !u.hasUrl(req.URL, w, req) {
+			http.NotFound(w, req)
+		}
+	})))
+	defer front.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/socket/echo", "", front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := websocket.Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err != nil || msg != "hello" {
+		t.Errorf("receive = %q, %v", msg, err)
+	}
+}
@@ -0,0 +1,438 @@
+// release.go
+package util
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * 发布时共享的源文件，同一次发布中文件不会变化，每个文件只读取一次
+ * 只共享文件内容和文件查找结果，不共享解析结果：编译时会修改HTML节点和脚本标签，每个模块各自解析
+ */
+type sourceCache struct {
+	sync.Mutex
+	codes  map[string]*sourceFile
+	exists map[string]string
+}
+
+type sourceFile struct {
+	once sync.Once
+	code string
+	err  error
+}
+
+func newSourceCache() *sourceCache {
+	return &sourceCache{codes: make(map[string]*sourceFile, 100), exists: make(map[string]string, 100)}
+}
+
+/**
+ * 读取文件内容，多个模块同时读取同一文件时只读取一次
+ */
+func (c *sourceCache) code(path string) (string, error) {
+	c.Lock()
+	f := c.codes[path]
+	if f == nil {
+		f = &sourceFile{}
+		c.codes[path] = f
+	}
+	c.Unlock()
+	f.once.Do(func() {
+		f.code, f.err = GetCode(path)
+	})
+	return f.code, f.err
+}
+
+/**
+ * 查找模块文件，结果同JUSExist
+ */
+func (c *sourceCache) exist(name string) string {
+	c.Lock()
+	v, ok := c.exists[name]
+	c.Unlock()
+	if !ok {
+		v = JUSExist(name)
+		c.Lock()
+		c.exists[name] = v
+		c.Unlock()
+	}
+	return v
+}
+
+/**
+ * 按内容hash命名的发布清单，写在发布目录的manifest.json中
+ * 路径都相对于发布目录，运行时通过清单把模块类名解析为实际地址
+ */
+type Manifest struct {
+	mu      sync.Mutex
+	Modules map[string]string `json:"modules"`          //模块类名到模块文件
+	Assets  map[string]string `json:"assets"`           //.RES资源的原路径到带hash的路径
+	Chunks  map[string]*Chunk `json:"chunks,omitempty"` //打包拆分的代码块
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Modules: make(map[string]string, 20), Assets: make(map[string]string, 20)}
+}
+
+/**
+ * 带内容hash的文件名，例如 comp/Card.html 改为 comp/Card.1a2b3c4d.html
+ */
+func hashName(name string, data []byte) string {
+	sum := md5.Sum(data)
+	ext := path.Ext(name)
+	return name[0:len(name)-len(ext)] + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+/**
+ * 记录资源文件
+ * @param name	相对于发布目录的原路径
+ * @param data	文件内容
+ * @return 带hash的路径
+ */
+func (m *Manifest) AddAsset(name string, data []byte) string {
+	v := hashName(name, data)
+	m.mu.Lock()
+	m.Assets[name] = v
+	m.mu.Unlock()
+	return v
+}
+
+/**
+ * 记录模块文件，同一个类有多个文件时以.html为准
+ * @param className	模块类名
+ * @param name		相对于发布目录的原路径
+ * @param data		编译结果
+ * @return 带hash的路径
+ */
+func (m *Manifest) AddModule(className string, name string, data []byte) string {
+	v := hashName(name, data)
+	m.mu.Lock()
+	if o, ok := m.Modules[className]; !ok || moduleRank(name) < moduleRank(o) {
+		m.Modules[className] = v
+	}
+	m.mu.Unlock()
+	return v
+}
+
+func moduleRank(name string) int {
+	return strings.Index(".html.js.css", path.Ext(name))
+}
+
+/**
+ * 资源原路径到带hash路径的替换
+ */
+func (m *Manifest) replacer() *strings.Replacer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.Assets))
+	for k := range m.Assets {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(a, b int) bool { //长的路径先替换，避免前缀相同的路径被替换
+		return len(names[a]) > len(names[b])
+	})
+	pairs := make([]string, 0, len(names)*2)
+	for _, k := range names {
+		pairs = append(pairs, k, m.Assets[k])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+/**
+ * 把编译结果中引用的资源替换为带hash的路径，替换后重新计算每行的长度和md5
+ */
+func (m *Manifest) Rewrite(data []byte) []byte {
+	return rewriteLines(data, m.replacer())
+}
+
+/**
+ * 替换编译结果每行中的内容，替换后重新计算每行的长度和md5
+ */
+func rewriteLines(data []byte, r *strings.Replacer) []byte {
+	code := string(data)
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	p := 0
+	for _, l := range parseFormatLines(code) {
+		value := ""
+		if l.cls == "I" && strings.HasPrefix(l.value, "H") { //导入的HTML模块，内容也是格式化的行
+			value = "H" + string(rewriteLines([]byte(l.value[1:]), r))
+		} else {
+			value = r.Replace(l.value)
+		}
+		if l.cls[0] == 'R' {
+			writeFormatRun(l.cls, l.name, value, buf)
+		} else {
+			sum := md5.Sum([]byte(value))
+			writeFormatLine(l.cls, l.name, hex.EncodeToString(sum[:]), value, buf)
+		}
+		p = l.end
+	}
+	buf.WriteString(r.Replace(code[p:])) //无法解析的部分直接替换
+	return buf.Bytes()
+}
+
+func (m *Manifest) WriteTo(file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0666)
+}
+
+/**
+ * 编译结果中的一行，位置为字节偏移
+ */
+type formatLine struct {
+	cls   string
+	name  string
+	value string
+	start int
+	end   int
+}
+
+/**
+ * 按行拆分编译结果，R开头的执行行没有md5
+ * 遇到无法解析的内容时停止，返回已解析的行
+ */
+func parseFormatLines(data string) []formatLine {
+	lst := make([]formatLine, 0, 8)
+	for p := 0; p < len(data); {
+		l, next, err := format.Next(data, p)
+		if err != nil {
+			break
+		}
+		lst = append(lst, formatLine{cls: l.Type, name: l.Name, value: l.Value, start: p, end: next})
+		p = next
+	}
+	return lst
+}
+
+/**
+ * 发布结果统计
+ */
+type ReleaseSummary struct {
+	Modules int   `json:"modules"` //编译的模块数
+	Failed  int   `json:"failed"`  //失败的模块数
+	Bytes   int64 `json:"bytes"`   //写出的字节数，包括源码映射
+}
+
+func Summarize(list []*ReleaseModule) *ReleaseSummary {
+	s := &ReleaseSummary{}
+	for _, m := range list {
+		s.Modules++
+		s.Bytes += m.Size
+		if m.Status != "ok" {
+			s.Failed++
+		}
+	}
+	return s
+}
+
+func (s *ReleaseSummary) String() string {
+	return "modules: " + strconv.Itoa(s.Modules) + ", bytes: " + strconv.FormatInt(s.Bytes, 10) + ", failed: " + strconv.Itoa(s.Failed)
+}
+
+/**
+ * 同时编译的模块数量，工程中 release-workers 设置，默认为CPU数量
+ */
+func (u *JusServer) releaseWorkers() int {
+	if v := u.GetAttr("release-workers"); len(v) > 0 {
+		if n, err := strconv.Atoi(v[0]); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+/**
+ * code目录下的文件发布后相对于发布目录的路径
+ */
+func (u *JusServer) releaseName(dPath string) string {
+	return strings.Trim(u.jusDirName, "/") + "/" + filepath.ToSlash(dPath)
+}
+
+/**
+ * 编译一个模块，编译结果暂存在发布结果中，全部模块编译完成后再写出
+ * @param m			发布结果，编译后填写状态
+ * @param dPath		相对于code目录的路径
+ * @param sources	共享的源文件
+ */
+func (u *JusServer) compileModule(m *ReleaseModule, dPath string, sources *sourceCache) {
+	jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/", sourceMap: SourceMapFile, sources: sources, minify: u.ReleaseMinify}
+	data, maps, diag, e := relEvt(jus, u.RootPath, strings.TrimSuffix(dPath, filepath.Ext(dPath)))
+	m.Diagnostics = diag
+	if e != nil { //编译失败时不输出文件
+		m.Status = "error"
+		m.Error = e.Error()
+		return
+	}
+	m.data, m.maps = data, maps
+}
+
+/**
+ * 写出编译结果和源码映射
+ * @param m			已编译的模块
+ * @param dPath		相对于code目录的路径
+ * @param dest		发布的juis目录
+ * @param manifest	不为空时按内容hash命名
+ */
+func (u *JusServer) writeModule(m *ReleaseModule, dPath string, dest string, manifest *Manifest) {
+	data := m.data
+	m.data = nil
+	if data == nil {
+		return
+	}
+	if manifest != nil {
+		data = manifest.Rewrite(data)
+		data = u.hashSourceMaps(m.maps, data, manifest)
+		name := manifest.AddModule(m.ClassName, u.releaseName(dPath), data)
+		m.Path = filepath.ToSlash(filepath.Clean(dest + "/" + strings.TrimPrefix(name, u.releaseName(""))))
+	}
+	if e := ioutil.WriteFile(m.Path, data, 0666); e != nil {
+		m.Status = "error"
+		m.Error = e.Error()
+		return
+	}
+	m.Size += int64(len(data))
+	for _, sm := range m.maps { //源码映射写在发布目录的juis下
+		mPath := dest + "/" + sm.Name
+		os.MkdirAll(filepath.Dir(mPath), 0777)
+		b := sm.Bytes()
+		if e := ioutil.WriteFile(mPath, b, 0666); e != nil {
+			fmt.Println(e)
+			continue
+		}
+		m.Size += int64(len(b))
+	}
+	m.maps = nil
+}
+
+/**
+ * 源码映射按内容hash命名并记录在清单的资源中，脚本末尾的sourceMappingURL改为带hash的文件名
+ * @param maps	模块的源码映射，Name改为带hash的路径
+ * @param data	模块的编译结果
+ * @return 替换后的编译结果
+ */
+func (u *JusServer) hashSourceMaps(maps []*SourceMap, data []byte, manifest *Manifest) []byte {
+	if len(maps) == 0 {
+		return data
+	}
+	pairs := make([]string, 0, len(maps)*2)
+	for _, sm := range maps {
+		script := strings.TrimSuffix(sm.Name, ".map") //sourceURL中的脚本名
+		name := strings.TrimPrefix(manifest.AddAsset(u.releaseName(sm.Name), sm.Bytes()), u.releaseName(""))
+		pairs = append(pairs, mapTrailer(script, path.Base(sm.Name)), mapTrailer(script, path.Base(name)))
+		sm.Name = name
+	}
+	return rewriteLines(data, strings.NewReplacer(pairs...))
+}
+
+//--------------------------------共享样式----------------------------------------
+
+/**
+ * 多个模块共用的组件样式写在此文件中，位于发布的juis目录下
+ */
+const sharedStyleName = "__shared__.css"
+
+/**
+ * 组件样式，类名和内容都相同时视为同一个样式
+ */
+type styleKey struct {
+	name  string
+	value string
+}
+
+/**
+ * 把被多个模块使用的组件样式（A行）移到共享样式表中，模块中改为G行，内容为样式表相对于发布目录的地址
+ * 运行时加载模块时通过<link>引入此样式表，同一地址只引入一次
+ * @param list		已编译的模块
+ * @param dest		发布的juis目录
+ * @param manifest	不为空时样式表按内容hash命名
+ */
+func (u *JusServer) shareStyles(list []*ReleaseModule, dest string, manifest *Manifest) {
+	count := make(map[styleKey]int, 10)
+	lines := make([][]formatLine, len(list))
+	for i, m := range list {
+		if m.data == nil {
+			continue
+		}
+		lines[i] = parseFormatLines(string(m.data))
+		seen := make(map[styleKey]bool, 4)
+		for _, l := range lines[i] {
+			if k := (styleKey{l.name, l.value}); l.cls == "A" && !seen[k] {
+				seen[k] = true
+				count[k]++
+			}
+		}
+	}
+	shared := make([]styleKey, 0, len(count))
+	for k, n := range count {
+		if n > 1 {
+			shared = append(shared, k)
+		}
+	}
+	if len(shared) == 0 {
+		return
+	}
+	sort.Slice(shared, func(a, b int) bool {
+		return shared[a].name < shared[b].name || (shared[a].name == shared[b].name && shared[a].value < shared[b].value)
+	})
+	css := ""
+	for _, k := range shared { //与运行时插入<style>时的处理相同
+		css += strings.NewReplacer("\\r", "\r", "\\n", "\n").Replace(k.value) + "\n"
+	}
+	if manifest != nil {
+		css = manifest.replacer().Replace(css)
+	}
+	//资源地址原来相对于页面，样式表在juis目录下，去掉目录前缀
+	css = regexp.MustCompile(`url\(\s*(['"]?)`+regexp.QuoteMeta(u.releaseName(""))).ReplaceAllString(css, "url(${1}")
+	name := u.releaseName(sharedStyleName)
+	if manifest != nil {
+		name = manifest.AddAsset(name, []byte(css))
+	}
+	if e := ioutil.WriteFile(dest+"/"+strings.TrimPrefix(name, u.releaseName("")), []byte(css), 0666); e != nil {
+		fmt.Println(e)
+		return
+	}
+	fmt.Println("release: shared styles:", len(shared))
+
+	link := make(map[styleKey]bool, len(shared))
+	for _, k := range shared {
+		link[k] = true
+	}
+	url := u.releaseName(sharedStyleName)
+	sum := md5.Sum([]byte(url))
+	for i, m := range list {
+		if m.data == nil {
+			continue
+		}
+		buf := bytes.NewBuffer(make([]byte, 0, len(m.data)))
+		p := 0
+		for _, l := range lines[i] {
+			if l.cls != "A" || !link[styleKey{l.name, l.value}] {
+				continue
+			}
+			buf.Write(m.data[p:l.start])
+			writeFormatLine("G", l.name, hex.EncodeToString(sum[:]), url, buf)
+			p = l.end
+		}
+		buf.Write(m.data[p:])
+		m.data = buf.Bytes()
+	}
+}
@@ -0,0 +1,235 @@
+// release_test.go
+package util
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+ * 创建测试工程，files为相对路径到内容
+ */
+func testProject(t *testing.T, files map[string]string) *JusServer {
+	dir, err := ioutil.TempDir("", "jusmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range files {
+		f := filepath.Join(dir, filepath.FromSlash(k))
+		os.MkdirAll(filepath.Dir(f), 0755)
+		if err := ioutil.WriteFile(f, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u := &JusServer{}
+	u.CreateServer(testSys, dir)
+	return u
+}
+
+/**
+ * 发布临时工程到另一个临时目录
+ * @return 发布结果和发布目录，调用者负责删除
+ */
+func releaseProject(t *testing.T, u *JusServer) ([]*ReleaseModule, string) {
+	out, err := ioutil.TempDir("", "jusrelease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := u.ReleaseTo(out)
+	for _, m := range list {
+		if m.Status != "ok" {
+			t.Errorf("%s: %s", m.ClassName, m.Error)
+		}
+	}
+	return list, out
+}
+
+/**
+ * 检查编译结果的每一行都能解析，长度和md5与内容一致
+ * @return 解析出的行
+ */
+func checkLines(t *testing.T, name string, data []byte) []formatLine {
+	code := string(data)
+	lst := parseFormatLines(code)
+	if len(lst) == 0 || lst[len(lst)-1].end != len(code) {
+		t.Errorf("%s: bad format lines: %q", name, code)
+	}
+	for _, l := range lst {
+		sum := md5.Sum([]byte(l.value))
+		if l.cls[0] != 'R' && !strings.Contains(code[l.start:l.end], " "+l.name+" "+hex.EncodeToString(sum[:])+" ") {
+			t.Errorf("%s: bad md5 of %s %s", name, l.cls, l.name)
+		}
+	}
+	return lst
+}
+
+func readManifest(t *testing.T, out string) *Manifest {
+	b, err := ioutil.ReadFile(filepath.Join(out, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestReleaseHash(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                    "",
+		"code/index.html":         `<div><img src="@res/logo.png"/><comp.Card/></div>`,
+		"code/index.RES/logo.png": "png",
+		"code/comp/Card.html":     `<div class="card"><span>card</span></div>`,
+	})
+	defer os.RemoveAll(u.RootPath)
+	u.ReleaseHash = true
+	list, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+
+	m := readManifest(t, out)
+	logo := m.Assets["juis/index.RES/logo.png"]
+	if logo != hashName("juis/index.RES/logo.png", []byte("png")) {
+		t.Errorf("assets = %v", m.Assets)
+	}
+	if _, err := os.Stat(filepath.Join(out, logo)); err != nil {
+		t.Error(err)
+	}
+	if len(m.Modules) != 2 || len(list) != 2 {
+		t.Fatalf("modules = %v", m.Modules)
+	}
+	for _, r := range list {
+		name := m.Modules[r.ClassName]
+		if r.Path != filepath.ToSlash(filepath.Join(out, name)) {
+			t.Errorf("%s: path %s, manifest %s", r.ClassName, r.Path, name)
+		}
+		data, err := ioutil.ReadFile(r.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig := "juis/" + strings.Replace(r.ClassName, ".", "/", -1) + ".html"
+		if name != hashName(orig, data) { //hash按写出的内容计算
+			t.Errorf("%s: %s isn't the hash of its content", r.ClassName, name)
+		}
+		checkLines(t, r.ClassName, data) //替换资源路径后每行的长度和md5仍然正确
+		if r.ClassName == "index" {
+			if !strings.Contains(string(data), `src="`+logo+`"`) || strings.Contains(string(data), "logo.png") {
+				t.Errorf("asset path isn't rewritten: %s", data)
+			}
+		}
+	}
+
+	_, again := releaseProject(t, u) //内容不变时文件名不变
+	defer os.RemoveAll(again)
+	if m2 := readManifest(t, again); !reflect.DeepEqual(m, m2) {
+		t.Errorf("manifest changed between releases: %v, %v", m, m2)
+	}
+}
+
+func TestReleaseHashSourceMap(t *testing.T) {
+	for _, minify := range []bool{false, true} {
+		u := testProject(t, map[string]string{
+			".jus":                "",
+			"code/comp/Card.html": cardHTML,
+		})
+		defer os.RemoveAll(u.RootPath)
+		u.ReleaseHash, u.ReleaseMinify = true, minify
+		list, out := releaseProject(t, u)
+		defer os.RemoveAll(out)
+
+		m := readManifest(t, out)
+		name := m.Assets["juis/comp/Card.js.map"]
+		b, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatalf("minify %v: assets = %v, %v", minify, m.Assets, err)
+		}
+		if name != hashName("juis/comp/Card.js.map", b) {
+			t.Errorf("minify %v: %s isn't the hash of its content", minify, name)
+		}
+		if Exist(filepath.Join(out, "juis", "comp", "Card.js.map")) {
+			t.Errorf("minify %v: unhashed .map is written", minify)
+		}
+		if len(list) != 1 {
+			t.Fatalf("minify %v: modules = %v", minify, list)
+		}
+		data, err := ioutil.ReadFile(list[0].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkLines(t, "comp.Card", data)
+		if !strings.Contains(string(data), "//# sourceURL=juis/comp/Card.js\r\n//# sourceMappingURL="+filepath.Base(name)+"\r\n") {
+			t.Errorf("minify %v: sourceMappingURL isn't rewritten: %q", minify, data)
+		}
+	}
+}
+
+func TestReleaseSharedStyles(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                "",
+		"code/a.html":         `<div><comp.Card/><comp.Card/></div>`,
+		"code/b.html":         `<div><comp.Card/></div>`,
+		"code/comp/Card.html": "<div class=\"card\">\n\t<css>\n\t\t.title {\n\t\t\tcolor : red ;\n\t\t}\n\t\t.title { color:red }\n\t</css>\n\t<span class=\"title\">card</span>\n</div>",
+	})
+	defer os.RemoveAll(u.RootPath)
+	u.ReleaseMinify = true
+	list, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+
+	css, err := ioutil.ReadFile(filepath.Join(out, "juis", sharedStyleName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(css) != "[class_id='comp.Card'] .title{color:red}\n" { //压缩后相同的规则只保留一个
+		t.Errorf("shared css = %q", css)
+	}
+	for _, r := range list {
+		data, err := ioutil.ReadFile(r.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		styles := 0
+		for _, l := range checkLines(t, r.ClassName, data) {
+			switch l.cls {
+			case "A":
+				t.Errorf("%s: component style isn't shared: %s", r.ClassName, l.value)
+			case "G":
+				styles++
+				if l.name != "comp.Card" || l.value != "juis/"+sharedStyleName {
+					t.Errorf("%s: G line %s %s", r.ClassName, l.name, l.value)
+				}
+			}
+		}
+		if styles != 1 { //同一个组件用了两次也只引入一次
+			t.Errorf("%s: %d shared style lines", r.ClassName, styles)
+		}
+	}
+}
+
+func TestReleaseCopy(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                    "",
+		"code/index.html":         `<div></div>`,
+		"code/comp/Card.html":     `<div class="card"></div>`,
+		"static/app.txt":          "app",
+		"fixtures/api/GET.0.json": `{"status":200}`,
+	})
+	defer os.RemoveAll(u.RootPath)
+	_, out := releaseProject(t, u)
+	defer os.RemoveAll(out)
+
+	if b, err := ioutil.ReadFile(filepath.Join(out, "static", "app.txt")); err != nil || string(b) != "app" {
+		t.Errorf("static file isn't copied: %q, %v", b, err)
+	}
+	for _, v := range []string{"fixtures", "code"} { //录制的接口和源码不发布
+		if Exist(filepath.Join(out, v)) {
+			t.Errorf("%s is copied to the release", v)
+		}
+	}
+}
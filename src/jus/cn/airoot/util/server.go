@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	. "jus"
-	. "jus/str"
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus"
+	. "github.com/tianyueshi/AIroot-JUS/src/jus/str"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
 	"path"
@@ -21,17 +21,6 @@ import (
 	"golang.org/x/net/websocket"
 )
 
-type urlMap struct {
-	pattern string
-	path    string
-	cls     int
-}
-
-type proxyMap struct {
-	pattern *url.URL
-	path    string
-	cls     int
-}
 type element struct {
 	name       string
 	info       os.FileInfo       //文件信息
@@ -48,6 +37,7 @@ type connectElement struct {
 	IP_Address string
 	RemoteAddr string
 	LocalAddr  string
+	Watch      bool //开发页面，接收模块变化通知
 }
 
 type WsUser struct {
@@ -56,23 +46,31 @@ type WsUser struct {
 }
 
 type JusServer struct {
-	protocol      string //连接协议http or https
-	Addr          string //连接地址
-	Status        bool   //运行状态
-	Datetime      time.Time
-	server        *http.Server
-	fServer       http.Handler
-	osName        string //操作系统名称
-	SysPath       string
-	RootPath      string
-	jusDirName    string
-	proxy         []*proxyMap        //反向代理列表
-	pattern       map[string]*urlMap //映射列表
-	useClassList  []*element
-	wsUser        *WsUser
-	connectedList []*connectElement
-	testConnect   chan byte
-	wsURL         string //websocket 用户验证URL
+	protocol        string //连接协议http or https
+	Addr            string //连接地址
+	Status          bool   //运行状态
+	Datetime        time.Time
+	server          *http.Server
+	fServer         http.Handler
+	osName          string //操作系统名称
+	SysPath         string
+	RootPath        string
+	jusDirName      string
+	proxies         *proxyTable    //反向代理和虚拟目录
+	mocks           *mockTable     //模拟接口
+	fixtures        *fixtureStore  //接口录制回放
+	access          *accessLog     //访问日志
+	metrics         *accessMetrics //请求统计
+	useClassList    []*element
+	wsUser          *WsUser
+	connectedList   []*connectElement
+	testConnect     chan byte
+	wsURL           string        //websocket 用户验证URL
+	cache           *CompileCache //模块编译缓存
+	ReleaseHash     bool          //发布时按内容hash命名模块和资源，并生成manifest.json
+	ReleaseMinify   bool          //发布时压缩脚本和样式
+	ReleaseSplit    bool          //打包时把按需加载的模块拆分为单独的代码块
+	ReleaseCompress bool          //发布时生成.gz和.br预压缩文件
 }
 
 /**
@@ -83,13 +81,17 @@ type JusServer struct {
 func (u *JusServer) CreateServer(SysPath string, rootPath string) {
 	u.Datetime = time.Now()
 	u.SysPath = SysPath
+	u.cache = NewCompileCache("", "")
+	u.proxies = newProxyTable()
+	u.mocks = newMockTable()
+	u.fixtures = newFixtureStore()
+	u.access = newAccessLog()
+	u.metrics = newAccessMetrics()
 	if rootPath != "" {
 		u.SetProject(rootPath)
 	}
 
 	u.jusDirName = "/juis/"
-	u.proxy = make([]*proxyMap, 0)
-	u.pattern = make(map[string]*urlMap, 0)
 	u.wsUser = &WsUser{list: make(map[string]*connectElement)} //初始化
 	u.connectedList = make([]*connectElement, 0)
 	u.testConnect = make(chan byte)
@@ -151,14 +153,10 @@ func (u *JusServer) Start(addr string) {
 	u.Addr = addr
 	go func() {
 		fmt.Println("JUS Server Started At: [" + addr + "]. Use protocol " + IfStr(u.protocol == "", "http", u.protocol))
-		handler := http.NewServeMux()
-		handler.HandleFunc("/", u.root)
-		handler.HandleFunc("/index.edit/", u.editDirEvt)
-		handler.HandleFunc("/index.edit/juis/", u.jusEditEvt)
-		handler.Handle("/ws", websocket.Handler(u.wsHandler))
-		u.server = &http.Server{Addr: addr, Handler: handler}
+		u.server = &http.Server{Addr: addr, Handler: u.handler()}
 		u.Status = true
 		u.testServer()
+		u.watch()
 		var err error = nil
 		if u.protocol == "" || u.protocol == "http" {
 			err = u.server.ListenAndServe()
@@ -176,6 +174,22 @@ func (u *JusServer) Start(addr string) {
 
 }
 
+/**
+ * 请求处理，所有请求记录访问日志和统计
+ */
+func (u *JusServer) handler() http.Handler {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", u.root)
+	handler.HandleFunc("/index.edit/", u.editDirEvt)
+	handler.HandleFunc("/index.edit/juis/", u.jusEditEvt)
+	ws := websocket.Handler(u.wsHandler)
+	handler.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		markAccess(w, accessSocket)
+		ws.ServeHTTP(w, req)
+	})
+	return u.logged(handler)
+}
+
 /**
  * 设置工程目录
  */
@@ -183,19 +197,34 @@ func (u *JusServer) SetProject(path string) bool {
 	if Exist(path) {
 		rpath, _ := filepath.Abs(path)
 		u.RootPath = rpath
-		u.fServer = http.FileServer(http.Dir(path))
-		u.proxy = u.proxy[0:0]
-		for _, v := range u.GetAttrLike("proxy") {
-			u.AddDomainProxy(v[0], v[1])
-		}
-		u.pattern = make(map[string]*urlMap)
-		for _, v := range u.GetAttrLike("pattern") {
-			u.AddProxy(v[0], v[1])
-		}
+		u.fServer = StaticHandler(path)
+		u.loadProxy()
+		u.loadMock()
+		u.loadAccessLog()
 		for _, v := range u.GetAttrLike("ws_accept") { //添加websocket用户验证url
 			fmt.Println("ws_accept", v[0])
 			u.wsURL = v[0]
 		}
+		cachePath := ""
+		if v := u.GetAttr("cache-path"); len(v) > 0 { //设置后编译缓存同时保存到磁盘
+			cachePath = v[0]
+			if !filepath.IsAbs(cachePath) {
+				cachePath = u.RootPath + "/" + cachePath
+			}
+		}
+		u.cache = NewCompileCache(cachePath, u.RootPath+"\n"+u.SysPath)
+		if v := u.GetAttr("release-hash"); len(v) > 0 {
+			u.ReleaseHash = v[0] == "true"
+		}
+		if v := u.GetAttr("release-minify"); len(v) > 0 {
+			u.ReleaseMinify = v[0] == "true"
+		}
+		if v := u.GetAttr("release-split"); len(v) > 0 {
+			u.ReleaseSplit = v[0] == "true"
+		}
+		if v := u.GetAttr("release-compress"); len(v) > 0 {
+			u.ReleaseCompress = v[0] == "true"
+		}
 		return true
 	} else {
 		fmt.Println("不存在[" + path + "]目录")
@@ -205,16 +234,26 @@ func (u *JusServer) SetProject(path string) bool {
 }
 
 /**
- * 创建模块文件
+ * 创建模块文件，已存在的文件不覆盖
+ * @param cls	创建的类型，包含 s、m、h、r 中的一个或多个
+ * @return 类型无效或目录、文件创建失败时返回false
  */
 func (u *JusServer) CreateModule(cls string, className string) bool {
 	tPath := "" //临时路径
 	path := u.RootPath + "/code/" + Replace(className, ".", "/")
 	dirPath := Substring(path, 0, LastIndex(path, "/"))
 
+	if className == "" || strings.Trim(cls, "-smhr") != "" || strings.Trim(cls, "-") == "" {
+		fmt.Println("Module Type Error: ", cls)
+		return false
+	}
 	if !Exist(dirPath) {
-		os.MkdirAll(dirPath, 0777)
+		if e := os.MkdirAll(dirPath, 0777); e != nil {
+			fmt.Println(e)
+			return false
+		}
 	}
+	ok := true
 
 	if Index(cls, "s") != -1 { //创建Script文件
 		tPath = path + ".js"
@@ -223,6 +262,9 @@ func (u *JusServer) CreateModule(cls string, className string) bool {
 			f, e := os.Create(tPath)
 			if e == nil {
 				defer f.Close()
+			} else {
+				fmt.Println(e)
+				ok = false
 			}
 		}
 
@@ -235,6 +277,9 @@ func (u *JusServer) CreateModule(cls string, className string) bool {
 			f, e := os.Create(tPath)
 			if e == nil {
 				defer f.Close()
+			} else {
+				fmt.Println(e)
+				ok = false
 			}
 		}
 		tPath = path + ".js"
@@ -243,6 +288,9 @@ func (u *JusServer) CreateModule(cls string, className string) bool {
 			f, e := os.Create(tPath)
 			if e == nil {
 				defer f.Close()
+			} else {
+				fmt.Println(e)
+				ok = false
 			}
 		}
 		tPath = path + ".css"
@@ -251,6 +299,9 @@ func (u *JusServer) CreateModule(cls string, className string) bool {
 			f, e := os.Create(tPath)
 			if e == nil {
 				defer f.Close()
+			} else {
+				fmt.Println(e)
+				ok = false
 			}
 		}
 
@@ -263,16 +314,22 @@ func (u *JusServer) CreateModule(cls string, className string) bool {
 			f, e := os.Create(tPath)
 			if e == nil {
 				defer f.Close()
+			} else {
+				fmt.Println(e)
+				ok = false
 			}
 		}
 	}
 
 	if Index(cls, "r") != -1 { //默认创建资源文件夹
-		os.MkdirAll(path+".RES", 0777)
+		if e := os.MkdirAll(path+".RES", 0777); e != nil {
+			fmt.Println(e)
+			ok = false
+		}
 		fmt.Println("Module RES: ", path)
 	}
 
-	return true
+	return ok
 }
 
 /**
@@ -303,7 +360,18 @@ func (u *JusServer) wsHandler(ws *websocket.Conn) {
 		fmt.Println("error>>:", err)
 	} else {
 		cmds = FmtCmd(string(msg[0:n]))
-		if len(cmds) >= 3 {
+		if len(cmds) >= 1 && cmds[0] == "watch" { //开发页面订阅模块变化
+			ce.Connected = true
+			ce.Watch = true
+			ce.IP_Address = ws.Request().RemoteAddr
+			ce.RemoteAddr = ws.RemoteAddr().String()
+			ce.LocalAddr = ws.LocalAddr().String()
+			for {
+				if _, err = ws.Read(msg); err != nil {
+					break
+				}
+			}
+		} else if len(cmds) >= 3 {
 			if cmds[0] == "login" {
 				if flag, value := u.havUser(cmds); flag {
 					u.wsUser.RLock()
@@ -400,33 +468,79 @@ func (u *JusServer) havUser(cmds []string) (bool, string) {
 }
 
 func (u *JusServer) jusEvt(w http.ResponseWriter, req *http.Request) {
-	path := u.RootPath + req.RequestURI
-	if Exist(path) {
-		value, err := GetBytes(path)
-		if err != nil {
-			value = []byte("500")
-		}
-		w.Write(value)
+	uri := req.URL.Path //不包括查询参数
+	path := u.RootPath + uri
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		markAccess(w, accessFile)
+		serveFile(w, req, path, fi)
 	} else {
-		jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/"}
-		className := Substring(req.RequestURI, StringLen(u.jusDirName), LastIndex(req.RequestURI, "."))
+		className := Substring(uri, StringLen(u.jusDirName), LastIndex(uri, "."))
 		className = Replace(className, "/", ".")
-		if jus.CreateFrom(u.RootPath+"/code/", "", nil, className) {
-			jus.resPath = "code"
-			b := jus.ToFormatBytes()
-			w.Header().Add("Content-Length", strconv.Itoa(len(b)))
-			w.Write(b)
-		} else {
-			fmt.Println("不存在", className)
+		b, ok, d := u.compile(className)
+		markCompile(w, className, d)
+		if ok {
+			addVary(w.Header(), "Accept")
+			if wantJSON(req) { //?format=json 或 Accept: application/json 时输出JSON结构
+				j, err := format.ToJSON(b)
+				if err != nil {
+					w.WriteHeader(500)
+					w.Write([]byte(err.Error()))
+					return
+				}
+				b = j
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			}
+			serveEncoded(w, req, uri, time.Time{}, b, "")
+		} else { //模块不存在，访问日志中为404
 			w.WriteHeader(404)
 			w.Write([]byte("<h1>404</h1>"))
 		}
-		jus = nil
 
 	}
 
 }
 
+/**
+ * 请求是否要求JSON结构的编译结果
+ */
+func wantJSON(req *http.Request) bool {
+	if v := req.URL.Query().Get("format"); v != "" {
+		return v == "json"
+	}
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+/**
+ * 编译开发页面使用的模块，依赖的文件都没有变化时直接使用缓存
+ * @param className	模块类名
+ * @return 格式化后的字节流，模块不存在时返回false，以及编译用时，使用缓存时为0
+ */
+func (u *JusServer) compile(className string) ([]byte, bool, time.Duration) {
+	if b, ok := u.cache.Get(className); ok {
+		for _, v := range u.cache.Diagnostics(className) { //没有重新编译，输出保存的诊断信息
+			fmt.Println(v)
+		}
+		return b, true, 0
+	}
+	start := time.Now()
+	jus := &JUS{SYSTEM_PATH: u.SysPath, CLASS_PATH: u.SysPath + "/code/", sourceMap: SourceMapInline, cache: u.cache}
+	if !jus.CreateFrom(u.RootPath+"/code/", "", nil, className) {
+		return nil, false, time.Since(start)
+	}
+	jus.resPath = "code"
+	b := jus.ToFormatBytes()
+	for _, v := range jus.Diagnostics().List() { //诊断信息输出到控制台
+		fmt.Println(v)
+	}
+	live := bytes.NewBuffer(b)
+	jus.ToFormatLine("W", className, "/ws", live) //开发页面通过此地址接收模块变化
+	b = live.Bytes()
+	u.cache.Put(className, b, jus)
+	d := time.Since(start)
+	u.metrics.observeCompile(className, d)
+	return b, true, d
+}
+
 func (u *JusServer) jusEditEvt(w http.ResponseWriter, req *http.Request) {
 
 	path := u.SysPath + req.RequestURI
@@ -449,6 +563,10 @@ func (u *JusServer) jusEditEvt(w http.ResponseWriter, req *http.Request) {
 }
 
 func (u *JusServer) root(w http.ResponseWriter, req *http.Request) {
+	//模拟接口优先于反向代理
+	if u.hasMock(w, req) {
+		return
+	}
 	//判断是否有域名反向代理
 	if u.hasProxy(w, req) {
 		return
@@ -476,6 +594,16 @@ func (u *JusServer) root(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if req.URL.Path == "/index.inspect" { //查看模块编译的各个阶段
+			u.inspectEvt(w, req)
+			return
+		}
+
+		if req.URL.Path == "/index.metrics" { //请求统计，Prometheus文本格式
+			u.metricsEvt(w, req)
+			return
+		}
+
 		if req.URL.Path == "/index.test" {
 			data, err := GetBytes(u.SysPath + "/test.html")
 			if err != nil {
@@ -494,7 +622,6 @@ func (u *JusServer) root(w http.ResponseWriter, req *http.Request) {
 	path := req.URL.Path
 
 	//value, err := GetBytes(path)
-	req.Header.Del("If-Modified-Since")
 	//w.Header().Add("Content-Length", strconv.Itoa(len(value)))
 	if Substring(path, LastIndex(path, "."), -1) == ".html" {
 		w.Header().Add("Content-Type", "text/html; charset=utf-8")
@@ -504,6 +631,7 @@ func (u *JusServer) root(w http.ResponseWriter, req *http.Request) {
 		w.Header().Add("Content-Type", "text/css; charset=utf-8")
 	}
 	//w.Header().Add("ETag", "1")
+	markAccess(w, accessFile)
 	u.fServer.ServeHTTP(w, req)
 
 }
@@ -1040,75 +1168,48 @@ func (u *JusServer) getDirList(path string) string {
 }
 
 /**
- * 判断是否有反向代理
+ * 判断是否有域名反向代理
  */
 func (u *JusServer) hasProxy(w http.ResponseWriter, req *http.Request) bool {
-	var p *proxyMap = nil
-	for _, v := range u.proxy {
-		if Index(req.Host, v.pattern.Host) == 0 {
-			p = v
-			break
-		}
+	p := u.proxies.matchHost(req.Host)
+	if p == nil {
+		return false
 	}
-	if p != nil {
-		if p.cls == 0 {
-			path := p.path + req.URL.Path + req.URL.RawQuery
-			fmt.Println(">>", path)
-			value, err := GetBytes(path)
-			if err != nil {
-				value = []byte("<h1>404</h1>")
-			}
-			w.WriteHeader(404)
-			w.Write(value)
-		} else {
-			remote, err := url.Parse(p.path)
-			if err != nil {
-				panic(err)
-			}
-			proxy := httputil.NewSingleHostReverseProxy(remote)
-			proxy.ServeHTTP(w, req)
-
-		}
-		return true
+	if p.target == nil {
+		markAccess(w, accessFile)
+		serveDir(w, req, u.localDir(p.path), req.URL.Path)
+	} else {
+		markAccess(w, accessProxied)
+		p.ServeHTTP(w, req)
 	}
-	return false
+	return true
 }
 
 /**
  * 判断是否有可用映射
  */
 func (u *JusServer) hasUrl(urlPath *url.URL, w http.ResponseWriter, req *http.Request) bool {
-	var p *urlMap = nil
-	for _, v := range u.pattern {
-		if Index(urlPath.Path, v.pattern) == 0 {
-			p = v
-			break
-		}
+	p := u.proxies.matchPath(urlPath.Path)
+	if p == nil {
+		return false
 	}
-
-	if p != nil {
-		if p.cls == 0 {
-			path := p.path + Substring(urlPath.Path, StringLen(p.pattern), -1) + urlPath.RawQuery
-
-			value, err := GetBytes(path)
-			if err != nil {
-				value = []byte("<h1>404</h1>")
-			}
-			w.WriteHeader(404)
-			w.Write(value)
-		} else {
-			remote, err := url.Parse(p.path)
-			if err != nil {
-				panic(err)
-			}
-			proxy := httputil.NewSingleHostReverseProxy(remote)
-			req.URL.Path = Substring(urlPath.Path, StringLen(p.pattern), -1)
-			proxy.ServeHTTP(w, req)
-
-		}
+	if p.target == nil {
+		markAccess(w, accessFile)
+		serveDir(w, req, u.localDir(p.path), Substring(urlPath.Path, StringLen(p.prefix), -1))
 		return true
 	}
-	return false
+	switch u.fixtures.current() {
+	case fixtureRecord:
+		markAccess(w, accessProxied)
+		u.fixtures.record(p, w, req)
+	case fixtureReplay:
+		markAccess(w, accessReplay)
+		u.fixtures.replay(w, req)
+	default:
+		markAccess(w, accessProxied)
+		p.ServeHTTP(w, req)
+	}
+	return true
 }
 
 /**
@@ -1118,7 +1219,7 @@ func (u *JusServer) hasUrl(urlPath *url.URL, w http.ResponseWriter, req *http.Re
 func (u *JusServer) GetAttr(attr string) []string {
 	list := u.GetData()
 	for _, v := range list {
-		if v[0] == attr {
+		if len(v) > 0 && v[0] == attr {
 			return v[1:]
 		}
 	}
@@ -1140,29 +1241,78 @@ func (u *JusServer) GetAttrLike(attr string) [][]string {
 	return lst
 }
 
+/**
+ * 模块发布结果
+ */
+type ReleaseModule struct {
+	ClassName   string        `json:"class"`                 //模块类名
+	Path        string        `json:"path"`                  //输出文件路径
+	Status      string        `json:"status"`                //ok 或 error
+	Size        int64         `json:"size"`                  //写出的字节数，包括源码映射
+	Error       string        `json:"error,omitempty"`       //错误信息
+	Diagnostics []*Diagnostic `json:"diagnostics,omitempty"` //编译诊断信息
+	data        []byte        //编译结果，写出后清空
+	maps        []*SourceMap  //源码映射，写出后清空
+}
+
 /**
  * 发布此工程
+ * @return 所有模块的发布结果
  */
-func (u *JusServer) Release() {
+func (u *JusServer) Release() []*ReleaseModule {
+	list := make([]*ReleaseModule, 0)
 	for _, v := range u.GetAttr("release-path") {
+		list = append(list, u.ReleaseTo(v)...)
+	}
+	return list
+}
 
-		if v != "" {
-			os.MkdirAll(v, 0777)
-		}
-		Copy(u.RootPath, v, u.RootPath+"/code/")
+/**
+ * 发布此工程到指定目录
+ * @param v	发布目录
+ */
+func (u *JusServer) ReleaseTo(v string) []*ReleaseModule {
+	if v != "" {
+		os.MkdirAll(v, 0777)
+	}
+	Copy(u.RootPath, v, append([]string{u.RootPath + "/code/", u.mocks.path()}, u.generated()...)...) //模拟接口、录制的接口、缓存和日志不发布
 
-		jusPath := v + u.jusDirName + "/"
-		if u.RootPath != "" {
-			os.MkdirAll(jusPath, 0777)
-		}
+	jusPath := v + u.jusDirName + "/"
+	if u.RootPath != "" {
+		os.MkdirAll(jusPath, 0777)
+	}
 
-		//发布Code,先遍历
-		u.WalkFiles(u.RootPath+"/code/", jusPath)
+	//发布Code,先遍历
+	var list []*ReleaseModule
+	if !u.ReleaseHash {
+		list = u.WalkFiles(u.RootPath+"/code/", jusPath)
+	} else {
+		manifest := NewManifest()
+		list = u.walkFiles(u.RootPath+"/code/", jusPath, manifest)
+		if e := manifest.WriteTo(v + "/manifest.json"); e != nil {
+			fmt.Println(e)
+		}
 	}
+	u.precompress(v)
+	return list
+}
 
+/**
+ * 发布code目录，模块文件由多个协程同时编译，全部编译完成后再写出，其他文件直接复制
+ * @param src	code目录
+ * @param dest	发布的juis目录
+ * @return 所有模块的发布结果，顺序与目录遍历顺序相同
+ */
+func (u *JusServer) WalkFiles(src string, dest string) []*ReleaseModule {
+	return u.walkFiles(src, dest, nil)
 }
 
-func (u *JusServer) WalkFiles(src string, dest string) {
+/**
+ * @param manifest	不为空时模块和.RES资源按内容hash命名，并记录在清单中
+ */
+func (u *JusServer) walkFiles(src string, dest string, manifest *Manifest) []*ReleaseModule {
+	list := make([]*ReleaseModule, 0)
+	paths := make([]string, 0)
 	fileType := ""
 	filepath.Walk(src,
 		func(f string, fi os.FileInfo, err error) error { //遍历目录
@@ -1181,30 +1331,79 @@ func (u *JusServer) WalkFiles(src string, dest string) {
 				//fmt.Println(dPath)
 				fileType = Substring(aPath, LastIndex(aPath, "."), -1)
 				if fileType == ".html" || fileType == ".js" || fileType == ".css" { //2018-5-4
-					d, _ := os.Create(aPath)
-					d.Write(relEvt(u.SysPath, u.RootPath, u.jusDirName, dPath))
-					defer d.Close()
+					m := &ReleaseModule{ClassName: Replace(filepath.ToSlash(Substring(dPath, 0, LastIndex(dPath, "."))), "/", "."), Path: filepath.ToSlash(filepath.Clean(aPath)), Status: "ok"}
+					list = append(list, m)
+					paths = append(paths, dPath)
 				} else {
 					CopyFile(aPath, f)
+					if manifest != nil && Index(filepath.ToSlash(dPath), ".RES/") != -1 { //原文件保留，供脚本中拼接的@res路径使用
+						data, _ := GetBytes(f)
+						name := manifest.AddAsset(u.releaseName(dPath), data)
+						CopyFile(dest+"/"+strings.TrimPrefix(name, u.releaseName("")), f)
+					}
 				}
 			}
 
 			return nil
 
 		})
+
+	sources := newSourceCache()
+	jobs := make(chan int, len(list))
+	for i := range list {
+		jobs <- i
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	for n := u.releaseWorkers(); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				u.compileModule(list[i], paths[i], sources)
+			}
+		}()
+	}
+	wg.Wait()
+	if u.ReleaseMinify { //多个模块共用的组件样式移到共享样式表
+		u.shareStyles(list, dest, manifest)
+	}
+	for i, m := range list {
+		u.writeModule(m, paths[i], dest, manifest)
+	}
+	fmt.Println("release:", Summarize(list))
+	return list
 }
 
-func relEvt(sysPath string, rootPath string, jusDirName string, path string) []byte {
-	jus := &JUS{SYSTEM_PATH: sysPath, CLASS_PATH: sysPath + "/code/"}
-	lp := LastIndex(path, ".")
-	className := Substring(path, 0, lp)
+/**
+ * 编译发布一个模块，有错误级别的诊断信息时视为编译失败
+ * @param jus		编译使用的根模块，设置了源码映射和压缩方式，编译后可以读取依赖图
+ * @param rootPath	工程目录
+ * @param className	模块类名，可以用/分隔
+ * @return 编译结果, 源码映射, 诊断信息, 错误
+ */
+func relEvt(jus *JUS, rootPath string, className string) (data []byte, maps []*SourceMap, diag []*Diagnostic, err error) {
 	fmt.Println("export:", className)
+	defer func() { //编译过程中的异常视为编译失败
+		if e := recover(); e != nil {
+			data = nil
+			err = fmt.Errorf("%s: %v", className, e)
+		}
+	}()
 	if jus.CreateFrom(rootPath+"/code/", "", nil, className) {
 		jus.resPath = "juis"
-		return jus.ToFormatBytes()
+		data = jus.ToFormatBytes()
+		diag = jus.Diagnostics().List()
+		for _, v := range diag {
+			fmt.Println(v)
+		}
+		if err = jus.Diagnostics().Err(); err != nil {
+			return nil, nil, diag, err
+		}
+		return data, jus.SourceMaps(), diag, nil
 	}
 
-	return []byte("nothing.")
+	return nil, nil, nil, fmt.Errorf("%s: module isn't exist.", className)
 }
 
 /**
@@ -1262,34 +1461,65 @@ func (u *JusServer) GetData() [][]string {
 	return FmtCmdList(data)
 }
 
+/**
+ * 从 .jus 中读取反向代理和虚拟目录
+ * proxy* <域名地址> <目标>	按域名转发
+ * pattern* <路径前缀> <目标>	按路径前缀转发，去掉前缀
+ * upstream-timeout <时间>		连接和等待响应头的超时时间，例如 10s，默认30s
+ * upstream-insecure true		不验证https目标的证书
+ */
+func (u *JusServer) loadProxy() {
+	timeout := defaultProxyTimeout
+	if v := u.GetAttr("upstream-timeout"); len(v) > 0 {
+		if d, err := time.ParseDuration(v[0]); err == nil && d > 0 {
+			timeout = d
+		} else {
+			fmt.Println("upstream-timeout:", v[0])
+		}
+	}
+	insecure := false
+	if v := u.GetAttr("upstream-insecure"); len(v) > 0 {
+		insecure = v[0] == "true"
+	}
+	u.proxies.reset(timeout, insecure)
+	u.loadFixtures()
+	for _, v := range u.GetAttrLike("proxy") {
+		if len(v) > 1 {
+			u.AddDomainProxy(v[0], v[1])
+		}
+	}
+	for _, v := range u.GetAttrLike("pattern") {
+		if len(v) > 1 {
+			u.AddProxy(v[0], v[1])
+		}
+	}
+}
+
+/**
+ * 是否为反向代理的设置
+ */
+func isProxyAttr(name string) bool {
+	return Index(name, "proxy") == 0 || Index(name, "pattern") == 0 || Index(name, "upstream-") == 0
+}
+
 /**
  * 增加域名级别虚拟目录和反向代理
  */
 func (u *JusServer) AddDomainProxy(pattern string, path string) {
 	fmt.Println("proxy", pattern, "-->", path)
-	cls := 0
-	if Index(path, "http://") == 0 {
-		cls = 1
+	if err := u.proxies.addHost(pattern, path); err != nil {
+		fmt.Println("Format URL:", err)
 	}
-	proxyURL, err := url.Parse(pattern)
-	if err == nil {
-		u.proxy = append(u.proxy, &proxyMap{proxyURL, path, cls})
-	} else {
-		fmt.Println("Format URL:", pattern)
-	}
-
 }
 
 /**
- * 增加虚拟目录和反向代理
+ * 增加虚拟目录和反向代理，路径前缀相同时替换
  */
 func (u *JusServer) AddProxy(pattern string, path string) {
 	fmt.Println("pattern", pattern, "-->", path)
-	cls := 0
-	if Index(path, "http://") == 0 {
-		cls = 1
+	if err := u.proxies.addPath(pattern, path); err != nil {
+		fmt.Println("Format URL:", err)
 	}
-	u.pattern[pattern] = &urlMap{pattern, path, cls}
 }
 
 /**
@@ -1319,10 +1549,6 @@ func (u *JusServer) SetData(cmds []string) {
 		command[pos] = cmds
 	}
 
-	if Index(cmds[0], "pattern") == 0 {
-		u.AddProxy(cmds[1], cmds[2])
-	}
-
 	//对源文件备份
 	os.Rename(u.RootPath+"/.jus", u.RootPath+"/.jusb")
 	//生成新文件
@@ -1346,6 +1572,13 @@ func (u *JusServer) SetData(cmds []string) {
 		f.WriteString(sb)
 		os.Remove(u.RootPath + "/.jusb")
 	}
+	if isProxyAttr(cmds[0]) {
+		u.loadProxy()
+	} else if isMockAttr(cmds[0]) {
+		u.loadMock()
+	} else if isAccessAttr(cmds[0]) {
+		u.loadAccessLog()
+	}
 }
 
 /**
@@ -1401,6 +1634,13 @@ func (u *JusServer) RetData(cmds []string) bool {
 			os.Remove(u.RootPath + "/.jusb")
 		}
 	}
+	if success && isProxyAttr(cmds[0]) {
+		u.loadProxy()
+	} else if success && isMockAttr(cmds[0]) {
+		u.loadMock()
+	} else if success && isAccessAttr(cmds[0]) {
+		u.loadAccessLog()
+	}
 
 	return success
 
@@ -0,0 +1,369 @@
+// sourcemap.go
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * 源码映射的输出方式
+ */
+const (
+	SourceMapInline = "inline" //以data URL内联在生成的代码中，开发模式使用
+	SourceMapFile   = "file"   //生成独立的.map文件，发布时使用
+)
+
+//--------------------------------源码位置索引----------------------------------------
+
+/**
+ * 拼接代码中的一段内容与源码位置的对应
+ */
+type sourceSegment struct {
+	start int      //在拼接代码中的开始字符位置
+	line  int      //在拼接代码中的开始行号，从1开始
+	col   int      //在拼接代码中的开始列号，从1开始
+	pos   Position //对应的源码位置，无效时表示这段内容不是来自源码
+}
+
+/**
+ * 拼接代码到源码的位置索引，例如多个<script>块拼成的脚本，nil时不做任何换算
+ */
+type sourceIndex struct {
+	segs  []sourceSegment
+	start int
+	line  int
+	col   int
+}
+
+/**
+ * 整个文件作为代码时的索引
+ */
+func fileIndex(file string) *sourceIndex {
+	x := &sourceIndex{}
+	x.Write(Position{File: file, Line: 1, Col: 1}, "")
+	return x
+}
+
+/**
+ * 记录一段追加到拼接代码中的内容
+ * @param pos	这段内容的源码位置
+ * @param value	这段内容
+ */
+func (x *sourceIndex) Write(pos Position, value string) {
+	if x.line == 0 {
+		x.line, x.col = 1, 1
+	}
+	x.segs = append(x.segs, sourceSegment{start: x.start, line: x.line, col: x.col, pos: pos})
+	for _, ch := range value {
+		x.start++
+		if ch == '\n' {
+			x.line++
+			x.col = 1
+		} else {
+			x.col++
+		}
+	}
+}
+
+/**
+ * 把拼接代码中的位置换算为源码位置，不是来自源码时返回无效的位置
+ */
+func (x *sourceIndex) resolve(pos Position) Position {
+	if x == nil || !pos.IsValid() {
+		return Position{}
+	}
+	n := sort.Search(len(x.segs), func(i int) bool {
+		return x.segs[i].line > pos.Line || (x.segs[i].line == pos.Line && x.segs[i].col > pos.Col)
+	}) - 1
+	if n < 0 || !x.segs[n].pos.IsValid() {
+		return Position{}
+	}
+	s := x.segs[n]
+	p := Position{File: s.pos.File, Start: s.pos.Start + pos.Start - s.start, End: s.pos.Start + pos.End - s.start}
+	if pos.Line == s.line {
+		p.Line, p.Col = s.pos.Line, s.pos.Col+pos.Col-s.col
+	} else {
+		p.Line, p.Col = s.pos.Line+pos.Line-s.line, pos.Col
+	}
+	return p
+}
+
+/**
+ * 把标签的位置换算为拼接代码对应的位置
+ */
+func (x *sourceIndex) remap(lst []*Tag) {
+	if x == nil {
+		return
+	}
+	for _, t := range lst {
+		t.Pos = x.resolve(t.Pos)
+	}
+}
+
+/**
+ * 把诊断信息的行列号换算为源码位置
+ */
+func (x *sourceIndex) remapDiagnostics(d *Diagnostics) {
+	if x == nil {
+		return
+	}
+	for _, v := range d.list {
+		if v.File != "" || v.Line == 0 {
+			continue
+		}
+		col := v.Col
+		if col == 0 {
+			col = 1
+		}
+		if p := x.resolve(Position{Line: v.Line, Col: col}); p.IsValid() {
+			v.File = filepath.ToSlash(filepath.Clean(p.File))
+			v.Line = p.Line
+			if v.Col > 0 {
+				v.Col = p.Col
+			}
+		}
+	}
+}
+
+/**
+ * 将标签列表拼接为代码，并记录每个标签的位置
+ */
+func tagsSource(lst []*Tag) (string, *sourceIndex) {
+	sb := bytes.NewBufferString("")
+	x := &sourceIndex{}
+	for _, t := range lst {
+		if t.TagType < -1 {
+			continue
+		}
+		x.Write(t.Pos, t.Value)
+		sb.WriteString(t.Value)
+	}
+	return sb.String(), x
+}
+
+//--------------------------------生成代码----------------------------------------
+
+/**
+ * 生成代码中的一个位置与源码位置的对应
+ */
+type codeMark struct {
+	line int //生成代码的行，从0开始
+	col  int //生成代码的列，从0开始，按UTF-16计算
+	pos  Position
+}
+
+/**
+ * 记录了源码位置的生成代码
+ */
+type mappedCode struct {
+	buf   bytes.Buffer
+	line  int
+	col   int
+	marks []codeMark
+}
+
+func (c *mappedCode) WriteString(value string) {
+	c.line, c.col = advance(c.line, c.col, value)
+	c.buf.WriteString(value)
+}
+
+/**
+ * 在当前位置记录源码位置
+ */
+func (c *mappedCode) Mark(pos Position) {
+	if pos.IsValid() {
+		c.marks = append(c.marks, codeMark{line: c.line, col: c.col, pos: pos})
+	}
+}
+
+/**
+ * 写入一段已经记录了源码位置的代码
+ */
+func (c *mappedCode) WriteMapped(value string, marks []codeMark) {
+	for _, v := range marks {
+		if v.line == 0 {
+			v.col += c.col
+		}
+		v.line += c.line
+		c.marks = append(c.marks, v)
+	}
+	c.WriteString(value)
+}
+
+func (c *mappedCode) String() string {
+	return c.buf.String()
+}
+
+/**
+ * 计算写入一段内容后的行列号
+ */
+func advance(line int, col int, value string) (int, int) {
+	for _, ch := range value {
+		if ch == '\n' {
+			line++
+			col = 0
+		} else if ch >= 0x10000 {
+			col += 2
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+/**
+ * 前面插入一段内容后的位置
+ */
+func offsetMarks(marks []codeMark, prefix string) []codeMark {
+	c := &mappedCode{}
+	c.WriteMapped(prefix, nil)
+	c.WriteMapped("", marks)
+	return c.marks
+}
+
+/**
+ * 输出标签列表，有源码位置的标签记录在生成代码中
+ * @param lst		标签列表
+ * @param nested	标签内容本身已经记录的源码位置，例如内部class
+ */
+func writeTags(lst []*Tag, nested map[*Tag][]codeMark) *mappedCode {
+	c := &mappedCode{}
+	for _, t := range lst {
+		if t.TagType < -1 {
+			continue
+		}
+		if strings.TrimSpace(t.Value) != "" { //空白不需要映射
+			c.Mark(t.Pos)
+		}
+		c.WriteMapped(t.Value, nested[t])
+	}
+	return c
+}
+
+//--------------------------------SourceMap----------------------------------------
+
+/**
+ * Source Map v3
+ */
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+	Name           string   `json:"-"` //发布时.map文件相对于发布目录的路径
+}
+
+/**
+ * 根据生成代码中记录的位置生成Source Map
+ * @param file	生成代码的名称
+ * @param roots	代码目录，源文件以相对于第一个包含它的目录的路径记录
+ * @param marks	生成代码中记录的源码位置，文件位置必须已经换算好
+ */
+func NewSourceMap(file string, roots []string, marks []codeMark) *SourceMap {
+	sm := &SourceMap{Version: 3, File: file, Sources: []string{}, SourcesContent: []string{}, Names: []string{}}
+	sort.SliceStable(marks, func(a, b int) bool {
+		if marks[a].line != marks[b].line {
+			return marks[a].line < marks[b].line
+		}
+		return marks[a].col < marks[b].col
+	})
+	files := make(map[string]int, 2)
+	sb := bytes.NewBufferString("")
+	line, col, src, sLine, sCol := 0, 0, 0, 0, 0
+	first := true //当前行是否还没有输出
+	for _, v := range marks {
+		if v.pos.File == "" {
+			continue
+		}
+		n, ok := files[v.pos.File]
+		if !ok {
+			n = len(sm.Sources)
+			files[v.pos.File] = n
+			sm.Sources = append(sm.Sources, sourceName(roots, v.pos.File))
+			code, _ := GetCode(v.pos.File)
+			sm.SourcesContent = append(sm.SourcesContent, code)
+		}
+		if v.line != line {
+			sb.WriteString(strings.Repeat(";", v.line-line))
+			line, col, first = v.line, 0, true
+		} else if !first && v.col == col { //同一位置只记录第一个
+			continue
+		}
+		if !first {
+			sb.WriteByte(',')
+		}
+		first = false
+		writeVLQ(sb, v.col-col)
+		writeVLQ(sb, n-src)
+		writeVLQ(sb, v.pos.Line-1-sLine)
+		writeVLQ(sb, v.pos.Col-1-sCol)
+		col, src, sLine, sCol = v.col, n, v.pos.Line-1, v.pos.Col-1
+	}
+	sm.Mappings = sb.String()
+	return sm
+}
+
+/**
+ * 源文件在Source Map中显示的名称
+ */
+func sourceName(roots []string, file string) string {
+	name := filepath.Base(file)
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, file); root != "" && err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+			break
+		}
+	}
+	return "jus:///" + filepath.ToSlash(name)
+}
+
+const vlqChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+/**
+ * Base64 VLQ编码
+ */
+func writeVLQ(sb *bytes.Buffer, value int) {
+	v := value << 1
+	if value < 0 {
+		v = (-value << 1) | 1
+	}
+	for {
+		d := v & 31
+		v >>= 5
+		if v > 0 {
+			d |= 32
+		}
+		sb.WriteByte(vlqChars[d])
+		if v == 0 {
+			break
+		}
+	}
+}
+
+func (sm *SourceMap) Bytes() []byte {
+	data, _ := json.Marshal(sm)
+	return data
+}
+
+/**
+ * 内联到生成代码中的data URL
+ */
+func (sm *SourceMap) DataURL() string {
+	return "data:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(sm.Bytes())
+}
+
+/**
+ * 脚本末尾的sourceURL和sourceMappingURL，发布时按内容hash命名.map文件后整体替换
+ * @param script	脚本名，相对于juis目录
+ * @param url		源码映射地址，相对于脚本
+ */
+func mapTrailer(script string, url string) string {
+	return "//# sourceURL=juis/" + script + "\r\n//# sourceMappingURL=" + url + "\r\n"
+}
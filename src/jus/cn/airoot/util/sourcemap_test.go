@@ -0,0 +1,224 @@
+// sourcemap_test.go
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSys = "../../../../../Release/lib" //脚本模板所在的系统目录
+
+/**
+ * 有脚本的组件，生成的脚本中 $title.text(value) 在第9行
+ */
+const cardHTML = "<div class=\"card\">\n\t<css>\n\t\tbody{border:1px solid #eee;}\n\t\t.title{font-weight:bold;}\n\t</css>\n\t<span id=\"title\" class=\"title\">card</span>\n\t<script>\n\t\tpublic function setTitle(value){\n\t\t\t$title.text(value);\n\t\t}\n\t</script>\n</div>\n"
+
+/**
+ * 在临时工程中按指定的源码映射方式编译comp.Card
+ * @return 工程目录，调用者负责删除
+ */
+func compileCard(t *testing.T, sourceMap string) (string, *JUS) {
+	dir, err := ioutil.TempDir("", "jusmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "code", "comp"), 0755)
+	if err := ioutil.WriteFile(filepath.Join(dir, "code", "comp", "Card.html"), []byte(cardHTML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jus := &JUS{SYSTEM_PATH: testSys, CLASS_PATH: testSys + "/code/", sourceMap: sourceMap}
+	if !jus.CreateFrom(dir+"/code/", "", nil, "comp.Card") {
+		t.Fatal("comp.Card isn't exist")
+	}
+	jus.resPath = "code"
+	return dir, jus
+}
+
+func TestWriteVLQ(t *testing.T) {
+	for v, want := range map[int]string{0: "A", 1: "C", -1: "D", 15: "e", -15: "f", 16: "gB", -16: "hB", 123: "2H", 1000: "w+B"} {
+		sb := &bytes.Buffer{}
+		writeVLQ(sb, v)
+		if sb.String() != want {
+			t.Errorf("writeVLQ(%d) = %q, want %q", v, sb.String(), want)
+		}
+		if got := decodeVLQ(want); len(got) != 1 || got[0] != v {
+			t.Errorf("decode %q = %v, want %d", want, got, v)
+		}
+	}
+}
+
+/**
+ * Base64 VLQ解码，返回一段中的所有数值
+ */
+func decodeVLQ(s string) []int {
+	lst := []int{}
+	v, shift := 0, 0
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(vlqChars, s[i])
+		v |= (d & 31) << shift
+		shift += 5
+		if d&32 == 0 {
+			if v&1 == 1 {
+				lst = append(lst, -(v >> 1))
+			} else {
+				lst = append(lst, v>>1)
+			}
+			v, shift = 0, 0
+		}
+	}
+	return lst
+}
+
+/**
+ * 解码mappings，返回生成代码每一行的 [列, 源文件, 源码行, 源码列]，都从0开始
+ */
+func decodeMappings(mappings string) [][][4]int {
+	lines := [][][4]int{}
+	var prev [4]int
+	for _, line := range strings.Split(mappings, ";") {
+		segs := [][4]int{}
+		prev[0] = 0 //列在每一行重新开始，其它值延续
+		for _, seg := range strings.Split(line, ",") {
+			if seg == "" {
+				continue
+			}
+			for i, d := range decodeVLQ(seg) {
+				prev[i] += d
+			}
+			segs = append(segs, prev)
+		}
+		lines = append(lines, segs)
+	}
+	return lines
+}
+
+func TestNewSourceMap(t *testing.T) {
+	dir, _ := compileCard(t, "")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "code", "comp", "Card.html")
+	marks := []codeMark{
+		{line: 2, col: 4, pos: Position{File: file, Line: 9, Col: 4}},
+		{line: 0, col: 0, pos: Position{File: file, Line: 8, Col: 3}},
+		{line: 2, col: 4, pos: Position{File: file, Line: 9, Col: 10}}, //同一位置只记录第一个
+		{line: 2, col: 10, pos: Position{File: file, Line: 9, Col: 10}},
+		{line: 1, col: 0, pos: Position{}}, //不是来自源码
+	}
+	sm := NewSourceMap("Card.js", []string{filepath.Join(dir, "code")}, marks)
+	if sm.File != "Card.js" || len(sm.Sources) != 1 || sm.Sources[0] != "jus:///comp/Card.html" {
+		t.Fatalf("file = %q, sources = %v", sm.File, sm.Sources)
+	}
+	if len(sm.SourcesContent) != 1 || !strings.Contains(sm.SourcesContent[0], "setTitle") {
+		t.Errorf("sourcesContent = %v", sm.SourcesContent)
+	}
+	if sm.Mappings != "AAOE;;IACC,MAAM" {
+		t.Errorf("mappings = %q", sm.Mappings)
+	}
+	want := [][][4]int{{{0, 0, 7, 2}}, {}, {{4, 0, 8, 3}, {10, 0, 8, 9}}}
+	got := decodeMappings(sm.Mappings)
+	if len(got) != len(want) {
+		t.Fatalf("decoded = %v, want %v", got, want)
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("line %d = %v, want %v", i, got[i], want[i])
+		}
+		for k := range want[i] {
+			if got[i][k] != want[i][k] {
+				t.Errorf("line %d = %v, want %v", i, got[i], want[i])
+			}
+		}
+	}
+}
+
+/**
+ * 生成的脚本中 $title.text(value) 所在的行必须映射回模块.html中的同一行
+ */
+func checkSourceMap(t *testing.T, sm *SourceMap, data string) {
+	if len(sm.Sources) == 0 || !strings.HasSuffix(sm.Sources[0], "comp/Card.html") {
+		t.Fatalf("sources = %v", sm.Sources)
+	}
+	start := strings.Index(data, "(function(")
+	if start == -1 {
+		t.Fatal("no script in output")
+	}
+	gen := strings.Split(data[start:], "\n")
+	src := strings.Split(sm.SourcesContent[0], "\n")
+	found := false
+	for i, segs := range decodeMappings(sm.Mappings) {
+		if i >= len(gen) || !strings.Contains(gen[i], ".text(value)") {
+			continue
+		}
+		for _, v := range segs {
+			if v[1] == 0 && v[2] < len(src) && strings.Contains(src[v[2]], "$title.text(value)") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no mapping back to $title.text(value): %q", sm.Mappings)
+	}
+}
+
+func TestSourceMapInline(t *testing.T) {
+	dir, jus := compileCard(t, SourceMapInline)
+	defer os.RemoveAll(dir)
+	data := string(jus.ToFormatBytes())
+	if !strings.Contains(data, "//# sourceURL=juis/comp/Card.js\r\n") {
+		t.Error("no sourceURL")
+	}
+	const prefix = "//# sourceMappingURL=data:application/json;charset=utf-8;base64,"
+	n := strings.Index(data, prefix)
+	if n == -1 {
+		t.Fatal("no inline sourceMappingURL")
+	}
+	if len(jus.SourceMaps()) != 0 {
+		t.Errorf("%d .map files in dev mode", len(jus.SourceMaps()))
+	}
+	url := data[n+len(prefix):]
+	url = url[0:strings.Index(url, "\r\n")]
+	b, err := base64.StdEncoding.DecodeString(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := &SourceMap{}
+	if err := json.Unmarshal(b, sm); err != nil {
+		t.Fatal(err)
+	}
+	if sm.Version != 3 || sm.File != "Card.js" {
+		t.Errorf("version = %d, file = %q", sm.Version, sm.File)
+	}
+	checkSourceMap(t, sm, data)
+}
+
+func TestSourceMapFile(t *testing.T) {
+	dir, jus := compileCard(t, SourceMapFile)
+	defer os.RemoveAll(dir)
+	data := string(jus.ToFormatBytes())
+	if !strings.Contains(data, "//# sourceURL=juis/comp/Card.js\r\n//# sourceMappingURL=Card.js.map\r\n") {
+		t.Error("no .map sourceMappingURL")
+	}
+	if strings.Contains(data, "data:application/json") {
+		t.Error("inline source map in release")
+	}
+	maps := jus.SourceMaps()
+	if len(maps) != 1 || maps[0].Name != "comp/Card.js.map" {
+		t.Fatalf("source maps = %v", maps)
+	}
+	sm := &SourceMap{}
+	if err := json.Unmarshal(maps[0].Bytes(), sm); err != nil {
+		t.Fatal(err)
+	}
+	checkSourceMap(t, sm, data)
+
+	none, jus := compileCard(t, "")
+	defer os.RemoveAll(none)
+	if strings.Contains(string(jus.ToFormatBytes()), "sourceMappingURL") || len(jus.SourceMaps()) != 0 {
+		t.Error("source map without sourceMap")
+	}
+}
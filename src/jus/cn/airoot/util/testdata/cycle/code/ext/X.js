@@ -0,0 +1,4 @@
+import cyc.G;
+class Inner extends G {
+	function init(){}
+}
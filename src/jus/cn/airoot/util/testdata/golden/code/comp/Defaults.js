@@ -0,0 +1,3 @@
+public function resize(width = 100, height = {auto:true}){
+	return width;
+}
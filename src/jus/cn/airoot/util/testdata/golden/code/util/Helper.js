@@ -0,0 +1,5 @@
+var count = 0;
+public function name(){
+	count++;
+	return "helper" + count;
+}
@@ -0,0 +1,179 @@
+// watch.go
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * 文件变化监视器，定时扫描目录，比较修改时间和大小
+ */
+type Watcher struct {
+	dirs    []string
+	exclude []string //不监视的文件和目录
+	files   map[string]fileStamp
+}
+
+/**
+ * @param dirs	监视的目录，不存在的目录忽略
+ */
+func NewWatcher(dirs ...string) *Watcher {
+	w := &Watcher{dirs: dirs}
+	w.files = w.scan()
+	return w
+}
+
+/**
+ * 设置不监视的文件和目录，已记录的文件中被排除的同时去掉，不会当作删除
+ * @param paths	文件或目录，为空字符串的忽略
+ */
+func (w *Watcher) Exclude(paths ...string) {
+	w.exclude = make([]string, 0, len(paths))
+	for _, v := range paths {
+		if v != "" {
+			w.exclude = append(w.exclude, filepath.Clean(v))
+		}
+	}
+	for path := range w.files {
+		if inDir(path, w.exclude...) {
+			delete(w.files, path)
+		}
+	}
+}
+
+/**
+ * 扫描所有目录，隐藏文件和目录、排除的文件和目录不监视
+ */
+func (w *Watcher) scan() map[string]fileStamp {
+	files := make(map[string]fileStamp, len(w.files))
+	for _, dir := range w.dirs {
+		if dir == "" {
+			continue
+		}
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != dir && (strings.HasPrefix(info.Name(), ".") || inDir(path, w.exclude...)) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				files[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+/**
+ * 与上次扫描比较
+ * @return 修改、新增和删除的文件
+ */
+func (w *Watcher) Changed() []string {
+	files := w.scan()
+	lst := make([]string, 0)
+	for path, s := range files {
+		if o, ok := w.files[path]; !ok || !o.modTime.Equal(s.modTime) || o.size != s.size {
+			lst = append(lst, path)
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			lst = append(lst, path)
+		}
+	}
+	w.files = files
+	sort.Strings(lst)
+	return lst
+}
+
+/**
+ * 工程中由开发服务器写入的文件和目录，监视时排除，否则每次写入都会通知页面重新加载
+ */
+func (u *JusServer) generated() []string {
+	return append([]string{u.cache.path, u.fixtures.path()}, u.access.files()...)
+}
+
+/**
+ * 监视工程代码目录、工程根目录中的静态文件和系统类库，文件变化时通知开发页面
+ * 代码目录中的变化只通知使用了此文件的模块，其他文件的变化通知所有页面重新加载
+ * 开发服务器写入工程的文件不监视，设置随 .jus 修改，每次扫描前重新读取
+ * 通知格式：
+ *	reload [className...]		重新加载使用了这些模块的页面，没有模块时全部重新加载
+ *	update className\r\n格式化内容	模块重新编译后的完整格式化内容，页面就地替换模块实例
+ */
+func (u *JusServer) watch() {
+	code := []string{u.RootPath + "/code", u.SysPath + "/code"}
+	w := NewWatcher(u.RootPath, u.SysPath+"/code")
+	w.Exclude(u.generated()...)
+	go func() {
+		lst := make([]string, 0)
+		for u.Status {
+			time.Sleep(500 * time.Millisecond)
+			w.Exclude(u.generated()...)
+			if changed := w.Changed(); len(changed) > 0 || len(lst) == 0 { //等待保存完成后再通知
+				lst = append(lst, changed...)
+				continue
+			}
+			all := false
+			seen := make(map[string]bool, 4)
+			modules := make([]string, 0)
+			for _, path := range lst {
+				if !inDir(path, code...) {
+					all = true
+					continue
+				}
+				for _, v := range u.cache.Affected(path) {
+					if !seen[v] {
+						seen[v] = true
+						modules = append(modules, v)
+					}
+				}
+			}
+			if all {
+				u.Broadcast("reload")
+			} else {
+				sort.Strings(modules)
+				for _, v := range modules { //重新编译后发送给页面替换，编译失败时重新加载
+					if b, ok, _ := u.compile(v); ok {
+						u.Broadcast("update " + v + "\r\n" + string(b))
+					} else {
+						u.Broadcast("reload " + v)
+					}
+				}
+			}
+			lst = lst[0:0]
+		}
+	}()
+}
+
+/**
+ * 发送信息给所有订阅了模块变化的开发页面
+ */
+func (u *JusServer) Broadcast(value string) {
+	for _, v := range u.WebsocketList() {
+		if v.Connected && v.Watch {
+			v.Conn.Write([]byte(value))
+		}
+	}
+}
+
+/**
+ * 文件是否在其中一个目录内
+ */
+func inDir(path string, dirs ...string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
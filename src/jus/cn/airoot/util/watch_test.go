@@ -0,0 +1,166 @@
+// watch_test.go
+package util
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWatcherExclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "juswatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data string) string {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	page := write("code/index.html", "<div></div>")
+	write("logs/access.log", "a")
+	write("fixtures/api/GET.json", "{}")
+
+	w := NewWatcher(dir)
+	w.Exclude(filepath.Join(dir, "logs"), filepath.Join(dir, "fixtures"), "")
+	write("logs/access.log", "ab")
+	write("logs/access.log.1", "a")
+	write("fixtures/api/POST.json", "{}")
+	if lst := w.Changed(); len(lst) != 0 {
+		t.Fatalf("changed = %v, want none", lst)
+	}
+	write("code/index.html", "<div>1</div>")
+	if lst := w.Changed(); !reflect.DeepEqual(lst, []string{page}) {
+		t.Fatalf("changed = %v, want %v", lst, []string{page})
+	}
+
+	w.Exclude() //取消排除后，原来排除的文件当作新增
+	if lst := w.Changed(); len(lst) != 4 {
+		t.Fatalf("changed = %v, want 4 files", lst)
+	}
+}
+
+func TestWatchGenerated(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":            "cache-path build/cache\r\naccess-log logs/access.log\r\naccess-log-backups 2",
+		"code/index.html": "<div></div>",
+	})
+	defer os.RemoveAll(u.RootPath)
+	lst := u.generated()
+	for _, v := range []string{"build/cache", "fixtures", "logs/access.log", "logs/access.log.2"} {
+		if !inDir(filepath.Join(u.RootPath, v), lst...) {
+			t.Errorf("%s isn't excluded: %v", v, lst)
+		}
+	}
+	for _, v := range []string{"code/index.html", "logs/access.log.3"} {
+		if inDir(filepath.Join(u.RootPath, v), lst...) {
+			t.Errorf("%s is excluded: %v", v, lst)
+		}
+	}
+}
+
+/**
+ * 订阅模块变化的开发页面
+ */
+func watchClient(t *testing.T, url string) *websocket.Conn {
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", "", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write([]byte("watch")); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func TestWatchBroadcast(t *testing.T) {
+	u := testProject(t, map[string]string{
+		".jus":                "",
+		"code/index.html":     "<div><comp.Card/></div>",
+		"code/about.html":     "<div>about</div>",
+		"code/comp/Card.html": "<div>card</div>",
+		"a.css":               "a{}",
+	})
+	defer os.RemoveAll(u.RootPath)
+	s := httptest.NewServer(u.handler())
+	defer s.Close()
+	go func() { //代替testServer接收连接断开的通知
+		for range u.testConnect {
+		}
+	}()
+	for _, v := range []string{"index", "about"} { //页面打开过，缓存中记录了依赖
+		if _, ok, _ := u.compile(v); !ok {
+			t.Fatalf("compile(%s) failed", v)
+		}
+	}
+
+	clients := []*websocket.Conn{watchClient(t, s.URL), watchClient(t, s.URL)}
+	for _, ws := range clients {
+		defer ws.Close()
+	}
+	for i := 0; i < 50; i++ { //等待订阅完成
+		n := 0
+		for _, v := range u.WebsocketList() {
+			if v.Watch {
+				n++
+			}
+		}
+		if n == len(clients) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	u.Status = true
+	defer func() { u.Status = false }()
+	u.watch()
+
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(u.RootPath, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		change func()
+		want   []string //每个页面依次收到的通知，update只比较首行和内容中的文字
+	}{
+		{"component", func() { write("code/comp/Card.html", "<div>card 2</div>") },
+			[]string{"update index\r\ncard 2"}},
+		{"page", func() { write("code/about.html", "<div>about 2</div>") },
+			[]string{"update about\r\nabout 2", "update index\r\ncard 2"}}, //index依赖code目录的文件列表
+		{"deleted", func() { os.Remove(filepath.Join(u.RootPath, "code/about.html")) },
+			[]string{"reload about", "update index\r\ncard 2"}},
+		{"static", func() { write("a.css", "a{color:red}") },
+			[]string{"reload"}},
+	}
+	for _, v := range tests {
+		v.change()
+		for i, ws := range clients {
+			for _, want := range v.want {
+				ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+				var msg string
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					t.Fatalf("%s: client %d: %v, want %q", v.name, i, err, want)
+				}
+				head, text := want, ""
+				if n := strings.Index(want, "\r\n"); n != -1 {
+					head, text = want[:n], want[n+2:]
+				}
+				if got := strings.SplitN(msg, "\r\n", 2)[0]; got != head || !strings.Contains(msg, text) {
+					t.Errorf("%s: client %d got %q, want %q", v.name, i, msg, want)
+				}
+			}
+		}
+	}
+}
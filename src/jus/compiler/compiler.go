@@ -0,0 +1,58 @@
+// compiler.go
+
+/*
+compiler 是JUS编译器的库接口，不依赖命令行和开发服务器，供其他Go程序直接编译模块
+
+	r, err := compiler.Compile("/path/to/myproject", "/path/to/Release/lib", "index")
+	if r != nil {
+		os.Stdout.Write(r.Data)
+	}
+*/
+package compiler
+
+import (
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/util"
+)
+
+/**
+ * 源码映射的输出方式
+ */
+const (
+	SourceMapInline = util.SourceMapInline //以data URL内联在生成的代码中
+	SourceMapFile   = util.SourceMapFile   //生成独立的.map文件，在Result.SourceMaps中
+)
+
+/**
+ * 编译选项
+ */
+type Options = util.CompileOptions
+
+/**
+ * 编译结果
+ */
+type Result = util.CompileResult
+
+/**
+ * 诊断信息
+ */
+type Diagnostic = util.Diagnostic
+
+/**
+ * 按开发服务器的方式编译一个模块
+ * @param projectRoot	工程目录，模块源码在其code目录下
+ * @param sysPath		系统目录，即发布目录中的lib
+ * @param className		模块类名，例如 index、comp.Card
+ * @return 编译结果；有编译错误时同时返回结果和错误
+ */
+func Compile(projectRoot string, sysPath string, className string) (*Result, error) {
+	return util.Compile(projectRoot, sysPath, className, nil)
+}
+
+/**
+ * 按指定选项编译一个模块，例如发布时
+ *
+ *	compiler.CompileWith(root, sys, "index", &compiler.Options{ResPath: "juis", SourceMap: compiler.SourceMapFile, Minify: true})
+ */
+func CompileWith(projectRoot string, sysPath string, className string, opt *Options) (*Result, error) {
+	return util.Compile(projectRoot, sysPath, className, opt)
+}
@@ -0,0 +1,74 @@
+// compiler_test.go
+package compiler
+
+import (
+	"github.com/tianyueshi/AIroot-JUS/src/jus/cn/airoot/format"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sysPath = "../../../Release/lib"
+
+func TestCompile(t *testing.T) {
+	r, err := Compile("testdata", sysPath, "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, lines, err := format.Decode(r.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != format.Version {
+		t.Errorf("version = %d", h.Version)
+	}
+	types := make([]string, 0, len(lines))
+	for _, l := range lines {
+		types = append(types, l.Type+" "+l.Name)
+	}
+	want := []string{"M comp.Card", "M index", "H index", "RS \bc1", "RS \b"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("lines = %q, want %q", types, want)
+	}
+	if !reflect.DeepEqual(r.Modules, []string{"comp.Card", "index"}) {
+		t.Errorf("Modules = %q", r.Modules)
+	}
+	if len(r.Files) == 0 {
+		t.Error("Files is empty")
+	}
+	if _, err := r.JSON(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompileWith(t *testing.T) {
+	r, err := CompileWith("testdata", sysPath, "comp/Card", &Options{ResPath: "juis", SourceMap: SourceMapFile, Minify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ClassName != "comp.Card" || len(r.SourceMaps) == 0 {
+		t.Errorf("class = %s, source maps = %d", r.ClassName, len(r.SourceMaps))
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	if r, err := Compile("testdata", sysPath, "nope"); r != nil || err == nil {
+		t.Errorf("Compile(nope) = %v, %v", r, err)
+	}
+	r, err := Compile("testdata", sysPath, "broken")
+	if r == nil || err == nil {
+		t.Fatalf("Compile(broken) = %v, %v", r, err)
+	}
+	if !strings.Contains(err.Error(), "isn't closed") {
+		t.Errorf("err = %v", err)
+	}
+	found := false
+	for _, v := range r.Diagnostics {
+		if v.Severity == "error" && strings.HasSuffix(v.File, "broken.html") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Diagnostics = %v", r.Diagnostics)
+	}
+}
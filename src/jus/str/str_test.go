@@ -0,0 +1,40 @@
+// str_test.go
+package str
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFmtCmd(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{"", []string{}},
+		{"release", []string{"release"}},
+		{"ctf  /code\tindex", []string{"ctf", "/code", "index"}},
+		{`open "C:/Program Files/a" b`, []string{"open", "C:/Program Files/a", "b"}},
+		{`say 'it''s'`, []string{"say", "it", "s"}},
+		{`a"b c"d`, []string{"a", "b c", "d"}},
+		{`x "a\"b" "c\\d"`, []string{"x", `a"b`, `c\d`}},
+		{`x ""`, []string{"x", ""}},
+		{"运行 模块", []string{"运行", "模块"}},
+	}
+	for _, v := range tests {
+		if got := FmtCmd(v.cmd); !reflect.DeepEqual(got, v.want) {
+			t.Errorf("FmtCmd(%q) = %q, want %q", v.cmd, got, v.want)
+		}
+	}
+}
+
+func TestFmtCmdList(t *testing.T) {
+	if got := FmtCmdList(""); len(got) != 0 {
+		t.Errorf("FmtCmdList(\"\") = %q", got)
+	}
+	got := FmtCmdList("a b\r\nc \"d e\"")
+	want := [][]string{{"a", "b"}, {"c", "d e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FmtCmdList = %q, want %q", got, want)
+	}
+}